@@ -1,16 +1,19 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"log/slog"
+	"net"
 	"os"
 	"os/signal"
 	"runtime"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
@@ -20,13 +23,76 @@ var version = "dev"
 
 const templateExt = ".tmpl"
 
+const (
+	transportStdio = "stdio"
+	transportHTTP  = "http"
+	transportSSE   = "sse"
+)
+
+// Subcommands that are run instead of the MCP server. They are given after the global flags,
+// e.g. "mcp-prompt-engine -prompts ./prompts lint -format json".
+const (
+	commandLint      = "lint"
+	commandList      = "list"
+	commandDescribe  = "describe"
+	commandTest      = "test"
+	commandFunctions = "functions"
+)
+
+// Output formats of the subcommands.
+const (
+	outputFormatText     = "text"
+	outputFormatJSON     = "json"
+	outputFormatTable    = "table"
+	outputFormatMarkdown = "markdown"
+)
+
 func main() {
 	showVersion := flag.Bool("version", false, "Show version and exit")
-	promptsDir := flag.String("prompts", "./prompts", "Directory containing prompt template files")
+	var promptsDirs stringListFlag
+	flag.Var(&promptsDirs, "prompts", "Directory containing prompt template files (default \"./prompts\"). "+
+		"Can be repeated or comma-separated; templates in later directories override ones with the same path in earlier ones")
 	logFile := flag.String("log-file", "", "Path to log file (if not specified, logs to stdout)")
 	templateFlag := flag.String("template", "", "Template name to render to stdout")
+	validate := flag.Bool("validate", false, "Load all prompt templates, report the ones that fail to load and exit")
 	disableJSONArgs := flag.Bool("disable-json-args", false, "Disable JSON parsing for arguments (use string-only mode)")
+	transport := flag.String("transport", transportStdio, "Transport to serve MCP over: stdio, http (streamable HTTP) or sse")
+	listenAddr := flag.String("listen", "localhost:8080", "Address to listen on for http and sse transports")
+	nameSeparator := flag.String("name-separator", defaultPromptNameSeparator,
+		"Separator used to join subdirectory names into prompt names (e.g. \"/\", \".\" or \"_\")")
+	enableTools := flag.Bool("enable-tools", false,
+		"Expose prompts via list_prompts, get_prompt_schema and render_prompt tools for clients without prompt support")
+	reloadDebounce := flag.Duration("reload-debounce", defaultReloadDebounce,
+		"Time to wait after the last template file change before reloading prompts; changes within it are coalesced")
+	templateArgs := make(argFlag)
+	flag.Var(templateArgs, "arg", "Argument of the template rendered with -template in the key=value form, "+
+		"or key=@file to read the value from a file. Can be repeated")
+	argsJSON := flag.String("args-json", "",
+		"File with a JSON object of arguments of the template rendered with -template, or - to read it from stdin")
+	strictArgs := flag.Bool("strict", false,
+		"Fail rendering a template with -template if required arguments are missing instead of rendering placeholders")
+	var includeRoots stringListFlag
+	flag.Var(&includeRoots, "include-root", "Directory templates can read files from with readFile, glob and fileTree "+
+		"in addition to the prompts directories. Can be repeated or comma-separated")
+	maxIncludeSize := flag.Int64("max-include-size", defaultMaxIncludeSize, "Maximum size in bytes of a file read with readFile")
+	var execAllow stringListFlag
+	flag.Var(&execAllow, "exec-allow", "Command line templates can run with exec, e.g. \"git diff\" allows \"git diff main.go\" "+
+		"but not options like \"git diff --staged\", which must be allowed explicitly. "+
+		"Can be repeated or comma-separated; exec is disabled if none is given")
+	execTimeout := flag.Duration("exec-timeout", defaultExecTimeout, "Maximum run time of a command executed with exec")
+	execMaxOutput := flag.Int("exec-max-output", defaultExecMaxOutput,
+		"Maximum size in bytes of the output of a command executed with exec")
+	execDir := flag.String("exec-dir", "", "Working directory of commands executed with exec (default: the current directory)")
+	gitDir := flag.String("git-dir", "", "Directory of the git repository the git built-in data is computed from "+
+		"(default: the current directory)")
+	timezone := flag.String("timezone", "",
+		"Timezone of the date built-in data and the now function, e.g. \"UTC\" or \"Europe/Berlin\" (default: the local timezone)")
+	fixedNow := flag.String("now", "",
+		"Fixed current time of templates in the RFC 3339 format, e.g. \"2024-01-02T15:04:05Z\", for deterministic rendering")
 	flag.Parse()
+	if len(promptsDirs) == 0 {
+		promptsDirs = stringListFlag{"./prompts"}
+	}
 
 	if *showVersion {
 		fmt.Println("App version: ", version)
@@ -34,20 +100,85 @@ func main() {
 		return
 	}
 
+	now, location, err := parseClockFlags(*fixedNow, *timezone)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	serverOpts := []PromptsServerOption{
+		WithPromptNameSeparator(*nameSeparator),
+		WithReloadDebounce(*reloadDebounce),
+		WithIncludeRoots(includeRoots...),
+		WithMaxIncludeSize(*maxIncludeSize),
+		WithExecAllow(execAllow...),
+		WithExecTimeout(*execTimeout),
+		WithExecMaxOutput(*execMaxOutput),
+		WithExecDir(*execDir),
+		WithGitDir(*gitDir),
+		WithClock(now),
+		WithTimezone(location),
+	}
+	if *enableTools {
+		serverOpts = append(serverOpts, WithPromptTools())
+	}
+
 	// If template flag is provided, render the template to stdout
 	if *templateFlag != "" {
-		if err := renderTemplate(os.Stdout, *promptsDir, *templateFlag); err != nil {
+		opts := renderOptions{args: make(map[string]string), strict: *strictArgs}
+		if *argsJSON != "" {
+			jsonArgs, err := readArgsJSON(*argsJSON, os.Stdin)
+			if err != nil {
+				log.Fatal(err)
+			}
+			opts.args = jsonArgs
+		}
+		// Arguments given with -arg override the ones from -args-json
+		for key, value := range templateArgs {
+			opts.args[key] = value
+		}
+		// Executed commands are logged to stderr, so they do not mix with the rendered template
+		auditLogger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+		ps := newOfflinePromptsServer(promptsDirs, !*disableJSONArgs, append(serverOpts, withAuditLogger(auditLogger))...)
+		if err := renderTemplate(os.Stdout, ps, *templateFlag, opts); err != nil {
 			log.Fatal(err)
 		}
 		return
 	}
 
-	if err := runMCPServer(*promptsDir, *logFile, !*disableJSONArgs); err != nil {
+	if *validate {
+		if err := validatePrompts(os.Stdout, newOfflinePromptsServer(promptsDirs, true, serverOpts...)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if flag.NArg() != 0 {
+		if err := runCommand(os.Stdout, flag.Arg(0), flag.Args()[1:], promptsDirs, !*disableJSONArgs, serverOpts...); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := runMCPServer(promptsDirs, *logFile, !*disableJSONArgs, *transport, *listenAddr, serverOpts...); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func runMCPServer(promptsDir string, logFile string, enableJSONArgs bool) error {
+func runMCPServer(
+	promptsDirs []string,
+	logFile string,
+	enableJSONArgs bool,
+	transport string,
+	listenAddr string,
+	serverOpts ...PromptsServerOption,
+) error {
+	switch transport {
+	case transportStdio, transportHTTP, transportSSE:
+	default:
+		return fmt.Errorf("unknown transport %q, must be one of: %s, %s, %s",
+			transport, transportStdio, transportHTTP, transportSSE)
+	}
+
 	// Configure logger
 	logWriter := os.Stdout
 	if logFile != "" {
@@ -61,7 +192,7 @@ func runMCPServer(promptsDir string, logFile string, enableJSONArgs bool) error
 	logger := slog.New(slog.NewTextHandler(logWriter, nil))
 
 	// Create PromptsServer instance
-	promptsSrv, err := NewPromptsServer(promptsDir, enableJSONArgs, logger)
+	promptsSrv, err := NewPromptsServer(promptsDirs, enableJSONArgs, logger, serverOpts...)
 	if err != nil {
 		return fmt.Errorf("new prompts server: %w", err)
 	}
@@ -81,48 +212,431 @@ func runMCPServer(promptsDir string, logFile string, enableJSONArgs bool) error
 		cancel()
 	}()
 
-	return promptsSrv.ServeStdio(ctx, os.Stdin, os.Stdout)
+	if transport == transportStdio {
+		return promptsSrv.ServeStdio(ctx, os.Stdin, os.Stdout)
+	}
+
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return fmt.Errorf("listen on %q: %w", listenAddr, err)
+	}
+	logger.Info("Listening for MCP clients", "transport", transport, "addr", ln.Addr().String())
+	if transport == transportSSE {
+		return promptsSrv.ServeSSE(ctx, ln)
+	}
+	return promptsSrv.ServeStreamableHTTP(ctx, ln)
+}
+
+// validatePrompts loads prompts the same way the server does and reports template files that fail to load.
+// It returns an error if any template file fails to load.
+func validatePrompts(w io.Writer, ps *PromptsServer) error {
+	prompts, templateErrs, err := ps.loadServerPrompts()
+	if err != nil {
+		return fmt.Errorf("load prompts: %w", err)
+	}
+	for _, templateErr := range templateErrs {
+		if _, err = fmt.Fprintln(w, templateErr.Error()); err != nil {
+			return err
+		}
+	}
+	if _, err = fmt.Fprintf(w, "%d prompt(s) loaded, %d template file(s) failed to load\n",
+		len(prompts), len(templateErrs)); err != nil {
+		return err
+	}
+	if len(templateErrs) != 0 {
+		return fmt.Errorf("%d template file(s) failed to load", len(templateErrs))
+	}
+	return nil
+}
+
+// newOfflinePromptsServer returns a PromptsServer that is not served and does not watch the prompts directories.
+// It is used to load and lint prompts the same way the server does, with the same template functions.
+func newOfflinePromptsServer(
+	promptsDirs []string, enableJSONArgs bool, serverOpts ...PromptsServerOption,
+) *PromptsServer {
+	ps := &PromptsServer{
+		promptsDirs:         promptsDirs,
+		enableJSONArgs:      enableJSONArgs,
+		promptNameSeparator: defaultPromptNameSeparator,
+		logger:              slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	for _, opt := range serverOpts {
+		opt(ps)
+	}
+	ps.initTemplateFuncs()
+	return ps
 }
 
-// renderTemplate renders a specified template to stdout with resolved partials and environment variables
-func renderTemplate(w io.Writer, promptsDir string, templateName string) error {
-	parser := &PromptsParser{}
+// withAuditLogger sets the logger of the commands run by the offline server, which does not log anything else.
+func withAuditLogger(logger *slog.Logger) PromptsServerOption {
+	return func(ps *PromptsServer) {
+		ps.auditLogger = logger
+	}
+}
 
-	tmpl, err := parser.ParseDir(promptsDir)
+// runCommand runs the subcommand with its arguments. Prompts are loaded with the server options
+// for the subcommands that inspect them.
+func runCommand(
+	w io.Writer, command string, args []string, promptsDirs []string, enableJSONArgs bool,
+	serverOpts ...PromptsServerOption,
+) error {
+	switch command {
+	case commandLint:
+		return runLint(w, args, newOfflinePromptsServer(promptsDirs, enableJSONArgs, serverOpts...))
+	case commandList:
+		return runList(w, args, newOfflinePromptsServer(promptsDirs, enableJSONArgs, serverOpts...))
+	case commandDescribe:
+		return runDescribe(w, args, newOfflinePromptsServer(promptsDirs, enableJSONArgs, serverOpts...))
+	case commandTest:
+		return runTest(w, args, newOfflinePromptsServer(promptsDirs, enableJSONArgs, serverOpts...))
+	case commandFunctions:
+		return runFunctions(w, args)
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// runLint checks the prompt templates with the parser of the server and reports the issues found.
+// It returns an error if any errors are found, or any warnings in strict mode, so the process exits
+// with a non-zero code.
+func runLint(w io.Writer, args []string, ps *PromptsServer) error {
+	flags := flag.NewFlagSet(commandLint, flag.ContinueOnError)
+	format := flags.String("format", outputFormatText, "Output format: text or json")
+	strict := flags.Bool("strict", false, "Fail on warnings as well as on errors")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format != outputFormatText && *format != outputFormatJSON {
+		return fmt.Errorf("unknown output format %q, must be one of: %s, %s", *format, outputFormatText, outputFormatJSON)
+	}
+
+	issues, err := ps.parser.Lint(ps.promptsDirs...)
 	if err != nil {
-		return fmt.Errorf("parse all prompts: %w", err)
+		return fmt.Errorf("lint prompts: %w", err)
+	}
+	var errorsCount, warningsCount int
+	for _, issue := range issues {
+		if issue.Severity == lintSeverityError {
+			errorsCount++
+		} else {
+			warningsCount++
+		}
 	}
 
-	if tmpl.Lookup(templateName) == nil {
-		if tmpl.Lookup(templateName+templateExt) == nil {
-			return fmt.Errorf("template %q or %q not found", templateName, templateName+templateExt)
+	if *format == outputFormatJSON {
+		if issues == nil {
+			issues = []LintIssue{}
 		}
-		templateName = templateName + templateExt
+		if err = writeJSON(w, issues); err != nil {
+			return fmt.Errorf("encode lint issues: %w", err)
+		}
+	} else {
+		for _, issue := range issues {
+			if _, err = fmt.Fprintln(w, issue.String()); err != nil {
+				return err
+			}
+		}
+		if _, err = fmt.Fprintf(w, "%d error(s), %d warning(s)\n", errorsCount, warningsCount); err != nil {
+			return err
+		}
+	}
+
+	if errorsCount != 0 || (*strict && warningsCount != 0) {
+		return fmt.Errorf("lint found %d error(s) and %d warning(s)", errorsCount, warningsCount)
+	}
+	return nil
+}
+
+// runList prints the prompts with their descriptions, arguments and source files.
+func runList(w io.Writer, args []string, ps *PromptsServer) error {
+	flags := flag.NewFlagSet(commandList, flag.ContinueOnError)
+	format := flags.String("format", outputFormatTable, "Output format: table, json or markdown")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := checkCatalogFormat(*format); err != nil {
+		return err
 	}
 
-	args, err := parser.ExtractPromptArgumentsFromTemplate(tmpl, templateName)
+	prompts, err := loadCatalogPrompts(ps)
 	if err != nil {
-		return fmt.Errorf("extract template arguments: %w", err)
+		return err
 	}
+	summaries := make([]promptSummary, 0, len(prompts))
+	for _, prompt := range prompts {
+		summaries = append(summaries, newPromptSummary(prompt))
+	}
+	return writePromptList(w, summaries, *format)
+}
 
-	data := make(map[string]interface{})
-	data["date"] = time.Now().Format("2006-01-02 15:04:05")
+// runDescribe prints the full model of the prompt given by name: its arguments, the partials it uses
+// and the argument values set by environment variables.
+func runDescribe(w io.Writer, args []string, ps *PromptsServer) error {
+	flags := flag.NewFlagSet(commandDescribe, flag.ContinueOnError)
+	format := flags.String("format", outputFormatTable, "Output format: table, json or markdown")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := checkCatalogFormat(*format); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("%s requires exactly one prompt name", commandDescribe)
+	}
+	promptName := flags.Arg(0)
 
-	// Add environment variables to data map
-	for _, arg := range args {
-		// Convert arg to TITLE_CASE for env var
-		envVarName := strings.ToUpper(arg)
-		if envValue, exists := os.LookupEnv(envVarName); exists {
-			data[arg] = envValue
-		} else {
-			data[arg] = "{{ " + arg + " }}"
+	prompts, err := loadCatalogPrompts(ps)
+	if err != nil {
+		return err
+	}
+	for _, prompt := range prompts {
+		if prompt.Prompt.Name == promptName {
+			return writePromptInfo(w, newPromptInfo(prompt, ps.enableJSONArgs), *format)
+		}
+	}
+	return fmt.Errorf("prompt %q not found", promptName)
+}
+
+func checkCatalogFormat(format string) error {
+	switch format {
+	case outputFormatTable, outputFormatJSON, outputFormatMarkdown:
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q, must be one of: %s, %s, %s",
+			format, outputFormatTable, outputFormatJSON, outputFormatMarkdown)
+	}
+}
+
+// loadCatalogPrompts loads the prompts sorted by name. Template files that fail to load are skipped,
+// as they are by the server, and can be found with -validate.
+func loadCatalogPrompts(ps *PromptsServer) ([]loadedPrompt, error) {
+	prompts, _, err := ps.loadServerPrompts()
+	if err != nil {
+		return nil, fmt.Errorf("load prompts: %w", err)
+	}
+	sort.Slice(prompts, func(i, j int) bool { return prompts[i].Prompt.Name < prompts[j].Prompt.Name })
+	return prompts, nil
+}
+
+// runTest runs the test cases of the prompts given by name, or of all prompts, and reports the results.
+// It returns an error if any test case fails, so the process exits with a non-zero code.
+func runTest(w io.Writer, args []string, ps *PromptsServer) error {
+	flags := flag.NewFlagSet(commandTest, flag.ContinueOnError)
+	update := flags.Bool("update", false, "Rewrite golden files with the rendered output instead of comparing with them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	results, err := ps.RunPromptTests(context.Background(), *update, flags.Args()...)
+	if err != nil {
+		return fmt.Errorf("run prompt tests: %w", err)
+	}
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[result.Status]++
+		name := result.Prompt
+		if result.Case != "" {
+			name += ": " + result.Case
+		}
+		if _, err = fmt.Fprintf(w, "%-7s %s\n", result.Status, name); err != nil {
+			return err
 		}
+		if result.Status == promptTestFailed {
+			for _, line := range strings.Split(strings.TrimSuffix(result.Message, "\n"), "\n") {
+				if _, err = fmt.Fprintf(w, "        %s\n", line); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if _, err = fmt.Fprintf(w, "%d passed, %d failed, %d updated\n",
+		counts[promptTestPassed], counts[promptTestFailed], counts[promptTestUpdated]); err != nil {
+		return err
 	}
+	if counts[promptTestFailed] != 0 {
+		return fmt.Errorf("%d prompt test(s) failed", counts[promptTestFailed])
+	}
+	return nil
+}
 
-	var result bytes.Buffer
-	if err = tmpl.ExecuteTemplate(&result, templateName, data); err != nil {
-		return fmt.Errorf("execute template: %w", err)
+// runFunctions prints the names, signatures and descriptions of the functions available in templates.
+func runFunctions(w io.Writer, args []string) error {
+	flags := flag.NewFlagSet(commandFunctions, flag.ContinueOnError)
+	format := flags.String("format", outputFormatTable, "Output format: table, json or markdown")
+	if err := flags.Parse(args); err != nil {
+		return err
 	}
-	_, err = w.Write(result.Bytes())
+	if err := checkCatalogFormat(*format); err != nil {
+		return err
+	}
+	return writeTemplateFunctions(w, *format)
+}
+
+// renderOptions controls how renderTemplate fills the template arguments.
+type renderOptions struct {
+	// args are argument values given on the command line, parsed the same way as arguments of MCP requests
+	args map[string]string
+	// strict fails rendering if required arguments are missing instead of rendering placeholders for them
+	strict bool
+}
+
+// renderTemplate renders the prompt loaded from the template to stdout with the handler of the server, so it
+// is rendered exactly as for MCP clients. The template is given by its path relative to the prompts directories,
+// with or without the extension, or by the prompt name. Missing scalar arguments are rendered as "{{ name }}"
+// placeholders unless the strict mode is on.
+func renderTemplate(w io.Writer, ps *PromptsServer, templateName string, opts renderOptions) error {
+	prompts, templateErrs, err := ps.loadServerPrompts()
+	if err != nil {
+		return fmt.Errorf("load prompts: %w", err)
+	}
+
+	promptName := strings.ReplaceAll(strings.TrimSuffix(templateName, templateExt), "/", ps.promptNameSeparator)
+	var prompt *loadedPrompt
+	for i := range prompts {
+		if prompts[i].Prompt.Name == promptName || prompts[i].Prompt.Name == templateName {
+			prompt = &prompts[i]
+			break
+		}
+	}
+	// Broken templates are reported only if the requested template cannot be found,
+	// since it may be one of them
+	if prompt == nil {
+		if len(templateErrs) != 0 {
+			return fmt.Errorf("template %q not found: %w", templateName, templateErrs)
+		}
+		return fmt.Errorf("template %q not found", templateName)
+	}
+
+	args := opts.args
+	if !opts.strict {
+		if args, err = withPlaceholders(prompt.args, opts.args, ps.enableJSONArgs); err != nil {
+			return err
+		}
+	}
+	text, err := prompt.render(context.Background(), args)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, text)
 	return err
 }
+
+// withPlaceholders returns the arguments with "{{ name }}" placeholders added for the missing untyped scalar
+// arguments without default values, so the template can be rendered without them. Placeholders are not valid
+// values of typed or inferred non-scalar arguments, so these are left unset, and an error is returned
+// if any of them is required.
+func withPlaceholders(
+	promptArgs []promptArgument, args map[string]string, enableJSONArgs bool,
+) (map[string]string, error) {
+	filled := make(map[string]string, len(promptArgs))
+	for name, value := range args {
+		filled[name] = value
+	}
+	var missing []string
+	for _, promptArg := range promptArgs {
+		if _, ok := filled[promptArg.name]; ok || promptArg.defaultValue != nil {
+			continue
+		}
+		isScalar := !enableJSONArgs || promptArg.kind == "" || promptArg.kind == argKindScalar
+		if !promptArg.schema.IsTyped() && isScalar {
+			filled[promptArg.name] = "{{ " + promptArg.name + " }}"
+			continue
+		}
+		if promptArg.required {
+			argInfo := argumentInfo{Type: promptArg.schema.Type, Schema: promptArg.schema.JSONSchema()}
+			if enableJSONArgs {
+				argInfo.Kind = promptArg.kind
+			}
+			missing = append(missing, fmt.Sprintf("missing argument %q (type %s)", promptArg.name, argInfo.typeName()))
+		}
+	}
+	if len(missing) != 0 {
+		return nil, errors.New(strings.Join(missing, "; "))
+	}
+	return filled, nil
+}
+
+// readArgsJSON reads prompt arguments from a JSON object in the file, or in the reader if the path is "-".
+func readArgsJSON(filePath string, stdin io.Reader) (map[string]string, error) {
+	var content []byte
+	var err error
+	if filePath == "-" {
+		content, err = io.ReadAll(stdin)
+	} else {
+		content, err = os.ReadFile(filePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read arguments: %w", err)
+	}
+	var values map[string]interface{}
+	if err = json.Unmarshal(content, &values); err != nil {
+		return nil, fmt.Errorf("decode arguments JSON object: %w", err)
+	}
+	return stringifyArgs(values)
+}
+
+// parseClockFlags returns the clock and timezone of templates set with the -now and -timezone flags,
+// or nil for the system clock and the local timezone.
+func parseClockFlags(now, timezone string) (func() time.Time, *time.Location, error) {
+	var clock func() time.Time
+	if now != "" {
+		t, err := time.Parse(time.RFC3339, now)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse current time: %w", err)
+		}
+		clock = fixedClock(t)
+	}
+	var location *time.Location
+	if timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(timezone); err != nil {
+			return nil, nil, fmt.Errorf("load timezone: %w", err)
+		}
+	}
+	return clock, location, nil
+}
+
+// stringListFlag is a flag value that collects values of a repeated flag, each of which may be comma-separated.
+type stringListFlag []string
+
+func (f *stringListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringListFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*f = append(*f, item)
+		}
+	}
+	return nil
+}
+
+// argFlag is a flag value that collects repeated key=value arguments. A value starting with "@"
+// is the path of a file to read the value from, e.g. "code=@main.go".
+type argFlag map[string]string
+
+func (f argFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for key, value := range f {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f argFlag) Set(value string) error {
+	key, argValue, found := strings.Cut(value, "=")
+	if !found || key == "" {
+		return fmt.Errorf("argument %q must be in the key=value form", value)
+	}
+	if filePath, isFile := strings.CutPrefix(argValue, "@"); isFile {
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("read value of argument %q: %w", key, err)
+		}
+		argValue = string(content)
+	}
+	f[key] = argValue
+	return nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
 	"strings"
 	"testing"
@@ -29,7 +30,7 @@ func (s *MainTestSuite) TestRenderTemplateErrorCases() {
 	var buf bytes.Buffer
 
 	// Test non-existent directory
-	err := renderTemplate(&buf, "/non/existent/directory", "template_name")
+	err := renderTemplate(&buf, newOfflinePromptsServer([]string{"/non/existent/directory"}, true), "template_name", renderOptions{})
 	assert.Error(s.T(), err, "renderTemplate() expected error for non-existent directory")
 
 	// Test template execution error with missing template
@@ -39,15 +40,177 @@ func (s *MainTestSuite) TestRenderTemplateErrorCases() {
 	require.NoError(s.T(), err, "Failed to write test file")
 
 	var errorBuf bytes.Buffer
-	err = renderTemplate(&errorBuf, s.tempDir, "error")
+	err = renderTemplate(&errorBuf, newOfflinePromptsServer([]string{s.tempDir}, true), "error", renderOptions{})
 	assert.Error(s.T(), err, "renderTemplate() expected execution error for missing template")
 
 	// Test error with non-existent template in renderTemplate
 	var nonExistentBuf bytes.Buffer
-	err = renderTemplate(&nonExistentBuf, s.tempDir, "does_not_exist")
+	err = renderTemplate(&nonExistentBuf, newOfflinePromptsServer([]string{s.tempDir}, true), "does_not_exist", renderOptions{})
 	assert.Error(s.T(), err, "renderTemplate() expected error for non-existent template")
 }
 
+// TestValidatePrompts tests reporting of template files that fail to load
+func (s *MainTestSuite) TestValidatePrompts() {
+	var buf bytes.Buffer
+	require.NoError(s.T(), validatePrompts(&buf, newOfflinePromptsServer([]string{"./testdata"}, true)), "validatePrompts() unexpected error")
+	assert.Contains(s.T(), buf.String(), "0 template file(s) failed to load", "Unexpected validation output")
+
+	require.NoError(s.T(), os.WriteFile(s.tempDir+"/good.tmpl", []byte("Hello {{.name}}"), 0644), "Failed to write test file")
+	require.NoError(s.T(), os.WriteFile(s.tempDir+"/broken.tmpl", []byte("{{.unclosed"), 0644), "Failed to write test file")
+	buf.Reset()
+	err := validatePrompts(&buf, newOfflinePromptsServer([]string{s.tempDir}, true))
+	assert.EqualError(s.T(), err, "1 template file(s) failed to load", "validatePrompts() expected error for broken template")
+	assert.Contains(s.T(), buf.String(), s.tempDir+"/broken.tmpl: parse template:", "Broken template should be reported")
+	assert.Contains(s.T(), buf.String(), "1 prompt(s) loaded, 1 template file(s) failed to load", "Unexpected validation output")
+
+	// Other templates can still be rendered
+	buf.Reset()
+	require.NoError(s.T(), renderTemplate(&buf, newOfflinePromptsServer([]string{s.tempDir}, true), "good", renderOptions{}), "renderTemplate() unexpected error")
+	assert.Equal(s.T(), "Hello {{ name }}", buf.String(), "Unexpected rendered output")
+}
+
+// TestRunLint tests the lint subcommand
+func (s *MainTestSuite) TestRunLint() {
+	var buf bytes.Buffer
+	require.NoError(s.T(), runCommand(&buf, commandLint, nil, []string{"./testdata"}, true), "lint unexpected error")
+	assert.Equal(s.T(), "testdata/few_shot.tmpl:2:3: warning: system messages are sent with the user role, "+
+		"since MCP prompts have no system role (system-message)\n0 error(s), 1 warning(s)\n", buf.String(), "Unexpected lint output")
+
+	require.NoError(s.T(), os.WriteFile(s.tempDir+"/prompt.tmpl", []byte("Hello {{.name}}"), 0644), "Failed to write test file")
+	buf.Reset()
+	require.NoError(s.T(), runCommand(&buf, commandLint, nil, []string{s.tempDir}, true), "Warnings should not fail lint")
+	assert.Equal(s.T(), s.tempDir+"/prompt.tmpl: warning: prompt has no description (missing-description)\n"+
+		"0 error(s), 1 warning(s)\n", buf.String(), "Unexpected lint output")
+
+	buf.Reset()
+	err := runCommand(&buf, commandLint, []string{"-strict"}, []string{s.tempDir}, true)
+	assert.EqualError(s.T(), err, "lint found 0 error(s) and 1 warning(s)", "Warnings should fail lint in strict mode")
+
+	require.NoError(s.T(), os.WriteFile(s.tempDir+"/broken.tmpl", []byte("{{/* Broken */}}\n{{.unclosed"), 0644),
+		"Failed to write test file")
+	buf.Reset()
+	err = runCommand(&buf, commandLint, []string{"-format", "json"}, []string{s.tempDir}, true)
+	assert.EqualError(s.T(), err, "lint found 1 error(s) and 1 warning(s)", "Errors should fail lint")
+	var issues []LintIssue
+	require.NoError(s.T(), json.Unmarshal(buf.Bytes(), &issues), "Failed to unmarshal lint issues")
+	require.Len(s.T(), issues, 2, "Expected 2 issues")
+	assert.Equal(s.T(), LintIssue{
+		Path: s.tempDir + "/broken.tmpl", Line: 2, Column: 2, Severity: lintSeverityError, Rule: lintRuleSyntaxError,
+		Message: "unclosed action",
+	}, issues[0], "Unexpected lint issue")
+
+	err = runCommand(&buf, commandLint, []string{"-format", "xml"}, []string{s.tempDir}, true)
+	assert.Error(s.T(), err, "Expected error for unknown output format")
+	err = runCommand(&buf, "unknown", nil, []string{s.tempDir}, true)
+	assert.EqualError(s.T(), err, `unknown command "unknown"`, "Expected error for unknown command")
+}
+
+// TestRunList tests the list subcommand
+func (s *MainTestSuite) TestRunList() {
+	var buf bytes.Buffer
+	require.NoError(s.T(), runCommand(&buf, commandList, nil, []string{"./testdata"}, true), "list unexpected error")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(s.T(), lines, 14, "Expected header and 13 prompts")
+	assert.Regexp(s.T(), `^NAME +DESCRIPTION +ARGUMENTS +SOURCE$`, lines[0], "Unexpected header")
+	assert.Regexp(s.T(), `^optional_args +Template with optional arguments and defaults +`+
+		`code, \[context\], \[programming_language\], reviewer +testdata/optional_args.tmpl$`, lines[8], "Unexpected prompt row")
+
+	buf.Reset()
+	err := runCommand(&buf, commandList, []string{"-format", "json"}, []string{"./testdata"}, true,
+		WithPromptNameSeparator("."))
+	require.NoError(s.T(), err, "list unexpected error")
+	var summaries []promptSummary
+	require.NoError(s.T(), json.Unmarshal(buf.Bytes(), &summaries), "Failed to unmarshal prompts")
+	require.Len(s.T(), summaries, 13, "Expected 13 prompts")
+	assert.Equal(s.T(), promptSummary{
+		Name:        "review.security",
+		Description: "Security review of the code in a nested directory",
+		Arguments:   []string{"src_path"},
+		Path:        "testdata/review/security.tmpl",
+	}, summaries[10], "Prompt names should follow the name separator")
+
+	buf.Reset()
+	require.NoError(s.T(), runCommand(&buf, commandList, []string{"-format", "markdown"}, []string{"./testdata"}, true))
+	assert.Contains(s.T(), buf.String(), "| Name | Description | Arguments | Source |\n| --- | --- | --- | --- |\n"+
+		"| conditional_greeting | Conditional greeting template | name, [show_extra_message] | testdata/conditional_greeting.tmpl |\n")
+
+	err = runCommand(&buf, commandList, []string{"-format", "text"}, []string{"./testdata"}, true)
+	assert.Error(s.T(), err, "Expected error for unknown output format")
+}
+
+// TestRunDescribe tests the describe subcommand
+func (s *MainTestSuite) TestRunDescribe() {
+	var buf bytes.Buffer
+	err := runCommand(&buf, commandDescribe, []string{"-format", "json", "review/security"}, []string{"./testdata"}, true)
+	require.NoError(s.T(), err, "describe unexpected error")
+	assert.JSONEq(s.T(), `{
+		"name": "review/security",
+		"description": "Security review of the code in a nested directory",
+		"path": "testdata/review/security.tmpl",
+		"arguments": [{"name": "src_path", "required": true, "kind": "scalar"}],
+		"partials": ["shared/_role"],
+		"envArguments": {}
+	}`, buf.String(), "Unexpected prompt description")
+
+	buf.Reset()
+	s.T().Setenv("SRC_PATH", "./src")
+	err = runCommand(&buf, commandDescribe, []string{"review/security"}, []string{"./testdata"}, false)
+	require.NoError(s.T(), err, "describe unexpected error")
+	assert.Equal(s.T(), `Name:         review/security
+Description:  Security review of the code in a nested directory
+Source:       testdata/review/security.tmpl
+Partials:     shared/_role
+
+Arguments:
+  none
+
+Environment:
+  NAME      VARIABLE  VALUE
+  src_path  SRC_PATH  ./src
+`, buf.String(), "Unexpected prompt description")
+
+	err = runCommand(&buf, commandDescribe, []string{"missing"}, []string{"./testdata"}, true)
+	assert.EqualError(s.T(), err, `prompt "missing" not found`, "Expected error for unknown prompt")
+	err = runCommand(&buf, commandDescribe, nil, []string{"./testdata"}, true)
+	assert.Error(s.T(), err, "Expected error for missing prompt name")
+}
+
+// TestRunTest tests the test subcommand
+func (s *MainTestSuite) TestRunTest() {
+	require.NoError(s.T(), os.WriteFile(s.tempDir+"/greeting.tmpl", []byte("{{/* Greeting */ -}}\nHello {{.name}}!"), 0644),
+		"Failed to write test file")
+	require.NoError(s.T(), os.WriteFile(s.tempDir+"/greeting.test.yaml", []byte("cases:\n  - name: alice\n    arguments: {name: Alice}\n"), 0644),
+		"Failed to write test file")
+
+	var buf bytes.Buffer
+	err := runCommand(&buf, commandTest, nil, []string{s.tempDir}, true)
+	assert.EqualError(s.T(), err, "1 prompt test(s) failed", "Missing golden file should fail the test")
+	assert.Equal(s.T(), "FAIL    greeting: alice\n"+
+		"        golden file "+s.tempDir+"/greeting.alice.golden does not exist, run with -update to create it\n"+
+		"0 passed, 1 failed, 0 updated\n", buf.String(), "Unexpected test output")
+
+	buf.Reset()
+	require.NoError(s.T(), runCommand(&buf, commandTest, []string{"-update"}, []string{s.tempDir}, true), "test -update unexpected error")
+	assert.Equal(s.T(), "UPDATED greeting: alice\n0 passed, 0 failed, 1 updated\n", buf.String(), "Unexpected test output")
+
+	buf.Reset()
+	require.NoError(s.T(), runCommand(&buf, commandTest, []string{"greeting"}, []string{s.tempDir}, true), "test unexpected error")
+	assert.Equal(s.T(), "PASS    greeting: alice\n1 passed, 0 failed, 0 updated\n", buf.String(), "Unexpected test output")
+}
+
+// TestRunFunctions tests the functions subcommand
+func (s *MainTestSuite) TestRunFunctions() {
+	var buf bytes.Buffer
+	require.NoError(s.T(), runCommand(&buf, commandFunctions, nil, nil, true), "functions unexpected error")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(s.T(), lines, len(templateFunctions)+1, "Expected header and every function")
+	assert.Regexp(s.T(), `^CATEGORY +SIGNATURE +DESCRIPTION$`, lines[0], "Unexpected header")
+	assert.Regexp(s.T(), `^string +indent WIDTH TEXT +Text with every non-empty line indented by WIDTH spaces$`, lines[7])
+
+	err := runCommand(&buf, commandFunctions, []string{"-format", "xml"}, nil, true)
+	assert.Error(s.T(), err, "Expected error for unknown output format")
+}
+
 // TestRenderTemplate tests template rendering with environment variables
 func (s *MainTestSuite) TestRenderTemplate() {
 	tests := []struct {
@@ -135,6 +298,17 @@ func (s *MainTestSuite) TestRenderTemplate() {
 			expectedOutput: "Admin Access: You have full access to server logs.\nAlert: System maintenance scheduled\nPremium Feature: Advanced Analytics is available.\nUser: admin_user",
 			shouldError:    false,
 		},
+		{
+			name:         "template with multiple messages",
+			templateName: "few_shot",
+			envVars: map[string]string{
+				"WORD": "goodbye",
+			},
+			// System messages are rendered with the user role, as they are sent to MCP clients
+			expectedOutput: "--- user ---\nYou are a helpful translator.\n--- user ---\nTranslate \"hello\" to French.\n" +
+				"--- assistant ---\nBonjour\n--- user ---\nTranslate \"goodbye\" to French.",
+			shouldError: false,
+		},
 		{
 			name:           "non-existent template",
 			templateName:   "non_existent_template",
@@ -169,7 +343,7 @@ func (s *MainTestSuite) TestRenderTemplate() {
 			}
 
 			var buf bytes.Buffer
-			err := renderTemplate(&buf, "./testdata", tt.templateName)
+			err := renderTemplate(&buf, newOfflinePromptsServer([]string{"./testdata"}, true), tt.templateName, renderOptions{})
 
 			if tt.shouldError {
 				assert.Error(s.T(), err, "expected error but got none")
@@ -183,6 +357,145 @@ func (s *MainTestSuite) TestRenderTemplate() {
 	}
 }
 
+// TestRenderTemplateWithArgs tests rendering a template with arguments given on the command line
+func (s *MainTestSuite) TestRenderTemplateWithArgs() {
+	tests := []struct {
+		name           string
+		templateName   string
+		opts           renderOptions
+		expectedOutput string
+		expectedErr    string
+	}{
+		{
+			name:           "typed arguments are coerced",
+			templateName:   "typed_args",
+			opts:           renderOptions{args: map[string]string{"count": "2", "items": `["a","b"]`, "format": "text"}},
+			expectedOutput: "Format: text\n- a\n- b\nCount: 2",
+		},
+		{
+			name:         "typed arguments are validated",
+			templateName: "typed_args",
+			opts:         renderOptions{args: map[string]string{"count": "0", "items": `["a"]`, "format": "html"}},
+			expectedErr:  `invalid arguments: "count": must be at least 1; "format": must be one of: text, markdown`,
+		},
+		{
+			name:         "JSON arguments are parsed",
+			templateName: "range_structs",
+			opts: renderOptions{args: map[string]string{
+				"users": `[{"name":"Alice","age":30,"role":"admin"}]`, "total": "1",
+			}},
+			expectedOutput: "Users:\n  - Alice (30) - admin\nTotal: 1 users",
+		},
+		{
+			name:           "missing arguments are rendered as placeholders",
+			templateName:   "greeting",
+			expectedOutput: "Hello {{ name }}!\nHave a great day!",
+		},
+		{
+			name:           "missing non-scalar arguments are left unset",
+			templateName:   "with_object",
+			expectedOutput: "Environment: {{ environment }}",
+		},
+		{
+			name:         "missing typed arguments are reported",
+			templateName: "typed_args",
+			opts:         renderOptions{args: map[string]string{"format": "text"}},
+			expectedErr:  `missing argument "count" (type integer); missing argument "items" (type array)`,
+		},
+		{
+			name:         "missing inferred arguments are reported",
+			templateName: "range_structs",
+			opts:         renderOptions{args: map[string]string{"total": "0"}},
+			expectedErr:  `missing argument "users" (type iterable (inferred))`,
+		},
+		{
+			name:         "missing arguments fail in strict mode",
+			templateName: "optional_args",
+			opts:         renderOptions{args: map[string]string{"programming_language": "Go"}, strict: true},
+			expectedErr:  `invalid arguments: "code": argument is required; "reviewer": argument is required`,
+		},
+		{
+			name:           "optional arguments are not required in strict mode",
+			templateName:   "optional_args",
+			opts:           renderOptions{args: map[string]string{"code": "x := 1", "reviewer": "Bob"}, strict: true},
+			expectedOutput: "Review the following Go code:\nx := 1\nReviewer: Bob",
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			var buf bytes.Buffer
+			err := renderTemplate(&buf, newOfflinePromptsServer([]string{"./testdata"}, true), tt.templateName, tt.opts)
+			if tt.expectedErr != "" {
+				assert.EqualError(s.T(), err, tt.expectedErr, "renderTemplate() unexpected error")
+				return
+			}
+			require.NoError(s.T(), err, "renderTemplate() unexpected error")
+			assert.Equal(s.T(), tt.expectedOutput, normalizeNewlines(buf.String()), "unexpected output")
+		})
+	}
+}
+
+// TestParseClockFlags tests rendering with the clock and timezone set with the -now and -timezone flags
+func (s *MainTestSuite) TestParseClockFlags() {
+	require.NoError(s.T(), os.WriteFile(s.tempDir+"/today.tmpl", []byte(`{{.date}} ({{weekday now}})`), 0644),
+		"Failed to write test file")
+
+	now, location, err := parseClockFlags("2024-06-30T22:00:00Z", "America/New_York")
+	require.NoError(s.T(), err, "parseClockFlags() unexpected error")
+	var buf bytes.Buffer
+	require.NoError(s.T(), renderTemplate(&buf, newOfflinePromptsServer([]string{s.tempDir}, true, WithClock(now), WithTimezone(location)), "today", renderOptions{}),
+		"renderTemplate() unexpected error")
+	assert.Equal(s.T(), "2024-06-30 18:00:00 (Sunday)", buf.String(), "Unexpected output")
+
+	now, location, err = parseClockFlags("", "")
+	require.NoError(s.T(), err, "parseClockFlags() unexpected error")
+	assert.Nil(s.T(), now, "System clock should be used by default")
+	assert.Nil(s.T(), location, "Local timezone should be used by default")
+
+	_, _, err = parseClockFlags("yesterday", "")
+	assert.ErrorContains(s.T(), err, "parse current time", "Expected error for invalid time")
+	_, _, err = parseClockFlags("", "Mars/Olympus_Mons")
+	assert.ErrorContains(s.T(), err, "load timezone", "Expected error for unknown timezone")
+}
+
+// TestArgFlag tests parsing of repeated -arg flags
+func (s *MainTestSuite) TestArgFlag() {
+	valueFile := s.tempDir + "/value.txt"
+	require.NoError(s.T(), os.WriteFile(valueFile, []byte("line1\nline2"), 0644), "Failed to write test file")
+
+	args := make(argFlag)
+	require.NoError(s.T(), args.Set("name=Alice"))
+	require.NoError(s.T(), args.Set("expr=a=b"))
+	require.NoError(s.T(), args.Set("empty="))
+	require.NoError(s.T(), args.Set("code=@"+valueFile))
+	assert.Equal(s.T(), argFlag{"name": "Alice", "expr": "a=b", "empty": "", "code": "line1\nline2"}, args)
+
+	assert.Error(s.T(), args.Set("name"), "Expected error for argument without value")
+	assert.Error(s.T(), args.Set("=value"), "Expected error for argument without name")
+	assert.Error(s.T(), args.Set("code=@"+s.tempDir+"/missing.txt"), "Expected error for missing file")
+}
+
+// TestReadArgsJSON tests reading arguments from a JSON object
+func (s *MainTestSuite) TestReadArgsJSON() {
+	argsFile := s.tempDir + "/args.json"
+	require.NoError(s.T(), os.WriteFile(argsFile, []byte(`{"name": "Alice", "count": 2, "items": ["a", "b"]}`), 0644),
+		"Failed to write test file")
+
+	args, err := readArgsJSON(argsFile, nil)
+	require.NoError(s.T(), err, "readArgsJSON() unexpected error")
+	assert.Equal(s.T(), map[string]string{"name": "Alice", "count": "2", "items": `["a","b"]`}, args)
+
+	args, err = readArgsJSON("-", strings.NewReader(`{"name": "Bob"}`))
+	require.NoError(s.T(), err, "readArgsJSON() unexpected error")
+	assert.Equal(s.T(), map[string]string{"name": "Bob"}, args)
+
+	_, err = readArgsJSON("-", strings.NewReader(`["a"]`))
+	assert.Error(s.T(), err, "Expected error for JSON array")
+	_, err = readArgsJSON(s.tempDir+"/missing.json", nil)
+	assert.Error(s.T(), err, "Expected error for missing file")
+}
+
 // normalizeNewlines is a helper function to normalize newlines in strings
 func normalizeNewlines(s string) string {
 	// Replace multiple consecutive newlines with single newlines
@@ -0,0 +1,549 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Argument types supported in the argument schema.
+const (
+	argTypeString  = "string"
+	argTypeNumber  = "number"
+	argTypeInteger = "integer"
+	argTypeBoolean = "boolean"
+	argTypeArray   = "array"
+	argTypeObject  = "object"
+	argTypeEnum    = "enum"
+	argTypePath    = "path"
+)
+
+// ArgumentSchema is a JSON-Schema-like description of a prompt argument value.
+// An empty schema means the argument is untyped and is parsed as before (JSON with string fallback).
+type ArgumentSchema struct {
+	Type       string                     `yaml:"type"`
+	Enum       []interface{}              `yaml:"enum"`
+	MinLength  *int                       `yaml:"minLength"`
+	MaxLength  *int                       `yaml:"maxLength"`
+	Pattern    string                     `yaml:"pattern"`
+	Minimum    *float64                   `yaml:"minimum"`
+	Maximum    *float64                   `yaml:"maximum"`
+	MinItems   *int                       `yaml:"minItems"`
+	MaxItems   *int                       `yaml:"maxItems"`
+	Items      *ArgumentSchema            `yaml:"items"`
+	Properties map[string]*ArgumentSchema `yaml:"properties"`
+}
+
+// IsTyped reports whether the schema declares a type or constraints for the argument.
+func (s *ArgumentSchema) IsTyped() bool {
+	return s.Type != "" || len(s.Enum) != 0
+}
+
+// Validate checks that the schema itself is well-formed.
+func (s *ArgumentSchema) Validate() error {
+	switch s.Type {
+	case "", argTypeString, argTypeNumber, argTypeInteger, argTypeBoolean, argTypeArray, argTypeObject, argTypePath:
+	case argTypeEnum:
+		if len(s.Enum) == 0 {
+			return fmt.Errorf("type %q requires non-empty enum values", argTypeEnum)
+		}
+	default:
+		return fmt.Errorf("unknown type %q", s.Type)
+	}
+	if s.Pattern != "" {
+		if _, err := regexp.Compile(s.Pattern); err != nil {
+			return fmt.Errorf("compile pattern: %w", err)
+		}
+	}
+	if s.Items != nil {
+		if err := s.Items.Validate(); err != nil {
+			return fmt.Errorf("items: %w", err)
+		}
+	}
+	for name, propSchema := range s.Properties {
+		if propSchema == nil {
+			continue
+		}
+		if err := propSchema.Validate(); err != nil {
+			return fmt.Errorf("property %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// JSONSchema returns the JSON Schema representation of the schema. The enum type is represented
+// as a string with enum values, the path type as a string with the "path" format,
+// and an untyped schema as an empty schema that accepts any value.
+func (s *ArgumentSchema) JSONSchema() map[string]interface{} {
+	schema := make(map[string]interface{})
+	switch s.Type {
+	case "":
+	case argTypeEnum:
+		schema["type"] = argTypeString
+	case argTypePath:
+		schema["type"] = argTypeString
+		schema["format"] = argTypePath
+	default:
+		schema["type"] = s.Type
+	}
+	if len(s.Enum) != 0 {
+		schema["enum"] = s.Enum
+	}
+	if s.MinLength != nil {
+		schema["minLength"] = *s.MinLength
+	}
+	if s.MaxLength != nil {
+		schema["maxLength"] = *s.MaxLength
+	}
+	if s.Pattern != "" {
+		schema["pattern"] = s.Pattern
+	}
+	if s.Minimum != nil {
+		schema["minimum"] = *s.Minimum
+	}
+	if s.Maximum != nil {
+		schema["maximum"] = *s.Maximum
+	}
+	if s.MinItems != nil {
+		schema["minItems"] = *s.MinItems
+	}
+	if s.MaxItems != nil {
+		schema["maxItems"] = *s.MaxItems
+	}
+	if s.Items != nil {
+		schema["items"] = s.Items.JSONSchema()
+	}
+	if len(s.Properties) != 0 {
+		properties := make(map[string]interface{}, len(s.Properties))
+		for name, propSchema := range s.Properties {
+			if propSchema == nil {
+				properties[name] = map[string]interface{}{}
+				continue
+			}
+			properties[name] = propSchema.JSONSchema()
+		}
+		schema["properties"] = properties
+	}
+	return schema
+}
+
+// ValidateDefault checks that the default value declared in the front matter is valid for the schema.
+func (s *ArgumentSchema) ValidateDefault(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	// YAML values are validated as the JSON values they are equivalent to, e.g. YAML integers as JSON numbers
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encode default value: %w", err)
+	}
+	var decoded interface{}
+	if err = json.Unmarshal(encoded, &decoded); err != nil {
+		return fmt.Errorf("decode default value: %w", err)
+	}
+	if problems := s.validateValue("", decoded); len(problems) != 0 {
+		return fmt.Errorf("%s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// Coerce converts the raw argument value received from the client to the schema type
+// and validates it against the schema constraints.
+func (s *ArgumentSchema) Coerce(raw string) (interface{}, error) {
+	var value interface{}
+	switch s.Type {
+	case "", argTypeString, argTypeEnum, argTypePath:
+		value = raw
+	case argTypeNumber:
+		num, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected number, got %q", raw)
+		}
+		value = num
+	case argTypeInteger:
+		num, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected integer, got %q", raw)
+		}
+		value = num
+	case argTypeBoolean:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("expected boolean, got %q", raw)
+		}
+		value = b
+	case argTypeArray, argTypeObject:
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			return nil, fmt.Errorf("expected JSON %s: %w", s.Type, err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q", s.Type)
+	}
+
+	if problems := s.validateValue("", value); len(problems) != 0 {
+		return nil, fmt.Errorf("%s", strings.Join(problems, ", "))
+	}
+	return value, nil
+}
+
+// validateValue validates the decoded value against the schema and returns descriptions of all violations.
+// The path identifies the nested value within the argument (empty for the argument itself).
+func (s *ArgumentSchema) validateValue(path string, value interface{}) []string {
+	problemf := func(format string, args ...interface{}) string {
+		if path == "" {
+			return fmt.Sprintf(format, args...)
+		}
+		return path + ": " + fmt.Sprintf(format, args...)
+	}
+
+	var problems []string
+	switch s.Type {
+	case argTypeString, argTypeEnum, argTypePath:
+		str, ok := value.(string)
+		if !ok {
+			return []string{problemf("expected string, got %s", jsonTypeName(value))}
+		}
+		length := len([]rune(str))
+		if s.MinLength != nil && length < *s.MinLength {
+			problems = append(problems, problemf("length must be at least %d", *s.MinLength))
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			problems = append(problems, problemf("length must be at most %d", *s.MaxLength))
+		}
+		if s.Pattern != "" {
+			if re, err := regexp.Compile(s.Pattern); err == nil && !re.MatchString(str) {
+				problems = append(problems, problemf("must match pattern %q", s.Pattern))
+			}
+		}
+	case argTypeNumber, argTypeInteger:
+		var num float64
+		switch v := value.(type) {
+		case float64:
+			num = v
+		case int64:
+			num = float64(v)
+		default:
+			return []string{problemf("expected %s, got %s", s.Type, jsonTypeName(value))}
+		}
+		if s.Type == argTypeInteger && num != math.Trunc(num) {
+			return []string{problemf("expected integer, got %v", num)}
+		}
+		if s.Minimum != nil && num < *s.Minimum {
+			problems = append(problems, problemf("must be at least %v", *s.Minimum))
+		}
+		if s.Maximum != nil && num > *s.Maximum {
+			problems = append(problems, problemf("must be at most %v", *s.Maximum))
+		}
+	case argTypeBoolean:
+		if _, ok := value.(bool); !ok {
+			return []string{problemf("expected boolean, got %s", jsonTypeName(value))}
+		}
+	case argTypeArray:
+		items, ok := value.([]interface{})
+		if !ok {
+			return []string{problemf("expected array, got %s", jsonTypeName(value))}
+		}
+		if s.MinItems != nil && len(items) < *s.MinItems {
+			problems = append(problems, problemf("must contain at least %d items", *s.MinItems))
+		}
+		if s.MaxItems != nil && len(items) > *s.MaxItems {
+			problems = append(problems, problemf("must contain at most %d items", *s.MaxItems))
+		}
+		if s.Items != nil {
+			for i, item := range items {
+				problems = append(problems, s.Items.validateValue(fmt.Sprintf("%s[%d]", path, i), item)...)
+			}
+		}
+	case argTypeObject:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{problemf("expected object, got %s", jsonTypeName(value))}
+		}
+		propNames := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			propNames = append(propNames, name)
+		}
+		sort.Strings(propNames)
+		for _, name := range propNames {
+			propValue, exists := obj[name]
+			if !exists || s.Properties[name] == nil {
+				continue
+			}
+			propPath := name
+			if path != "" {
+				propPath = path + "." + name
+			}
+			problems = append(problems, s.Properties[name].validateValue(propPath, propValue)...)
+		}
+	}
+
+	if len(s.Enum) != 0 && !s.enumContains(value) {
+		enumValues := make([]string, 0, len(s.Enum))
+		for _, enumValue := range s.Enum {
+			enumValues = append(enumValues, fmt.Sprint(enumValue))
+		}
+		problems = append(problems, problemf("must be one of: %s", strings.Join(enumValues, ", ")))
+	}
+
+	return problems
+}
+
+func (s *ArgumentSchema) enumContains(value interface{}) bool {
+	str := fmt.Sprint(value)
+	for _, enumValue := range s.Enum {
+		if fmt.Sprint(enumValue) == str {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonTypeName returns the JSON type name of the decoded value for error messages.
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return argTypeString
+	case float64, int64:
+		return argTypeNumber
+	case bool:
+		return argTypeBoolean
+	case []interface{}:
+		return argTypeArray
+	case map[string]interface{}:
+		return argTypeObject
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// ArgumentError describes a single invalid prompt argument.
+type ArgumentError struct {
+	Argument string `json:"argument"`
+	Message  string `json:"message"`
+}
+
+// ArgumentsError lists every invalid argument of a prompt request.
+type ArgumentsError struct {
+	Errors []ArgumentError
+}
+
+func (e *ArgumentsError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, argErr := range e.Errors {
+		msgs = append(msgs, fmt.Sprintf("%q: %s", argErr.Argument, argErr.Message))
+	}
+	return "invalid arguments: " + strings.Join(msgs, "; ")
+}
+
+// promptArgument is a prompt argument exposed to MCP clients.
+type promptArgument struct {
+	name         string
+	required     bool
+	defaultValue interface{}
+	description  string
+	schema       ArgumentSchema
+	// kind is the argument kind inferred from the template, used to parse untyped arguments
+	kind string
+}
+
+// newPromptArguments builds the prompt arguments exposed to clients from the arguments extracted from the template
+// and the metadata declared in its front matter. Arguments set by upper-cased environment variables are not exposed
+// to clients and are returned as values instead.
+func newPromptArguments(
+	args []TemplateArgument, metadata PromptMetadata, enableJSONArgs bool,
+) ([]promptArgument, map[string]string) {
+	envArgs := make(map[string]string)
+	var promptArgs []promptArgument
+	for _, arg := range args {
+		// Convert arg to TITLE_CASE for env var
+		envVarName := strings.ToUpper(arg.Name)
+		if envValue, exists := os.LookupEnv(envVarName); exists {
+			envArgs[arg.Name] = envValue
+			continue
+		}
+
+		argMeta, _ := metadata.Argument(arg.Name)
+		promptArg := promptArgument{
+			name:         arg.Name,
+			required:     !arg.Optional && argMeta.Default == nil,
+			defaultValue: argMeta.Default,
+			description:  argMeta.Description,
+			schema:       argMeta.ArgumentSchema,
+			kind:         arg.Kind,
+		}
+		// Untyped arguments are parsed according to their usage only if JSON parsing is enabled
+		if promptArg.description == "" && !promptArg.schema.IsTyped() && enableJSONArgs {
+			promptArg.description = inferredArgumentDescription(arg.Kind, arg.Fields)
+		}
+		if argMeta.Required != nil {
+			promptArg.required = *argMeta.Required
+		}
+		promptArgs = append(promptArgs, promptArg)
+	}
+	return promptArgs, envArgs
+}
+
+// stringifyArgs converts argument values decoded from JSON to strings as they are sent in MCP prompt requests:
+// strings are kept as is and other values are encoded as JSON.
+func stringifyArgs(values map[string]interface{}) (map[string]string, error) {
+	args := make(map[string]string, len(values))
+	for name, value := range values {
+		if str, isStr := value.(string); isStr {
+			args[name] = str
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("marshal argument %q: %w", name, err)
+		}
+		args[name] = string(encoded)
+	}
+	return args, nil
+}
+
+// parsePromptArgs validates request arguments against the prompt arguments and stores the coerced values
+// in the data map. Missing arguments fall back to their default values. Untyped arguments are parsed according to
+// the kind inferred from the template, and arguments of unknown kind or unknown to the prompt are parsed with
+// parseMCPArgs. Every invalid argument is reported in the returned error.
+func parsePromptArgs(
+	promptArgs []promptArgument, args map[string]string, enableJSONArgs bool, data map[string]interface{},
+) error {
+	var argErrs []ArgumentError
+	untypedArgs := make(map[string]string)
+	knownArgs := make(map[string]struct{}, len(promptArgs))
+	for _, promptArg := range promptArgs {
+		knownArgs[promptArg.name] = struct{}{}
+		value, ok := args[promptArg.name]
+		if !ok {
+			if promptArg.defaultValue != nil {
+				data[promptArg.name] = promptArg.defaultValue
+			} else if promptArg.required {
+				argErrs = append(argErrs, ArgumentError{Argument: promptArg.name, Message: "argument is required"})
+			}
+			continue
+		}
+		if !promptArg.schema.IsTyped() {
+			if !enableJSONArgs || promptArg.kind == "" {
+				untypedArgs[promptArg.name] = value
+				continue
+			}
+			parsed, err := parseInferredArg(promptArg.kind, value)
+			if err != nil {
+				argErrs = append(argErrs, ArgumentError{Argument: promptArg.name, Message: err.Error()})
+				continue
+			}
+			data[promptArg.name] = parsed
+			continue
+		}
+		coerced, err := promptArg.schema.Coerce(value)
+		if err != nil {
+			argErrs = append(argErrs, ArgumentError{Argument: promptArg.name, Message: err.Error()})
+			continue
+		}
+		data[promptArg.name] = coerced
+	}
+	for name, value := range args {
+		if _, ok := knownArgs[name]; !ok {
+			untypedArgs[name] = value
+		}
+	}
+	parseMCPArgs(untypedArgs, enableJSONArgs, data)
+
+	if len(argErrs) != 0 {
+		sort.Slice(argErrs, func(i, j int) bool { return argErrs[i].Argument < argErrs[j].Argument })
+		return &ArgumentsError{Errors: argErrs}
+	}
+	return nil
+}
+
+// parseMCPArgs attempts to parse each argument value as JSON when enableJSONArgs is true.
+// If parsing succeeds, stores the parsed value (bool, number, nil, object, etc.) in the data map.
+// If parsing fails or JSON parsing is disabled, stores the original string value.
+func parseMCPArgs(args map[string]string, enableJSONArgs bool, data map[string]interface{}) {
+	for key, value := range args {
+		if enableJSONArgs {
+			var parsed interface{}
+			if err := json.Unmarshal([]byte(value), &parsed); err == nil {
+				data[key] = parsed
+				continue
+			}
+		}
+		data[key] = value
+	}
+}
+
+// parseInferredArg parses the untyped argument value according to the argument kind inferred from the template.
+// Iterable, array and object arguments must be valid JSON, boolean and number arguments are parsed if the value is
+// a valid boolean or number and kept as strings otherwise, and scalar arguments are always kept as strings.
+func parseInferredArg(kind, value string) (interface{}, error) {
+	switch kind {
+	case argKindBoolean:
+		if b, err := strconv.ParseBool(strings.TrimSpace(value)); err == nil {
+			return b, nil
+		}
+	case argKindNumber:
+		// Integers are compared with integer constants in templates, so they are not parsed as floats
+		if num, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+			return num, nil
+		}
+		var num float64
+		if err := json.Unmarshal([]byte(value), &num); err == nil {
+			return num, nil
+		}
+	case argKindArray, argKindObject:
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+			return nil, fmt.Errorf("expected JSON %s: %w", kind, err)
+		}
+		if jsonTypeName(parsed) != kind {
+			return nil, fmt.Errorf("expected JSON %s, got %s", kind, jsonTypeName(parsed))
+		}
+		return parsed, nil
+	case argKindIterable:
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+			return nil, fmt.Errorf("expected JSON array or object: %w", err)
+		}
+		if typeName := jsonTypeName(parsed); typeName != argKindArray && typeName != argKindObject {
+			return nil, fmt.Errorf("expected JSON array or object, got %s", typeName)
+		}
+		return parsed, nil
+	}
+	return value, nil
+}
+
+// inferredArgumentDescription describes the value expected for the argument of the inferred kind.
+// It is used for arguments without a description in the front matter.
+func inferredArgumentDescription(kind string, fields []string) string {
+	switch kind {
+	case argKindBoolean:
+		return "Flag: true or false"
+	case argKindNumber:
+		return "Number"
+	case argKindIterable:
+		return "JSON array or object"
+	case argKindArray:
+		return "JSON array"
+	case argKindObject:
+		if len(fields) == 0 {
+			return "JSON object"
+		}
+		return "JSON object with fields: " + strings.Join(fields, ", ")
+	}
+	return ""
+}
+
+func promptArgNames(promptArgs []promptArgument) []string {
+	names := make([]string, 0, len(promptArgs))
+	for _, promptArg := range promptArgs {
+		names = append(names, promptArg.name)
+	}
+	return names
+}
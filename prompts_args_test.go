@@ -0,0 +1,452 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type PromptsArgsTestSuite struct {
+	suite.Suite
+}
+
+func TestPromptsArgsTestSuite(t *testing.T) {
+	suite.Run(t, new(PromptsArgsTestSuite))
+}
+
+// TestArgumentSchemaCoerce tests coercion and validation of raw argument values
+func (s *PromptsArgsTestSuite) TestArgumentSchemaCoerce() {
+	intPtr := func(v int) *int { return &v }
+	floatPtr := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name          string
+		schema        ArgumentSchema
+		raw           string
+		expected      interface{}
+		expectedError string
+	}{
+		{
+			name:     "string",
+			schema:   ArgumentSchema{Type: "string"},
+			raw:      "42",
+			expected: "42",
+		},
+		{
+			name:          "string too short",
+			schema:        ArgumentSchema{Type: "string", MinLength: intPtr(3)},
+			raw:           "ab",
+			expectedError: "length must be at least 3",
+		},
+		{
+			name:          "string not matching pattern",
+			schema:        ArgumentSchema{Type: "string", Pattern: "^[a-z]+$"},
+			raw:           "ABC",
+			expectedError: `must match pattern "^[a-z]+$"`,
+		},
+		{
+			name:     "number",
+			schema:   ArgumentSchema{Type: "number"},
+			raw:      "19.99",
+			expected: 19.99,
+		},
+		{
+			name:          "invalid number",
+			schema:        ArgumentSchema{Type: "number"},
+			raw:           "abc",
+			expectedError: `expected number, got "abc"`,
+		},
+		{
+			name:     "integer",
+			schema:   ArgumentSchema{Type: "integer"},
+			raw:      "42",
+			expected: int64(42),
+		},
+		{
+			name:          "integer out of range",
+			schema:        ArgumentSchema{Type: "integer", Minimum: floatPtr(1), Maximum: floatPtr(10)},
+			raw:           "11",
+			expectedError: "must be at most 10",
+		},
+		{
+			name:     "boolean",
+			schema:   ArgumentSchema{Type: "boolean"},
+			raw:      "false",
+			expected: false,
+		},
+		{
+			name:          "invalid boolean",
+			schema:        ArgumentSchema{Type: "boolean"},
+			raw:           "yes",
+			expectedError: `expected boolean, got "yes"`,
+		},
+		{
+			name:     "array",
+			schema:   ArgumentSchema{Type: "array", Items: &ArgumentSchema{Type: "number"}},
+			raw:      "[1, 2]",
+			expected: []interface{}{float64(1), float64(2)},
+		},
+		{
+			name:          "malformed array",
+			schema:        ArgumentSchema{Type: "array"},
+			raw:           "[1,2",
+			expectedError: "expected JSON array",
+		},
+		{
+			name:          "array with invalid items",
+			schema:        ArgumentSchema{Type: "array", Items: &ArgumentSchema{Type: "string"}, MaxItems: intPtr(1)},
+			raw:           `["a", 2]`,
+			expectedError: "must contain at most 1 items, [1]: expected string, got number",
+		},
+		{
+			name:          "object instead of array",
+			schema:        ArgumentSchema{Type: "array"},
+			raw:           `{"a": 1}`,
+			expectedError: "expected array, got object",
+		},
+		{
+			name: "object",
+			schema: ArgumentSchema{Type: "object", Properties: map[string]*ArgumentSchema{
+				"timeout": {Type: "integer"},
+			}},
+			raw:      `{"timeout": 30, "name": "x"}`,
+			expected: map[string]interface{}{"timeout": float64(30), "name": "x"},
+		},
+		{
+			name: "object with invalid property",
+			schema: ArgumentSchema{Type: "object", Properties: map[string]*ArgumentSchema{
+				"timeout": {Type: "integer"},
+			}},
+			raw:           `{"timeout": "30s"}`,
+			expectedError: "timeout: expected integer, got string",
+		},
+		{
+			name:     "enum",
+			schema:   ArgumentSchema{Type: "enum", Enum: []interface{}{"low", "high"}},
+			raw:      "high",
+			expected: "high",
+		},
+		{
+			name:          "value not in enum",
+			schema:        ArgumentSchema{Type: "enum", Enum: []interface{}{"low", "high"}},
+			raw:           "medium",
+			expectedError: "must be one of: low, high",
+		},
+		{
+			name:     "numeric enum",
+			schema:   ArgumentSchema{Type: "integer", Enum: []interface{}{1, 2, 3}},
+			raw:      "2",
+			expected: int64(2),
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			got, err := tt.schema.Coerce(tt.raw)
+			if tt.expectedError != "" {
+				require.Error(s.T(), err, "Coerce() expected error, but got none")
+				assert.Contains(s.T(), err.Error(), tt.expectedError, "Coerce() returned unexpected error")
+				return
+			}
+			require.NoError(s.T(), err, "Coerce() unexpected error")
+			assert.Equal(s.T(), tt.expected, got, "Coerce() returned unexpected value")
+		})
+	}
+}
+
+// TestArgumentSchemaValidate tests validation of the schema declarations
+func (s *PromptsArgsTestSuite) TestArgumentSchemaValidate() {
+	assert.NoError(s.T(), (&ArgumentSchema{}).Validate(), "Validate() unexpected error for empty schema")
+	assert.NoError(s.T(), (&ArgumentSchema{Type: "array", Items: &ArgumentSchema{Type: "string"}}).Validate(),
+		"Validate() unexpected error for array schema")
+	assert.Error(s.T(), (&ArgumentSchema{Type: "text"}).Validate(), "Validate() expected error for unknown type")
+	assert.Error(s.T(), (&ArgumentSchema{Type: "enum"}).Validate(), "Validate() expected error for enum without values")
+	assert.Error(s.T(), (&ArgumentSchema{Type: "string", Pattern: "("}).Validate(), "Validate() expected error for invalid pattern")
+	assert.Error(s.T(), (&ArgumentSchema{Type: "array", Items: &ArgumentSchema{Type: "text"}}).Validate(),
+		"Validate() expected error for invalid items schema")
+}
+
+// TestArgumentSchemaValidateDefault tests validation of default values declared in the front matter
+func (s *PromptsArgsTestSuite) TestArgumentSchemaValidateDefault() {
+	tests := []struct {
+		name          string
+		schema        ArgumentSchema
+		value         interface{}
+		expectedError string
+	}{
+		{name: "no default", schema: ArgumentSchema{Type: "integer"}},
+		{name: "untyped", value: map[string]interface{}{"a": 1}},
+		{name: "integer", schema: ArgumentSchema{Type: "integer"}, value: 5},
+		{name: "integer from string", schema: ArgumentSchema{Type: "integer"}, value: "abc",
+			expectedError: "expected integer, got string"},
+		{name: "enum value", schema: ArgumentSchema{Type: "enum", Enum: []interface{}{"low", "high"}}, value: "low"},
+		{name: "value not in enum", schema: ArgumentSchema{Type: "enum", Enum: []interface{}{"low", "high"}}, value: "medium",
+			expectedError: "must be one of: low, high"},
+		{name: "array items", schema: ArgumentSchema{Type: "array", Items: &ArgumentSchema{Type: "string"}},
+			value: []interface{}{"a", 1}, expectedError: "[1]: expected string, got number"},
+		{name: "object", schema: ArgumentSchema{Type: "object", Properties: map[string]*ArgumentSchema{"n": {Type: "number"}}},
+			value: map[string]interface{}{"n": 1.5}},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			err := tt.schema.ValidateDefault(tt.value)
+			if tt.expectedError != "" {
+				assert.EqualError(s.T(), err, tt.expectedError, "ValidateDefault() returned unexpected error")
+				return
+			}
+			assert.NoError(s.T(), err, "ValidateDefault() unexpected error")
+		})
+	}
+}
+
+// TestArgumentSchemaJSONSchema tests conversion of the argument schema to JSON Schema
+func (s *PromptsArgsTestSuite) TestArgumentSchemaJSONSchema() {
+	minLength, minimum := 3, 1.5
+	tests := []struct {
+		name     string
+		schema   ArgumentSchema
+		expected map[string]interface{}
+	}{
+		{
+			name:     "untyped",
+			schema:   ArgumentSchema{},
+			expected: map[string]interface{}{},
+		},
+		{
+			name:     "string with constraints",
+			schema:   ArgumentSchema{Type: "string", MinLength: &minLength, Pattern: "^[a-z]+$"},
+			expected: map[string]interface{}{"type": "string", "minLength": 3, "pattern": "^[a-z]+$"},
+		},
+		{
+			name:     "enum",
+			schema:   ArgumentSchema{Type: "enum", Enum: []interface{}{"a", "b"}},
+			expected: map[string]interface{}{"type": "string", "enum": []interface{}{"a", "b"}},
+		},
+		{
+			name: "object with nested properties",
+			schema: ArgumentSchema{Type: "object", Properties: map[string]*ArgumentSchema{
+				"timeout": {Type: "number", Minimum: &minimum},
+				"tags":    {Type: "array", Items: &ArgumentSchema{Type: "string"}},
+			}},
+			expected: map[string]interface{}{"type": "object", "properties": map[string]interface{}{
+				"timeout": map[string]interface{}{"type": "number", "minimum": 1.5},
+				"tags":    map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			assert.Equal(s.T(), tt.expected, tt.schema.JSONSchema(), "JSONSchema() returned unexpected schema")
+		})
+	}
+}
+
+// TestParsePromptArgs tests validation of request arguments against prompt arguments
+func (s *PromptsArgsTestSuite) TestParsePromptArgs() {
+	promptArgs := []promptArgument{
+		{name: "name", required: true},
+		{name: "count", required: true, schema: ArgumentSchema{Type: "integer"}},
+		{name: "tags", schema: ArgumentSchema{Type: "array"}},
+		{name: "language", defaultValue: "Go"},
+		{name: "verbose", kind: argKindBoolean},
+		{name: "topic", kind: argKindScalar},
+	}
+
+	s.Run("valid arguments", func() {
+		data := make(map[string]interface{})
+		err := parsePromptArgs(promptArgs, map[string]string{
+			"name": "true", "count": "3", "extra": "42", "verbose": "false", "topic": "42",
+		}, true, data)
+		require.NoError(s.T(), err, "parsePromptArgs() unexpected error")
+		assert.Equal(s.T(), map[string]interface{}{
+			"name":     true,
+			"count":    int64(3),
+			"language": "Go",
+			"extra":    float64(42),
+			"verbose":  false,
+			"topic":    "42",
+		}, data, "parsePromptArgs() returned unexpected data")
+	})
+
+	s.Run("every invalid argument is reported", func() {
+		data := make(map[string]interface{})
+		err := parsePromptArgs(promptArgs, map[string]string{"count": "three", "tags": "[1,2"}, true, data)
+		require.Error(s.T(), err, "parsePromptArgs() expected error, but got none")
+
+		var argsErr *ArgumentsError
+		require.ErrorAs(s.T(), err, &argsErr, "parsePromptArgs() expected ArgumentsError")
+		require.Len(s.T(), argsErr.Errors, 3, "Expected 3 invalid arguments")
+		assert.Equal(s.T(), ArgumentError{Argument: "count", Message: `expected integer, got "three"`}, argsErr.Errors[0])
+		assert.Equal(s.T(), ArgumentError{Argument: "name", Message: "argument is required"}, argsErr.Errors[1])
+		assert.Equal(s.T(), "tags", argsErr.Errors[2].Argument)
+		assert.Contains(s.T(), argsErr.Errors[2].Message, "expected JSON array")
+	})
+}
+
+// TestParseMCPArgs tests parseMCPArgs function functionality
+func (s *PromptsArgsTestSuite) TestParseMCPArgs() {
+	tests := []struct {
+		name           string
+		input          map[string]string
+		enableJSONArgs bool
+		expected       map[string]interface{}
+	}{
+		{
+			name:           "empty arguments with JSON enabled",
+			input:          map[string]string{},
+			enableJSONArgs: true,
+			expected:       map[string]interface{}{},
+		},
+		{
+			name: "string arguments remain strings with JSON enabled",
+			input: map[string]string{
+				"name":    "John",
+				"message": "Hello World",
+			},
+			enableJSONArgs: true,
+			expected: map[string]interface{}{
+				"name":    "John",
+				"message": "Hello World",
+			},
+		},
+		{
+			name: "boolean arguments become booleans with JSON enabled",
+			input: map[string]string{
+				"enabled":  "true",
+				"disabled": "false",
+			},
+			enableJSONArgs: true,
+			expected: map[string]interface{}{
+				"enabled":  true,
+				"disabled": false,
+			},
+		},
+		{
+			name: "number arguments become numbers with JSON enabled",
+			input: map[string]string{
+				"count":   "42",
+				"price":   "19.99",
+				"balance": "-100.5",
+			},
+			enableJSONArgs: true,
+			expected: map[string]interface{}{
+				"count":   float64(42),
+				"price":   19.99,
+				"balance": -100.5,
+			},
+		},
+		{
+			name: "null argument becomes nil with JSON enabled",
+			input: map[string]string{
+				"optional": "null",
+			},
+			enableJSONArgs: true,
+			expected: map[string]interface{}{
+				"optional": nil,
+			},
+		},
+		{
+			name: "array arguments become arrays with JSON enabled",
+			input: map[string]string{
+				"items":   `["apple", "banana", "cherry"]`,
+				"numbers": `[1, 2, 3]`,
+			},
+			enableJSONArgs: true,
+			expected: map[string]interface{}{
+				"items":   []interface{}{"apple", "banana", "cherry"},
+				"numbers": []interface{}{float64(1), float64(2), float64(3)},
+			},
+		},
+		{
+			name: "object arguments become objects with JSON enabled",
+			input: map[string]string{
+				"user": `{"name": "Alice", "age": 30, "active": true}`,
+			},
+			enableJSONArgs: true,
+			expected: map[string]interface{}{
+				"user": map[string]interface{}{
+					"name":   "Alice",
+					"age":    float64(30),
+					"active": true,
+				},
+			},
+		},
+		{
+			name: "invalid JSON remains as strings with JSON enabled",
+			input: map[string]string{
+				"invalid_json": `{name: "Alice"}`,  // Missing quotes around key
+				"incomplete":   `{"name": "Alice"`, // Missing closing brace
+			},
+			enableJSONArgs: true,
+			expected: map[string]interface{}{
+				"invalid_json": `{name: "Alice"}`,
+				"incomplete":   `{"name": "Alice"`,
+			},
+		},
+		{
+			name: "all arguments remain strings when JSON disabled",
+			input: map[string]string{
+				"name":     "John",
+				"enabled":  "true",
+				"count":    "42",
+				"optional": "null",
+				"items":    `["a", "b"]`,
+			},
+			enableJSONArgs: false,
+			expected: map[string]interface{}{
+				"name":     "John",
+				"enabled":  "true",
+				"count":    "42",
+				"optional": "null",
+				"items":    `["a", "b"]`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			data := make(map[string]interface{})
+			parseMCPArgs(tt.input, tt.enableJSONArgs, data)
+			assert.Equal(s.T(), tt.expected, data, "parseMCPArgs() returned unexpected result")
+		})
+	}
+}
+
+// TestParseInferredArg tests parsing of untyped argument values according to the inferred argument kind
+func (s *PromptsArgsTestSuite) TestParseInferredArg() {
+	tests := []struct {
+		name        string
+		kind        string
+		value       string
+		expected    interface{}
+		expectedErr string
+	}{
+		{name: "scalar is kept as string", kind: argKindScalar, value: "42", expected: "42"},
+		{name: "boolean", kind: argKindBoolean, value: "false", expected: false},
+		{name: "boolean-ish string", kind: argKindBoolean, value: "yes", expected: "yes"},
+		{name: "integer", kind: argKindNumber, value: " 3 ", expected: int64(3)},
+		{name: "float", kind: argKindNumber, value: "2.5", expected: 2.5},
+		{name: "not a number", kind: argKindNumber, value: "many", expected: "many"},
+		{name: "array", kind: argKindArray, value: `["a", 1]`, expected: []interface{}{"a", float64(1)}},
+		{name: "invalid array", kind: argKindArray, value: "a, b", expectedErr: "expected JSON array"},
+		{name: "object", kind: argKindObject, value: `{"timeout": 5}`, expected: map[string]interface{}{"timeout": float64(5)}},
+		{name: "iterable array", kind: argKindIterable, value: `[1]`, expected: []interface{}{float64(1)}},
+		{name: "iterable object", kind: argKindIterable, value: `{"a": 1}`, expected: map[string]interface{}{"a": float64(1)}},
+		{name: "iterable of another type", kind: argKindIterable, value: "42", expectedErr: "expected JSON array or object, got number"},
+		{name: "object of another type", kind: argKindObject, value: `"text"`, expectedErr: "expected JSON object, got string"},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			value, err := parseInferredArg(tt.kind, tt.value)
+			if tt.expectedErr != "" {
+				require.Error(s.T(), err, "parseInferredArg() expected error, but got none")
+				assert.Contains(s.T(), err.Error(), tt.expectedErr, "parseInferredArg() returned unexpected error")
+				return
+			}
+			require.NoError(s.T(), err, "parseInferredArg() unexpected error")
+			assert.Equal(s.T(), tt.expected, value, "parseInferredArg() returned unexpected value")
+		})
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// promptSummary is a prompt as listed by the list subcommand.
+type promptSummary struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Arguments   []string `json:"arguments"`
+	Path        string   `json:"path"`
+}
+
+// promptInfo is the full model of a prompt shown by the describe subcommand.
+type promptInfo struct {
+	Name        string         `json:"name"`
+	Title       string         `json:"title,omitempty"`
+	Description string         `json:"description"`
+	Tags        []string       `json:"tags,omitempty"`
+	Path        string         `json:"path"`
+	Arguments   []argumentInfo `json:"arguments"`
+	Partials    []string       `json:"partials"`
+	// EnvArguments are the argument values set by environment variables, which are not exposed to clients
+	EnvArguments map[string]string `json:"envArguments"`
+}
+
+// argumentInfo describes a prompt argument exposed to clients.
+type argumentInfo struct {
+	Name        string      `json:"name"`
+	Required    bool        `json:"required"`
+	Description string      `json:"description,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+	// Type is the type declared in the front matter
+	Type string `json:"type,omitempty"`
+	// Kind is the kind inferred from the template for untyped arguments parsed as JSON
+	Kind   string                 `json:"kind,omitempty"`
+	Schema map[string]interface{} `json:"schema,omitempty"`
+}
+
+// newPromptSummary returns the summary of the prompt. Optional arguments are enclosed in square brackets.
+func newPromptSummary(prompt loadedPrompt) promptSummary {
+	args := make([]string, 0, len(prompt.args))
+	for _, promptArg := range prompt.args {
+		if promptArg.required {
+			args = append(args, promptArg.name)
+		} else {
+			args = append(args, "["+promptArg.name+"]")
+		}
+	}
+	return promptSummary{
+		Name:        prompt.Prompt.Name,
+		Description: prompt.Prompt.Description,
+		Arguments:   args,
+		Path:        prompt.path,
+	}
+}
+
+// newPromptInfo returns the full model of the prompt. Inferred kinds are reported only if JSON arguments
+// are enabled, since otherwise all untyped arguments are passed to the template as strings.
+func newPromptInfo(prompt loadedPrompt, enableJSONArgs bool) promptInfo {
+	info := promptInfo{
+		Name:         prompt.Prompt.Name,
+		Title:        prompt.metadata.Title,
+		Description:  prompt.Prompt.Description,
+		Tags:         prompt.metadata.Tags,
+		Path:         prompt.path,
+		Arguments:    make([]argumentInfo, 0, len(prompt.args)),
+		Partials:     prompt.partials,
+		EnvArguments: prompt.envArgs,
+	}
+	if info.Partials == nil {
+		info.Partials = []string{}
+	}
+	for _, promptArg := range prompt.args {
+		argInfo := argumentInfo{
+			Name:        promptArg.name,
+			Required:    promptArg.required,
+			Description: promptArg.description,
+			Default:     promptArg.defaultValue,
+			Type:        promptArg.schema.Type,
+		}
+		if promptArg.schema.IsTyped() {
+			argInfo.Schema = promptArg.schema.JSONSchema()
+		} else if enableJSONArgs {
+			argInfo.Kind = promptArg.kind
+		}
+		info.Arguments = append(info.Arguments, argInfo)
+	}
+	return info
+}
+
+// typeName returns the declared type of the argument, including enum values, or the inferred kind.
+// Arguments of unknown kind are passed as strings.
+func (a argumentInfo) typeName() string {
+	switch {
+	case a.Type == argTypeEnum:
+		var values []string
+		if enumValues, ok := a.Schema["enum"].([]interface{}); ok {
+			for _, value := range enumValues {
+				values = append(values, fmt.Sprint(value))
+			}
+		}
+		return argTypeEnum + " (" + strings.Join(values, ", ") + ")"
+	case a.Type != "":
+		return a.Type
+	case a.Kind != "" && a.Kind != argKindScalar:
+		return a.Kind + " (inferred)"
+	default:
+		return argTypeString
+	}
+}
+
+// writePromptList writes the summaries of the prompts in the output format.
+func writePromptList(w io.Writer, summaries []promptSummary, format string) error {
+	switch format {
+	case outputFormatJSON:
+		return writeJSON(w, summaries)
+	case outputFormatMarkdown:
+		rows := make([][]string, 0, len(summaries))
+		for _, summary := range summaries {
+			rows = append(rows, []string{
+				summary.Name, summary.Description, strings.Join(summary.Arguments, ", "), summary.Path,
+			})
+		}
+		return writeMarkdownTable(w, []string{"Name", "Description", "Arguments", "Source"}, rows)
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "NAME\tDESCRIPTION\tARGUMENTS\tSOURCE")
+		for _, summary := range summaries {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", summary.Name, singleLine(summary.Description),
+				strings.Join(summary.Arguments, ", "), summary.Path)
+		}
+		return tw.Flush()
+	}
+}
+
+// writePromptInfo writes the full model of the prompt in the output format.
+func writePromptInfo(w io.Writer, info promptInfo, format string) error {
+	switch format {
+	case outputFormatJSON:
+		return writeJSON(w, info)
+	case outputFormatMarkdown:
+		return writePromptInfoMarkdown(w, info)
+	default:
+		return writePromptInfoTable(w, info)
+	}
+}
+
+func writePromptInfoTable(w io.Writer, info promptInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "Name:\t%s\n", info.Name)
+	if info.Title != "" {
+		_, _ = fmt.Fprintf(tw, "Title:\t%s\n", info.Title)
+	}
+	_, _ = fmt.Fprintf(tw, "Description:\t%s\n", singleLine(info.Description))
+	if len(info.Tags) != 0 {
+		_, _ = fmt.Fprintf(tw, "Tags:\t%s\n", strings.Join(info.Tags, ", "))
+	}
+	_, _ = fmt.Fprintf(tw, "Source:\t%s\n", info.Path)
+	_, _ = fmt.Fprintf(tw, "Partials:\t%s\n", listOrNone(info.Partials))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintln(w, "\nArguments:")
+	if len(info.Arguments) == 0 {
+		_, _ = fmt.Fprintln(w, "  none")
+	} else {
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "  NAME\tREQUIRED\tTYPE\tDEFAULT\tDESCRIPTION")
+		for _, arg := range info.Arguments {
+			_, _ = fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n", arg.Name, yesNo(arg.Required), arg.typeName(),
+				formatArgumentValue(arg.Default), singleLine(arg.Description))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	_, _ = fmt.Fprintln(w, "\nEnvironment:")
+	if len(info.EnvArguments) == 0 {
+		_, err := fmt.Fprintln(w, "  none")
+		return err
+	}
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "  NAME\tVARIABLE\tVALUE")
+	for _, name := range sortedMapKeys(info.EnvArguments) {
+		_, _ = fmt.Fprintf(tw, "  %s\t%s\t%s\n", name, strings.ToUpper(name), singleLine(info.EnvArguments[name]))
+	}
+	return tw.Flush()
+}
+
+func writePromptInfoMarkdown(w io.Writer, info promptInfo) error {
+	_, _ = fmt.Fprintf(w, "# %s\n\n", info.Name)
+	if info.Description != "" {
+		_, _ = fmt.Fprintf(w, "%s\n\n", info.Description)
+	}
+	if info.Title != "" {
+		_, _ = fmt.Fprintf(w, "- **Title:** %s\n", info.Title)
+	}
+	if len(info.Tags) != 0 {
+		_, _ = fmt.Fprintf(w, "- **Tags:** %s\n", strings.Join(info.Tags, ", "))
+	}
+	_, _ = fmt.Fprintf(w, "- **Source:** `%s`\n", info.Path)
+	partials := make([]string, 0, len(info.Partials))
+	for _, partial := range info.Partials {
+		partials = append(partials, "`"+partial+"`")
+	}
+	_, _ = fmt.Fprintf(w, "- **Partials:** %s\n", listOrNone(partials))
+
+	_, _ = fmt.Fprint(w, "\n## Arguments\n\n")
+	if len(info.Arguments) == 0 {
+		_, _ = fmt.Fprintln(w, "None.")
+	} else {
+		rows := make([][]string, 0, len(info.Arguments))
+		for _, arg := range info.Arguments {
+			rows = append(rows, []string{
+				arg.Name, yesNo(arg.Required), arg.typeName(), formatArgumentValue(arg.Default), arg.Description,
+			})
+		}
+		if err := writeMarkdownTable(w, []string{"Name", "Required", "Type", "Default", "Description"}, rows); err != nil {
+			return err
+		}
+	}
+
+	_, _ = fmt.Fprint(w, "\n## Environment\n\n")
+	if len(info.EnvArguments) == 0 {
+		_, err := fmt.Fprintln(w, "None.")
+		return err
+	}
+	rows := make([][]string, 0, len(info.EnvArguments))
+	for _, name := range sortedMapKeys(info.EnvArguments) {
+		rows = append(rows, []string{name, strings.ToUpper(name), info.EnvArguments[name]})
+	}
+	return writeMarkdownTable(w, []string{"Name", "Variable", "Value"}, rows)
+}
+
+// writeMarkdownTable writes a Markdown table, escaping pipes and line breaks in the cells.
+func writeMarkdownTable(w io.Writer, header []string, rows [][]string) error {
+	cellReplacer := strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>")
+	writeRow := func(cells []string) error {
+		escaped := make([]string, 0, len(cells))
+		for _, cell := range cells {
+			escaped = append(escaped, cellReplacer.Replace(cell))
+		}
+		_, err := fmt.Fprintf(w, "| %s |\n", strings.Join(escaped, " | "))
+		return err
+	}
+	if err := writeRow(header); err != nil {
+		return err
+	}
+	separator := make([]string, 0, len(header))
+	for range header {
+		separator = append(separator, "---")
+	}
+	if err := writeRow(separator); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writeRow(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeJSON writes the value as indented JSON.
+func writeJSON(w io.Writer, value interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(value)
+}
+
+// formatArgumentValue formats the argument value as it would be passed by a client:
+// strings as is and other values as JSON.
+func formatArgumentValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if str, isStr := value.(string); isStr {
+		return str
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+func sortedMapKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func listOrNone(values []string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	return strings.Join(values, ", ")
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
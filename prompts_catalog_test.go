@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPromptCatalog tests the prompt models shown by the list and describe subcommands
+func (s *PromptsServerTestSuite) TestPromptCatalog() {
+	promptsDir := filepath.Join(s.tempDir, "prompts")
+	require.NoError(s.T(), os.Mkdir(promptsDir, 0755), "Failed to create directory")
+	err := os.WriteFile(filepath.Join(promptsDir, "report.tmpl"), []byte(`---
+title: Report
+description: Status report
+tags: [status, team]
+arguments:
+  - name: format
+    type: enum
+    enum: [text, markdown]
+    default: text
+  - name: team
+    description: Team name
+---
+{{template "_header" .}}{{range .items}}- {{.}}{{end}}{{if .verbose}}Verbose{{end}} by {{.report_author}}`), 0644)
+	require.NoError(s.T(), err, "Failed to write prompt file")
+	err = os.WriteFile(filepath.Join(promptsDir, "_header.tmpl"), []byte(`{{define "_header"}}# {{.team}} ({{.format}}){{end}}`), 0644)
+	require.NoError(s.T(), err, "Failed to write partial file")
+	s.T().Setenv("REPORT_AUTHOR", "Alice")
+
+	prompts, templateErrs, err := newOfflinePromptsServer([]string{promptsDir}, true).loadServerPrompts()
+	require.NoError(s.T(), err, "loadServerPrompts() unexpected error")
+	require.Empty(s.T(), templateErrs, "Unexpected template errors")
+	require.Len(s.T(), prompts, 1, "Expected exactly 1 prompt")
+
+	assert.Equal(s.T(), promptSummary{
+		Name:        "report",
+		Description: "Status report",
+		Arguments:   []string{"[format]", "items", "team", "[verbose]"},
+		Path:        filepath.Join(promptsDir, "report.tmpl"),
+	}, newPromptSummary(prompts[0]), "Unexpected prompt summary")
+
+	info := newPromptInfo(prompts[0], true)
+	infoJSON, err := json.Marshal(info)
+	require.NoError(s.T(), err, "Failed to marshal prompt info")
+	pathJSON, err := json.Marshal(filepath.Join(promptsDir, "report.tmpl"))
+	require.NoError(s.T(), err, "Failed to marshal path")
+	assert.JSONEq(s.T(), `{
+		"name": "report",
+		"title": "Report",
+		"description": "Status report",
+		"tags": ["status", "team"],
+		"path": `+string(pathJSON)+`,
+		"arguments": [
+			{"name": "format", "required": false, "default": "text", "type": "enum",
+				"schema": {"type": "string", "enum": ["text", "markdown"]}},
+			{"name": "items", "required": true, "description": "JSON array or object", "kind": "iterable"},
+			{"name": "team", "required": true, "description": "Team name", "kind": "scalar"},
+			{"name": "verbose", "required": false, "description": "Flag: true or false", "kind": "boolean"}
+		],
+		"partials": ["_header"],
+		"envArguments": {"report_author": "Alice"}
+	}`, string(infoJSON), "Unexpected prompt info")
+
+	var buf bytes.Buffer
+	require.NoError(s.T(), writePromptInfo(&buf, info, outputFormatTable), "writePromptInfo() unexpected error")
+	for _, expected := range []string{
+		"Title:        Report\n",
+		"Tags:         status, team\n",
+		"Partials:     _header\n",
+		"  format   no        enum (text, markdown)  text",
+		"  items    yes       iterable (inferred)",
+		"  report_author  REPORT_AUTHOR  Alice",
+	} {
+		assert.Contains(s.T(), buf.String(), expected, "Unexpected table output")
+	}
+
+	buf.Reset()
+	require.NoError(s.T(), writePromptInfo(&buf, info, outputFormatMarkdown), "writePromptInfo() unexpected error")
+	for _, expected := range []string{
+		"# report\n\nStatus report\n\n",
+		"- **Partials:** `_header`\n",
+		"| format | no | enum (text, markdown) | text |  |\n",
+		"| report_author | REPORT_AUTHOR | Alice |\n",
+	} {
+		assert.Contains(s.T(), buf.String(), expected, "Unexpected Markdown output")
+	}
+}
+
+// TestWriteMarkdownTable tests escaping of Markdown table cells
+func (s *PromptsServerTestSuite) TestWriteMarkdownTable() {
+	var buf bytes.Buffer
+	require.NoError(s.T(), writeMarkdownTable(&buf, []string{"A", "B"}, [][]string{{"x|y", "line1\nline2"}}))
+	assert.Equal(s.T(), "| A | B |\n| --- | --- |\n| x\\|y | line1<br>line2 |\n", buf.String())
+}
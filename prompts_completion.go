@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	// maxCompletionValues is the maximum number of values in a completion response allowed by MCP.
+	maxCompletionValues = 100
+	// maxHistoryValues is the number of the most recently used values remembered for every prompt argument.
+	maxHistoryValues = 20
+	// maxHistoryValueLength excludes long values, such as pasted code, from the history.
+	maxHistoryValueLength = 256
+)
+
+// argumentHistory remembers the most recently used values of prompt arguments. Values are kept per client session,
+// so values typed by one client are never suggested to another one.
+type argumentHistory struct {
+	mu sync.Mutex
+	// sessions maps session IDs to the values keyed by prompt and argument name
+	sessions map[string]map[string][]string
+}
+
+func newArgumentHistory() *argumentHistory {
+	return &argumentHistory{sessions: make(map[string]map[string][]string)}
+}
+
+func argumentHistoryKey(promptName, argName string) string {
+	return promptName + "\x00" + argName
+}
+
+// sessionID returns the ID of the client session of the request, or an empty string if there is no session.
+func sessionID(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+// Record adds the argument values used in the prompt request of the session to the history.
+// Empty, multi-line and long values are not recorded.
+func (h *argumentHistory) Record(sessionID, promptName string, args map[string]string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sessionValues := h.sessions[sessionID]
+	if sessionValues == nil {
+		sessionValues = make(map[string][]string)
+		h.sessions[sessionID] = sessionValues
+	}
+	for argName, value := range args {
+		if value == "" || len(value) > maxHistoryValueLength || strings.ContainsAny(value, "\r\n") {
+			continue
+		}
+		key := argumentHistoryKey(promptName, argName)
+		values := []string{value}
+		for _, oldValue := range sessionValues[key] {
+			if oldValue != value && len(values) < maxHistoryValues {
+				values = append(values, oldValue)
+			}
+		}
+		sessionValues[key] = values
+	}
+}
+
+// Values returns values of the prompt argument previously used in the session, the most recent first.
+func (h *argumentHistory) Values(sessionID, promptName, argName string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.sessions[sessionID][argumentHistoryKey(promptName, argName)]...)
+}
+
+// Forget removes the values used in the session, e.g. when the client disconnects.
+func (h *argumentHistory) Forget(sessionID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.sessions, sessionID)
+}
+
+// CompletePromptArgument suggests values of the prompt argument that start with the typed value.
+// Suggestions come from values previously used in the same session, declared enum values and, for path arguments,
+// files in the prompts directories and the include roots.
+func (ps *PromptsServer) CompletePromptArgument(
+	ctx context.Context, promptName string, argument mcp.CompleteArgument, completeCtx mcp.CompleteContext,
+) (*mcp.Completion, error) {
+	ps.mu.RLock()
+	prompt, ok := ps.prompts[promptName]
+	ps.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("prompt %q not found", promptName)
+	}
+	var promptArg *promptArgument
+	for i := range prompt.args {
+		if prompt.args[i].name == argument.Name {
+			promptArg = &prompt.args[i]
+			break
+		}
+	}
+	if promptArg == nil {
+		return &mcp.Completion{Values: []string{}}, nil
+	}
+
+	var candidates []string
+	candidates = append(candidates, ps.argHistory.Values(sessionID(ctx), promptName, argument.Name)...)
+	candidates = append(candidates, promptArg.schema.completionValues()...)
+	values := filterCompletionValues(candidates, argument.Value)
+	if promptArg.schema.Type == argTypePath {
+		pathValues, err := ps.files.completePath(argument.Value)
+		if err != nil {
+			ps.logger.Error("Failed to complete path", "prompt", promptName, "argument", argument.Name, "error", err)
+		}
+		values = filterCompletionValues(append(values, pathValues...), argument.Value)
+	}
+
+	completion := &mcp.Completion{Values: values, Total: len(values)}
+	if len(values) > maxCompletionValues {
+		completion.Values = values[:maxCompletionValues]
+		completion.HasMore = true
+	}
+	return completion, nil
+}
+
+// completionValues returns the values declared by the schema.
+func (s *ArgumentSchema) completionValues() []string {
+	if s.Type == argTypeBoolean {
+		return []string{"true", "false"}
+	}
+	values := make([]string, 0, len(s.Enum))
+	for _, enumValue := range s.Enum {
+		values = append(values, fmt.Sprint(enumValue))
+	}
+	return values
+}
+
+// filterCompletionValues returns unique values that start with the prefix, ignoring case, in the original order.
+func filterCompletionValues(values []string, prefix string) []string {
+	lowerPrefix := strings.ToLower(prefix)
+	seen := make(map[string]struct{}, len(values))
+	filtered := make([]string, 0, len(values))
+	for _, value := range values {
+		if _, exists := seen[value]; exists || !strings.HasPrefix(strings.ToLower(value), lowerPrefix) {
+			continue
+		}
+		seen[value] = struct{}{}
+		filtered = append(filtered, value)
+	}
+	return filtered
+}
+
+// completePath returns entries of the directory of the typed path whose names start with its last element.
+// Only directories inside the allowed roots are listed: relative paths are looked up in the roots as by readFile,
+// and absolute paths must be inside one of them. Directories are suffixed with a separator, symlinks pointing
+// outside the roots are skipped, and hidden entries are suggested only if the typed name starts with a dot.
+func (fi *fileIncluder) completePath(typed string) ([]string, error) {
+	if fi == nil || len(fi.roots) == 0 {
+		return nil, nil
+	}
+	dir, namePrefix := filepath.Split(typed)
+	var readDirs []string
+	if filepath.IsAbs(typed) {
+		readDirs = []string{dir}
+	} else {
+		for _, root := range fi.lookupRoots {
+			readDirs = append(readDirs, filepath.Join(root, dir))
+		}
+	}
+
+	var paths []string
+	seen := make(map[string]struct{})
+	for _, readDir := range readDirs {
+		// Missing directories, files and directories outside the roots are skipped
+		resolved, err := fi.checkPath(dir, readDir)
+		if err != nil {
+			continue
+		}
+		if info, statErr := os.Stat(resolved); statErr != nil || !info.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(readDir)
+		if err != nil {
+			return nil, fmt.Errorf("read directory %q: %w", readDir, err)
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !strings.HasPrefix(name, namePrefix) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(namePrefix, ".")) {
+				continue
+			}
+			if entry.Type()&os.ModeSymlink != 0 {
+				if _, err = fi.checkPath(name, filepath.Join(readDir, name)); err != nil {
+					continue
+				}
+			}
+			entryPath := dir + name
+			if entry.IsDir() {
+				entryPath += string(filepath.Separator)
+			}
+			if _, exists := seen[entryPath]; !exists {
+				seen[entryPath] = struct{}{}
+				paths = append(paths, entryPath)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
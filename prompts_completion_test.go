@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestArgumentHistory tests recording of previously used argument values
+func (s *PromptsServerTestSuite) TestArgumentHistory() {
+	history := newArgumentHistory()
+	history.Record("s1", "review", map[string]string{"language": "Go", "code": "line1\nline2", "empty": ""})
+	history.Record("s1", "review", map[string]string{"language": "Python"})
+	history.Record("s1", "review", map[string]string{"language": "Go"})
+	history.Record("s1", "other", map[string]string{"language": "Rust"})
+	history.Record("s2", "review", map[string]string{"language": "Java"})
+
+	assert.Equal(s.T(), []string{"Go", "Python"}, history.Values("s1", "review", "language"),
+		"Values should be unique and ordered from the most recent")
+	assert.Empty(s.T(), history.Values("s1", "review", "code"), "Multi-line values should not be recorded")
+	assert.Empty(s.T(), history.Values("s1", "review", "empty"), "Empty values should not be recorded")
+	assert.Equal(s.T(), []string{"Rust"}, history.Values("s1", "other", "language"), "History should be kept per prompt")
+	assert.Equal(s.T(), []string{"Java"}, history.Values("s2", "review", "language"), "History should be kept per session")
+	assert.Empty(s.T(), history.Values("s3", "review", "language"), "Unknown session should have no history")
+
+	for i := 0; i < maxHistoryValues+5; i++ {
+		history.Record("s1", "review", map[string]string{"language": fmt.Sprintf("lang%d", i)})
+	}
+	values := history.Values("s1", "review", "language")
+	assert.Len(s.T(), values, maxHistoryValues, "History should be limited")
+	assert.Equal(s.T(), fmt.Sprintf("lang%d", maxHistoryValues+4), values[0], "Most recent value should be first")
+
+	history.Forget("s1")
+	assert.Empty(s.T(), history.Values("s1", "review", "language"), "Forgotten session should have no history")
+	assert.Equal(s.T(), []string{"Java"}, history.Values("s2", "review", "language"), "Other sessions should be kept")
+}
+
+// TestCompletePath tests completion of paths in the allowed roots
+func (s *PromptsServerTestSuite) TestCompletePath() {
+	promptsDir := filepath.Join(s.tempDir, "prompts")
+	srcDir := filepath.Join(s.tempDir, "src")
+	outsideDir := filepath.Join(s.tempDir, "outside")
+	for _, dir := range []string{promptsDir, srcDir, filepath.Join(srcDir, "mcp"), outsideDir} {
+		require.NoError(s.T(), os.Mkdir(dir, 0755), "Failed to create directory")
+	}
+	for _, name := range []string{
+		filepath.Join(promptsDir, "review.tmpl"),
+		filepath.Join(srcDir, "main.go"),
+		filepath.Join(srcDir, "main_test.go"),
+		filepath.Join(srcDir, "model.go"),
+		filepath.Join(srcDir, ".hidden"),
+		filepath.Join(outsideDir, "secret.txt"),
+	} {
+		require.NoError(s.T(), os.WriteFile(name, nil, 0644), "Failed to write test file")
+	}
+	require.NoError(s.T(), os.Symlink(outsideDir, filepath.Join(srcDir, "mlink")), "Failed to create symlink")
+	files := newFileIncluder([]string{promptsDir}, []string{srcDir}, 0)
+	sep := string(filepath.Separator)
+	dir := srcDir + sep
+
+	tests := []struct {
+		name     string
+		typed    string
+		expected []string
+	}{
+		{name: "roots", typed: "", expected: []string{"main.go", "main_test.go", "mcp" + sep, "model.go", "review.tmpl"}},
+		{name: "relative name prefix", typed: "ma", expected: []string{"main.go", "main_test.go"}},
+		{name: "relative directory", typed: "mcp" + sep, expected: nil},
+		{name: "absolute directory", typed: dir, expected: []string{dir + "main.go", dir + "main_test.go", dir + "mcp" + sep, dir + "model.go"}},
+		{name: "absolute name prefix", typed: dir + "ma", expected: []string{dir + "main.go", dir + "main_test.go"}},
+		{name: "directories are suffixed", typed: dir + "mc", expected: []string{dir + "mcp" + sep}},
+		{name: "hidden files", typed: dir + ".h", expected: []string{dir + ".hidden"}},
+		{name: "no matches", typed: dir + "x", expected: nil},
+		{name: "missing directory", typed: dir + "missing" + sep + "x", expected: nil},
+		{name: "file as directory", typed: dir + "main.go" + sep, expected: nil},
+		{name: "absolute path outside roots", typed: outsideDir + sep, expected: nil},
+		{name: "parent of roots", typed: s.tempDir + sep, expected: nil},
+		{name: "relative path outside roots", typed: ".." + sep + "outside" + sep, expected: nil},
+		{name: "symlink outside roots", typed: "mlink" + sep, expected: nil},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			paths, err := files.completePath(tt.typed)
+			require.NoError(s.T(), err, "completePath() unexpected error")
+			assert.Equal(s.T(), tt.expected, paths, "completePath() returned unexpected paths")
+		})
+	}
+
+	paths, err := noFileAccess.completePath("")
+	require.NoError(s.T(), err, "completePath() unexpected error")
+	assert.Empty(s.T(), paths, "Nothing should be completed without allowed roots")
+}
+
+// TestCompletionHistoryPerSession tests that values used in one session are not suggested in other sessions
+func (s *PromptsServerTestSuite) TestCompletionHistoryPerSession() {
+	ctx := context.Background()
+	err := os.WriteFile(filepath.Join(s.tempDir, "triage.tmpl"), []byte(`Triage for {{.team}}`), 0644)
+	require.NoError(s.T(), err, "Failed to write prompt file")
+	promptsServer, err := NewPromptsServer([]string{s.tempDir}, true, s.logger)
+	require.NoError(s.T(), err, "Failed to create prompts server")
+	defer func() { _ = promptsServer.Close() }()
+
+	sessionA := server.NewInProcessSession("a", nil)
+	sessionB := server.NewInProcessSession("b", nil)
+	require.NoError(s.T(), promptsServer.mcpServer.RegisterSession(ctx, sessionA), "Failed to register session")
+	require.NoError(s.T(), promptsServer.mcpServer.RegisterSession(ctx, sessionB), "Failed to register session")
+	ctxA := promptsServer.mcpServer.WithContext(ctx, sessionA)
+	ctxB := promptsServer.mcpServer.WithContext(ctx, sessionB)
+	complete := func(ctx context.Context) []string {
+		completion, err := promptsServer.CompletePromptArgument(ctx, "triage", mcp.CompleteArgument{Name: "team"}, mcp.CompleteContext{})
+		require.NoError(s.T(), err, "CompletePromptArgument failed")
+		return completion.Values
+	}
+
+	var getReq mcp.GetPromptRequest
+	getReq.Params.Name = "triage"
+	getReq.Params.Arguments = map[string]string{"team": "platform"}
+	_, err = promptsServer.handleGetPrompt(ctxA, getReq)
+	require.NoError(s.T(), err, "handleGetPrompt failed")
+
+	assert.Equal(s.T(), []string{"platform"}, complete(ctxA), "History should be suggested in the same session")
+	assert.Empty(s.T(), complete(ctxB), "History should not be suggested in other sessions")
+
+	promptsServer.mcpServer.UnregisterSession(ctx, sessionA.SessionID())
+	assert.Empty(s.T(), promptsServer.argHistory.Values("a", "triage", "team"),
+		"History should be forgotten when the session is unregistered")
+}
+
+// TestServeStdioWithCompletion tests completion of prompt argument values
+func (s *PromptsServerTestSuite) TestServeStdioWithCompletion() {
+	ctx := context.Background()
+
+	srcDir := filepath.Join(s.tempDir, "src")
+	require.NoError(s.T(), os.Mkdir(srcDir, 0755), "Failed to create directory")
+	for _, name := range []string{"handler.go", "helper.go", "server.go"} {
+		require.NoError(s.T(), os.WriteFile(filepath.Join(srcDir, name), nil, 0644), "Failed to write test file")
+	}
+	promptsDir := filepath.Join(s.tempDir, "prompts")
+	require.NoError(s.T(), os.Mkdir(promptsDir, 0755), "Failed to create directory")
+	err := os.WriteFile(filepath.Join(promptsDir, "triage.tmpl"), []byte(`---
+arguments:
+  - name: urgency_level
+    type: enum
+    enum: [low, medium, high, highest]
+  - name: file
+    type: path
+  - name: notify
+    type: boolean
+---
+Triage {{.file}} with {{.urgency_level}} urgency for {{.team}}{{if .notify}}, notify{{end}}`), 0644)
+	require.NoError(s.T(), err, "Failed to write prompt file")
+
+	_, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, promptsDir, true, WithIncludeRoots(srcDir))
+	defer promptsClose()
+
+	complete := func(argName, value string) []string {
+		return s.completePromptArgument(ctx, mcpClient, "triage", argName, value)
+	}
+
+	assert.Equal(s.T(), []string{"high", "highest"}, complete("urgency_level", "H"), "Enum values should be filtered by prefix")
+	assert.Equal(s.T(), []string{"low", "medium", "high", "highest"}, complete("urgency_level", ""),
+		"All enum values should be suggested for empty value")
+	assert.Equal(s.T(), []string{"true", "false"}, complete("notify", ""), "Boolean values should be suggested")
+	sep := string(filepath.Separator)
+	assert.Equal(s.T(), []string{srcDir + sep + "handler.go", srcDir + sep + "helper.go"}, complete("file", srcDir+sep+"h"),
+		"Paths should be suggested for path arguments")
+	assert.Equal(s.T(), []string{"triage.tmpl"}, complete("file", "tr"), "Relative paths should be completed in the roots")
+	assert.Empty(s.T(), complete("file", s.tempDir+sep), "Paths outside the roots should not be suggested")
+	assert.Empty(s.T(), complete("team", ""), "Nothing should be suggested for untyped argument without history")
+	assert.Empty(s.T(), complete("unknown", ""), "Nothing should be suggested for unknown argument")
+
+	// Used values are suggested first
+	var getReq mcp.GetPromptRequest
+	getReq.Params.Name = "triage"
+	getReq.Params.Arguments = map[string]string{"urgency_level": "highest", "team": "platform", "file": "main.go"}
+	_, err = mcpClient.GetPrompt(ctx, getReq)
+	require.NoError(s.T(), err, "GetPrompt failed")
+	getReq.Params.Arguments = map[string]string{"urgency_level": "low", "team": "payments", "file": "main.go"}
+	_, err = mcpClient.GetPrompt(ctx, getReq)
+	require.NoError(s.T(), err, "GetPrompt failed")
+
+	assert.Equal(s.T(), []string{"payments", "platform"}, complete("team", "p"), "History should be suggested")
+	assert.Equal(s.T(), []string{"highest", "high"}, complete("urgency_level", "hi"),
+		"History should be suggested before enum values")
+	assert.Equal(s.T(), []string{"low", "highest", "medium", "high"}, complete("urgency_level", ""),
+		"Values should not be duplicated")
+
+	// Values that failed validation are not remembered
+	getReq.Params.Arguments = map[string]string{"urgency_level": "urgent", "team": "pricing", "file": "main.go"}
+	_, err = mcpClient.GetPrompt(ctx, getReq)
+	require.Error(s.T(), err, "Expected error for invalid argument")
+	assert.Equal(s.T(), []string{"payments", "platform"}, complete("team", "p"), "Failed request should not be recorded")
+
+	var completeReq mcp.CompleteRequest
+	completeReq.Params.Ref = mcp.PromptReference{Type: "ref/prompt", Name: "missing"}
+	completeReq.Params.Argument = mcp.CompleteArgument{Name: "team"}
+	_, err = mcpClient.Complete(ctx, completeReq)
+	assert.Error(s.T(), err, "Expected error for unknown prompt")
+}
+
+func (s *PromptsServerTestSuite) completePromptArgument(
+	ctx context.Context, mcpClient *client.Client, promptName, argName, value string,
+) []string {
+	var completeReq mcp.CompleteRequest
+	completeReq.Params.Ref = mcp.PromptReference{Type: "ref/prompt", Name: promptName}
+	completeReq.Params.Argument = mcp.CompleteArgument{Name: argName, Value: value}
+	result, err := mcpClient.Complete(ctx, completeReq)
+	require.NoError(s.T(), err, "Complete failed for %q argument", argName)
+	return result.Completion.Values
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultExecTimeout is the default limit of the run time of a command executed by a template.
+	defaultExecTimeout = 10 * time.Second
+	// defaultExecMaxOutput is the default limit of the size of the output of a command executed by a template.
+	defaultExecMaxOutput = 1 << 20
+	// execWaitDelay is how long to wait for the output of a killed command, e.g. if its children keep it open.
+	execWaitDelay = time.Second
+)
+
+// errExecNotEnabled is returned by the exec function of templates rendered without allowed commands.
+var errExecNotEnabled = errors.New("command execution is not enabled, allow commands with -exec-allow")
+
+// noExec provides the exec function of templateFuncs, which fails until it is bound to a configured commandExecutor.
+var noExec *commandExecutor
+
+// commandExecutor implements the exec template function. Commands are run directly, without a shell,
+// and only if they start with one of the allowed command lines followed by operands only, e.g. "git diff" allows
+// "git diff main.go" but not "git push" or "git diff --output=file". Every executed or denied command is logged
+// for auditing.
+type commandExecutor struct {
+	allowed   [][]string
+	timeout   time.Duration
+	maxOutput int
+	dir       string
+	logger    *slog.Logger
+}
+
+// WithExecAllow enables the exec template function for the command lines. A command is allowed if its name
+// and leading arguments match one of the command lines and none of the remaining arguments starts with "-".
+// Arguments of exec may come from prompt arguments, i.e. from clients, and an option appended to an allowed
+// command can change what it does, e.g. "--output=file" makes "git diff" write a file. Options a command may be
+// run with must be listed in its command line, e.g. "git diff --staged".
+func WithExecAllow(commands ...string) PromptsServerOption {
+	return func(ps *PromptsServer) {
+		ps.execAllow = append(ps.execAllow, commands...)
+	}
+}
+
+// WithExecTimeout sets the limit of the run time of a command executed by a template.
+func WithExecTimeout(timeout time.Duration) PromptsServerOption {
+	return func(ps *PromptsServer) {
+		ps.execTimeout = timeout
+	}
+}
+
+// WithExecMaxOutput sets the limit of the size of the output of a command executed by a template.
+func WithExecMaxOutput(size int) PromptsServerOption {
+	return func(ps *PromptsServer) {
+		ps.execMaxOutput = size
+	}
+}
+
+// WithExecDir sets the working directory of commands executed by templates.
+func WithExecDir(dir string) PromptsServerOption {
+	return func(ps *PromptsServer) {
+		ps.execDir = dir
+	}
+}
+
+// newCommandExecutor returns a commandExecutor for the allowed command lines, or nil if no commands are allowed.
+// Non-positive timeout and maxOutput mean defaultExecTimeout and defaultExecMaxOutput, and an empty dir means
+// the current working directory.
+func newCommandExecutor(
+	allowed []string, timeout time.Duration, maxOutput int, dir string, logger *slog.Logger,
+) *commandExecutor {
+	ce := &commandExecutor{timeout: timeout, maxOutput: maxOutput, dir: dir, logger: logger}
+	for _, commandLine := range allowed {
+		if fields := strings.Fields(commandLine); len(fields) != 0 {
+			ce.allowed = append(ce.allowed, fields)
+		}
+	}
+	if len(ce.allowed) == 0 {
+		return nil
+	}
+	if ce.timeout <= 0 {
+		ce.timeout = defaultExecTimeout
+	}
+	if ce.maxOutput <= 0 {
+		ce.maxOutput = defaultExecMaxOutput
+	}
+	return ce
+}
+
+// isAllowed reports whether the command line starts with one of the allowed command lines and its other arguments
+// are not options, i.e. do not start with "-".
+func (ce *commandExecutor) isAllowed(commandLine []string) bool {
+	for _, allowed := range ce.allowed {
+		if len(commandLine) < len(allowed) {
+			continue
+		}
+		matches := true
+		for i, field := range allowed {
+			if commandLine[i] != field {
+				matches = false
+				break
+			}
+		}
+		for _, arg := range commandLine[len(allowed):] {
+			if strings.HasPrefix(arg, "-") {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// exec is the exec function of templates rendered without allowed commands.
+func (ce *commandExecutor) exec(name string, args ...interface{}) (string, error) {
+	return "", errExecNotEnabled
+}
+
+// bind returns the exec function of the template of the prompt rendered within the context, so commands
+// are cancelled together with the request.
+func (ce *commandExecutor) bind(ctx context.Context, promptName string) func(name string, args ...interface{}) (string, error) {
+	if ce == nil {
+		return ce.exec
+	}
+	return func(name string, args ...interface{}) (string, error) {
+		commandLine := []string{name}
+		for _, arg := range args {
+			commandLine = append(commandLine, toText(arg))
+		}
+		return ce.run(ctx, promptName, commandLine)
+	}
+}
+
+// run runs the command and returns its output without trailing newlines, like command substitution in a shell.
+func (ce *commandExecutor) run(ctx context.Context, promptName string, commandLine []string) (string, error) {
+	if !ce.isAllowed(commandLine) {
+		ce.logger.Warn("Command execution denied", "prompt", promptName, "command", commandLine)
+		return "", fmt.Errorf("command %q is not allowed", strings.Join(commandLine, " "))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ce.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, commandLine[0], commandLine[1:]...)
+	cmd.Dir = ce.dir
+	cmd.WaitDelay = execWaitDelay
+	stdout := &cappedBuffer{limit: ce.maxOutput}
+	stderr := &cappedBuffer{limit: ce.maxOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	start := time.Now()
+	err := cmd.Run()
+	ce.logger.Info("Executed command",
+		"prompt", promptName,
+		"command", commandLine,
+		"dir", ce.dir,
+		"duration", time.Since(start),
+		"exit_code", cmd.ProcessState.ExitCode(),
+		"stdout_bytes", stdout.buf.Len(),
+		"stderr_bytes", stderr.buf.Len(),
+		"error", err)
+
+	commandText := strings.Join(commandLine, " ")
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return "", fmt.Errorf("command %q timed out after %s", commandText, ce.timeout)
+	case err != nil:
+		if msg := strings.TrimSpace(stderr.buf.String()); msg != "" {
+			return "", fmt.Errorf("command %q failed: %w: %s", commandText, err, msg)
+		}
+		return "", fmt.Errorf("command %q failed: %w", commandText, err)
+	case stdout.exceeded:
+		return "", fmt.Errorf("output of command %q exceeds the limit of %d bytes", commandText, ce.maxOutput)
+	}
+	return strings.TrimRight(stdout.buf.String(), "\n"), nil
+}
+
+// cappedBuffer is a buffer that keeps at most limit bytes and discards the rest of the written data.
+type cappedBuffer struct {
+	buf      bytes.Buffer
+	limit    int
+	exceeded bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:max(room, 0)])
+		b.exceeded = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCommandExecutor tests running commands with the exec template function
+func (s *PromptsServerTestSuite) TestCommandExecutor() {
+	var logBuf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logBuf, nil))
+	ce := newCommandExecutor([]string{"echo hello", "echo -n", "pwd", "seq", "sleep", "sh -c"},
+		200*time.Millisecond, 256, s.tempDir, logger)
+	require.NotNil(s.T(), ce, "Executor should be created for allowed commands")
+
+	tests := []struct {
+		name        string
+		command     string
+		args        []interface{}
+		expected    string
+		expectedErr string
+	}{
+		{name: "allowed command", command: "echo", args: []interface{}{"hello", 42}, expected: "hello 42"},
+		{name: "command in working directory", command: "pwd", expected: s.tempDir},
+		{name: "trailing newlines are trimmed", command: "sh", args: []interface{}{"-c", `printf 'a\n\n'`}, expected: "a"},
+		{name: "command with other arguments", command: "echo", args: []interface{}{"bye"},
+			expectedErr: `command "echo bye" is not allowed`},
+		{name: "command not allowed", command: "ls", expectedErr: `command "ls" is not allowed`},
+		{name: "option not allowed", command: "echo", args: []interface{}{"hello", "-e"},
+			expectedErr: `command "echo hello -e" is not allowed`},
+		{name: "option with value not allowed", command: "seq", args: []interface{}{"--separator=,", "3"},
+			expectedErr: `command "seq --separator=, 3" is not allowed`},
+		{name: "allowed option", command: "echo", args: []interface{}{"-n", "hi"}, expected: "hi"},
+		{name: "failed command", command: "sh", args: []interface{}{"-c", "echo oops >&2; exit 3"},
+			expectedErr: `command "sh -c echo oops >&2; exit 3" failed: exit status 3: oops`},
+		{name: "output exceeds limit", command: "seq", args: []interface{}{"1000"},
+			expectedErr: `output of command "seq 1000" exceeds the limit of 256 bytes`},
+		{name: "timeout", command: "sleep", args: []interface{}{"5"},
+			expectedErr: `command "sleep 5" timed out after 200ms`},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			output, err := ce.bind(context.Background(), "review")(tt.command, tt.args...)
+			if tt.expectedErr != "" {
+				require.Error(s.T(), err, "Expected command error")
+				assert.Contains(s.T(), err.Error(), tt.expectedErr)
+				return
+			}
+			require.NoError(s.T(), err, "Command failed")
+			assert.Equal(s.T(), tt.expected, output)
+		})
+	}
+
+	// Commands are cancelled together with the request
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := ce.bind(ctx, "review")("sleep", "5")
+	assert.Error(s.T(), err, "Command of a cancelled request should fail")
+
+	assert.Contains(s.T(), logBuf.String(), `msg="Executed command" prompt=review command="[echo hello 42]"`,
+		"Executed commands should be logged")
+	assert.Contains(s.T(), logBuf.String(), `msg="Command execution denied" prompt=review command=[ls]`,
+		"Denied commands should be logged")
+
+	assert.Nil(s.T(), newCommandExecutor([]string{" "}, 0, 0, "", logger), "Executor should not be created without commands")
+	_, err = noExec.bind(context.Background(), "review")("echo", "hello")
+	assert.ErrorIs(s.T(), err, errExecNotEnabled)
+}
+
+// TestServeStdioWithExec tests rendering prompts that execute commands
+func (s *PromptsServerTestSuite) TestServeStdioWithExec() {
+	ctx := context.Background()
+
+	require.NoError(s.T(), os.WriteFile(filepath.Join(s.tempDir, "diff.tmpl"),
+		[]byte(`Review the diff:{{"\n"}}{{exec "echo" .change}}`), 0644), "Failed to write prompt file")
+
+	for _, tt := range []struct {
+		name        string
+		opts        []PromptsServerOption
+		expected    string
+		expectedErr string
+	}{
+		{name: "exec allowed", opts: []PromptsServerOption{WithExecAllow("echo")}, expected: "Review the diff:\n+added line"},
+		{name: "exec disabled", expectedErr: errExecNotEnabled.Error()},
+	} {
+		s.Run(tt.name, func() {
+			_, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, s.tempDir, true, tt.opts...)
+			defer promptsClose()
+
+			var getReq mcp.GetPromptRequest
+			getReq.Params.Name = "diff"
+			getReq.Params.Arguments = map[string]string{"change": "+added line"}
+			getResult, err := mcpClient.GetPrompt(ctx, getReq)
+			if tt.expectedErr != "" {
+				require.Error(s.T(), err, "GetPrompt should fail")
+				assert.Contains(s.T(), err.Error(), tt.expectedErr)
+				return
+			}
+			require.NoError(s.T(), err, "GetPrompt failed")
+			require.Len(s.T(), getResult.Messages, 1, "Expected exactly 1 message")
+			content, ok := getResult.Messages[0].Content.(mcp.TextContent)
+			require.True(s.T(), ok, "Expected TextContent")
+			assert.Equal(s.T(), tt.expected, content.Text, "Unexpected message content")
+		})
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// defaultMaxIncludeSize is the default limit of the size of files read by templates with readFile.
+const defaultMaxIncludeSize = 1 << 20
+
+// maxIncludeEntries limits the number of paths returned by glob and listed by fileTree.
+const maxIncludeEntries = 1000
+
+// errFileAccessNotConfigured is returned by the file functions of templates parsed without allowed roots.
+var errFileAccessNotConfigured = errors.New("file access is not configured")
+
+// noFileAccess provides the file functions of templateFuncs, which fail until they are overridden
+// by the functions of a configured fileIncluder.
+var noFileAccess *fileIncluder
+
+// fileIncluder implements the readFile, glob and fileTree template functions. Templates can access only files
+// in the allowed roots: a path is allowed if it is inside a root after resolving symlinks, so symlinks
+// cannot escape the roots. File contents are cached until reset, and files are reported to the watch callback
+// when they are read for the first time, so the server reloads prompts when an included file changes.
+type fileIncluder struct {
+	// roots are the absolute allowed roots with symlinks resolved
+	roots []string
+	// lookupRoots are the roots relative paths are looked up in, in order
+	lookupRoots []string
+	maxSize     int64
+	// watch is called with the directory of every newly included file
+	watch func(dir string)
+
+	mu       sync.Mutex
+	contents map[string]string
+	included map[string]struct{}
+}
+
+// newFileIncluder returns a fileIncluder allowing access to the prompts directories and the extra roots.
+// Relative paths are looked up in the prompts directories first, later ones overriding earlier ones
+// as for templates, and then in the extra roots in order. Roots that do not exist are kept as is,
+// so they cannot be used to access anything outside them once they are created.
+// A non-positive maxSize means defaultMaxIncludeSize.
+func newFileIncluder(promptsDirs []string, extraRoots []string, maxSize int64) *fileIncluder {
+	if maxSize <= 0 {
+		maxSize = defaultMaxIncludeSize
+	}
+	fi := &fileIncluder{
+		maxSize:  maxSize,
+		contents: make(map[string]string),
+		included: make(map[string]struct{}),
+	}
+	for i := len(promptsDirs) - 1; i >= 0; i-- {
+		fi.lookupRoots = append(fi.lookupRoots, resolveRoot(promptsDirs[i]))
+	}
+	for _, root := range extraRoots {
+		fi.lookupRoots = append(fi.lookupRoots, resolveRoot(root))
+	}
+	seen := make(map[string]struct{}, len(fi.lookupRoots))
+	for _, root := range fi.lookupRoots {
+		if _, exists := seen[root]; !exists {
+			seen[root] = struct{}{}
+			fi.roots = append(fi.roots, root)
+		}
+	}
+	return fi
+}
+
+// resolveRoot returns the absolute path of the root with symlinks resolved, or the cleaned path if it cannot be resolved.
+func resolveRoot(root string) string {
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		return resolved
+	}
+	return filepath.Clean(root)
+}
+
+// isWithin reports whether the path is the root or inside it.
+func isWithin(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// WithIncludeRoots allows templates to access files in the directories in addition to the prompts directories.
+func WithIncludeRoots(roots ...string) PromptsServerOption {
+	return func(ps *PromptsServer) {
+		ps.includeRoots = append(ps.includeRoots, roots...)
+	}
+}
+
+// WithMaxIncludeSize sets the limit of the size of files read by templates with readFile.
+func WithMaxIncludeSize(size int64) PromptsServerOption {
+	return func(ps *PromptsServer) {
+		ps.maxIncludeSize = size
+	}
+}
+
+// funcs returns the file functions bound to the includer, overriding the unconfigured ones of templateFuncs.
+func (fi *fileIncluder) funcs() template.FuncMap {
+	return template.FuncMap{
+		"readFile": fi.readFile,
+		"glob":     fi.glob,
+		"fileTree": fi.fileTree,
+	}
+}
+
+// reset clears the cached file contents, so files are read again on the next render.
+func (fi *fileIncluder) reset() {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.contents = make(map[string]string)
+}
+
+// isIncluded reports whether the file has been read by a template.
+func (fi *fileIncluder) isIncluded(name string) bool {
+	// The file may be already removed, so only its directory is resolved
+	resolved := filepath.Join(resolveRoot(filepath.Dir(name)), filepath.Base(name))
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	_, included := fi.included[resolved]
+	return included
+}
+
+// resolve returns the path of the file or directory with symlinks resolved. Relative paths are looked up
+// in the roots. An error is returned if the path is outside the roots.
+func (fi *fileIncluder) resolve(name string) (string, error) {
+	if fi == nil || len(fi.roots) == 0 {
+		return "", errFileAccessNotConfigured
+	}
+	if filepath.IsAbs(name) {
+		return fi.checkPath(name, filepath.Clean(name))
+	}
+	for _, root := range fi.lookupRoots {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if !isWithin(root, p) {
+			return "", fmt.Errorf("path %q is outside of the allowed roots", name)
+		}
+		if _, err := os.Lstat(p); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", err
+		}
+		return fi.checkPath(name, p)
+	}
+	return "", fmt.Errorf("%q is not found in the allowed roots", name)
+}
+
+// checkPath resolves symlinks in the path and checks that the result is inside the roots.
+func (fi *fileIncluder) checkPath(name, p string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", fmt.Errorf("resolve path %q: %w", name, err)
+	}
+	for _, root := range fi.roots {
+		if isWithin(root, resolved) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("path %q is outside of the allowed roots", name)
+}
+
+// readFile returns the content of the file, which must not be larger than the size limit.
+func (fi *fileIncluder) readFile(name string) (string, error) {
+	resolved, err := fi.resolve(name)
+	if err != nil {
+		return "", err
+	}
+	fi.mu.Lock()
+	content, cached := fi.contents[resolved]
+	fi.mu.Unlock()
+	if cached {
+		return content, nil
+	}
+
+	file, err := os.Open(resolved)
+	if err != nil {
+		return "", fmt.Errorf("open file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	info, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("stat file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%q is not a regular file", name)
+	}
+	// The size is checked while reading as well, since the file may grow after Stat
+	data, err := io.ReadAll(io.LimitReader(file, fi.maxSize+1))
+	if err != nil {
+		return "", fmt.Errorf("read file: %w", err)
+	}
+	if int64(len(data)) > fi.maxSize {
+		return "", fmt.Errorf("file %q is larger than the limit of %d bytes", name, fi.maxSize)
+	}
+
+	content = string(data)
+	fi.mu.Lock()
+	fi.contents[resolved] = content
+	_, wasIncluded := fi.included[resolved]
+	fi.included[resolved] = struct{}{}
+	fi.mu.Unlock()
+	if !wasIncluded && fi.watch != nil {
+		fi.watch(filepath.Dir(resolved))
+	}
+	return content, nil
+}
+
+// glob returns the sorted paths of the files matching the pattern. Relative patterns are matched in every root,
+// and the matches are returned as slash-separated paths relative to their root, which can be passed to readFile.
+// Hidden files are matched only by patterns that name them explicitly.
+func (fi *fileIncluder) glob(pattern string) ([]string, error) {
+	if fi == nil || len(fi.roots) == 0 {
+		return nil, errFileAccessNotConfigured
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("match pattern %q: %w", pattern, err)
+	}
+
+	var matches []string
+	seen := make(map[string]struct{})
+	addMatch := func(name, p string) {
+		if _, exists := seen[name]; exists || isHiddenMatch(pattern, name) {
+			return
+		}
+		resolved, err := fi.checkPath(name, p)
+		if err != nil {
+			return
+		}
+		if info, err := os.Stat(resolved); err != nil || !info.Mode().IsRegular() {
+			return
+		}
+		seen[name] = struct{}{}
+		matches = append(matches, name)
+	}
+
+	if filepath.IsAbs(pattern) {
+		paths, _ := filepath.Glob(pattern)
+		for _, p := range paths {
+			addMatch(p, p)
+		}
+	} else {
+		for _, root := range fi.lookupRoots {
+			paths, _ := filepath.Glob(filepath.Join(root, filepath.FromSlash(pattern)))
+			for _, p := range paths {
+				rel, err := filepath.Rel(root, p)
+				if err != nil || !isWithin(root, p) {
+					continue
+				}
+				addMatch(filepath.ToSlash(rel), p)
+			}
+		}
+	}
+	if len(matches) > maxIncludeEntries {
+		return nil, fmt.Errorf("pattern %q matches more than %d files", pattern, maxIncludeEntries)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// isHiddenMatch reports whether the path matching the pattern has a hidden component that is matched
+// by a wildcard, like "checklists/.draft.md" for "checklists/*.md". Hidden files are matched only explicitly.
+func isHiddenMatch(pattern, name string) bool {
+	patternParts := strings.Split(filepath.ToSlash(filepath.Clean(pattern)), "/")
+	nameParts := strings.Split(filepath.ToSlash(name), "/")
+	for i, part := range nameParts {
+		if strings.HasPrefix(part, ".") && (i >= len(patternParts) || !strings.HasPrefix(patternParts[i], ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileTree returns the tree of the files and subdirectories of the directory, like the tree command.
+// Hidden entries are skipped, and symlinks are listed only if they point inside the roots, but are not followed.
+func (fi *fileIncluder) fileTree(name string) (string, error) {
+	resolved, err := fi.resolve(name)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", fmt.Errorf("stat directory: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%q is not a directory", name)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(strings.TrimSuffix(filepath.ToSlash(filepath.Clean(name)), "/") + "/")
+	entries := 0
+	if err = fi.writeTree(&sb, resolved, "", &entries); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+func (fi *fileIncluder) writeTree(sb *strings.Builder, dir, prefix string, entries *int) error {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read directory: %w", err)
+	}
+	var visible []os.DirEntry
+	for _, entry := range dirEntries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if entry.Type()&os.ModeSymlink != 0 {
+			if _, err = fi.checkPath(entry.Name(), filepath.Join(dir, entry.Name())); err != nil {
+				continue
+			}
+		}
+		visible = append(visible, entry)
+	}
+
+	for i, entry := range visible {
+		if *entries++; *entries > maxIncludeEntries {
+			return fmt.Errorf("directory tree has more than %d entries", maxIncludeEntries)
+		}
+		connector, childPrefix := "├── ", prefix+"│   "
+		if i == len(visible)-1 {
+			connector, childPrefix = "└── ", prefix+"    "
+		}
+		sb.WriteString("\n" + prefix + connector + entry.Name())
+		if entry.IsDir() {
+			sb.WriteString("/")
+			if err = fi.writeTree(sb, filepath.Join(dir, entry.Name()), childPrefix, entries); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFileFunctions tests the readFile, glob and fileTree template functions
+func (s *PromptsServerTestSuite) TestFileFunctions() {
+	promptsDir := filepath.Join(s.tempDir, "prompts")
+	docsDir := filepath.Join(s.tempDir, "docs")
+	outsideDir := filepath.Join(s.tempDir, "outside")
+	files := map[string]string{
+		"prompts/style.md":             "Use tabs.",
+		"prompts/checklists/review.md": "- Tests",
+		"prompts/checklists/.draft.md": "Draft",
+		"docs/style.md":                "Shadowed by the prompts directory",
+		"docs/schema.json":             `{"type": "object"}`,
+		"docs/large.txt":               strings.Repeat("x", 41),
+		"outside/secret.txt":           "Secret",
+	}
+	for name, content := range files {
+		filePath := filepath.Join(s.tempDir, filepath.FromSlash(name))
+		require.NoError(s.T(), os.MkdirAll(filepath.Dir(filePath), 0755), "Failed to create directory")
+		require.NoError(s.T(), os.WriteFile(filePath, []byte(content), 0644), "Failed to write test file")
+	}
+	require.NoError(s.T(), os.Symlink(filepath.Join(outsideDir, "secret.txt"), filepath.Join(promptsDir, "secret.txt")),
+		"Failed to create symlink")
+	require.NoError(s.T(), os.Symlink(outsideDir, filepath.Join(docsDir, "outside")), "Failed to create symlink")
+	require.NoError(s.T(), os.Symlink(filepath.Join(docsDir, "schema.json"), filepath.Join(promptsDir, "schema.json")),
+		"Failed to create symlink")
+
+	fi := newFileIncluder([]string{promptsDir}, []string{docsDir}, 40)
+	var watchedDirs []string
+	fi.watch = func(dir string) { watchedDirs = append(watchedDirs, dir) }
+	funcs := templateFuncs()
+	for name, fn := range fi.funcs() {
+		funcs[name] = fn
+	}
+	execute := func(text string) (string, error) {
+		tmpl, err := template.New("test").Funcs(funcs).Parse(text)
+		require.NoError(s.T(), err, "Failed to parse template")
+		var buf bytes.Buffer
+		err = tmpl.Execute(&buf, nil)
+		return buf.String(), err
+	}
+
+	tests := []struct {
+		name        string
+		template    string
+		expected    string
+		expectedErr string
+	}{
+		{name: "read file from prompts directory", template: `{{readFile "style.md"}}`, expected: "Use tabs."},
+		{name: "read file from include root", template: `{{readFile "schema.json"}}`, expected: `{"type": "object"}`},
+		{name: "read file by absolute path", template: `{{readFile "` + filepath.ToSlash(filepath.Join(docsDir, "style.md")) + `"}}`,
+			expected: "Shadowed by the prompts directory"},
+		{name: "read file in subdirectory", template: `{{readFile "checklists/review.md"}}`, expected: "- Tests"},
+		{name: "read missing file", template: `{{readFile "missing.md"}}`, expectedErr: `"missing.md" is not found in the allowed roots`},
+		{name: "read file outside roots", template: `{{readFile "../outside/secret.txt"}}`,
+			expectedErr: `path "../outside/secret.txt" is outside of the allowed roots`},
+		{name: "read file by absolute path outside roots", template: `{{readFile "` + filepath.ToSlash(filepath.Join(outsideDir, "secret.txt")) + `"}}`,
+			expectedErr: "is outside of the allowed roots"},
+		{name: "read symlink escaping roots", template: `{{readFile "secret.txt"}}`,
+			expectedErr: `path "secret.txt" is outside of the allowed roots`},
+		{name: "read file through symlinked directory", template: `{{readFile "outside/secret.txt"}}`,
+			expectedErr: `path "outside/secret.txt" is outside of the allowed roots`},
+		{name: "read too large file", template: `{{readFile "large.txt"}}`,
+			expectedErr: `file "large.txt" is larger than the limit of 40 bytes`},
+		{name: "read directory", template: `{{readFile "checklists"}}`, expectedErr: `"checklists" is not a regular file`},
+
+		{name: "glob", template: `{{glob "*.*" | join ","}}`, expected: "large.txt,schema.json,style.md"},
+		{name: "glob in subdirectory", template: `{{range glob "checklists/*.md"}}{{readFile .}}{{end}}`, expected: "- Tests"},
+		{name: "glob of hidden file", template: `{{glob "checklists/.*" | join ","}}`, expected: "checklists/.draft.md"},
+		{name: "glob without matches", template: `{{len (glob "*.yaml")}}`, expected: "0"},
+		{name: "glob with invalid pattern", template: `{{glob "[" }}`, expectedErr: "syntax error in pattern"},
+
+		{name: "file tree", template: `{{fileTree "."}}`,
+			expected: "./\n├── checklists/\n│   └── review.md\n├── schema.json\n└── style.md"},
+		{name: "file tree of include root", template: `{{fileTree "` + filepath.ToSlash(docsDir) + `"}}`,
+			expected: filepath.ToSlash(docsDir) + "/\n├── large.txt\n├── schema.json\n└── style.md"},
+		{name: "file tree of file", template: `{{fileTree "style.md"}}`, expectedErr: `"style.md" is not a directory`},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			output, err := execute(tt.template)
+			if tt.expectedErr != "" {
+				require.Error(s.T(), err, "Expected execution error")
+				assert.Contains(s.T(), err.Error(), tt.expectedErr)
+				return
+			}
+			require.NoError(s.T(), err, "Failed to execute template")
+			assert.Equal(s.T(), tt.expected, output)
+		})
+	}
+
+	resolvedPromptsDir, err := filepath.EvalSymlinks(promptsDir)
+	require.NoError(s.T(), err, "Failed to resolve prompts directory")
+	assert.True(s.T(), fi.isIncluded(filepath.Join(promptsDir, "style.md")), "Read file should be included")
+	assert.False(s.T(), fi.isIncluded(filepath.Join(docsDir, "large.txt")), "File failed to read should not be included")
+	assert.Contains(s.T(), watchedDirs, resolvedPromptsDir, "Directory of included file should be watched")
+
+	// File contents are cached until reset
+	require.NoError(s.T(), os.WriteFile(filepath.Join(promptsDir, "style.md"), []byte("Use spaces."), 0644),
+		"Failed to write test file")
+	output, err := execute(`{{readFile "style.md"}}`)
+	require.NoError(s.T(), err, "Failed to execute template")
+	assert.Equal(s.T(), "Use tabs.", output, "Cached content should be returned")
+	fi.reset()
+	output, err = execute(`{{readFile "style.md"}}`)
+	require.NoError(s.T(), err, "Failed to execute template")
+	assert.Equal(s.T(), "Use spaces.", output, "File should be read again after reset")
+
+	// Templates parsed without allowed roots cannot access files
+	tmpl := template.Must(template.New("test").Funcs(templateFuncs()).Parse(`{{readFile "style.md"}}`))
+	assert.ErrorIs(s.T(), tmpl.Execute(&bytes.Buffer{}, nil), errFileAccessNotConfigured)
+}
+
+// TestReloadPromptsIncludedFileChanged tests that changes of files included by templates are picked up
+func (s *PromptsServerTestSuite) TestReloadPromptsIncludedFileChanged() {
+	ctx := context.Background()
+
+	promptsDir := filepath.Join(s.tempDir, "prompts")
+	docsDir := filepath.Join(s.tempDir, "docs")
+	require.NoError(s.T(), os.MkdirAll(promptsDir, 0755), "Failed to create directory")
+	require.NoError(s.T(), os.MkdirAll(docsDir, 0755), "Failed to create directory")
+	require.NoError(s.T(), os.WriteFile(filepath.Join(promptsDir, "review.tmpl"),
+		[]byte(`Follow the guide:{{"\n"}}{{readFile "guide.md"}}`), 0644), "Failed to write prompt file")
+	guidePath := filepath.Join(docsDir, "guide.md")
+	require.NoError(s.T(), os.WriteFile(guidePath, []byte("Be kind."), 0644), "Failed to write included file")
+
+	_, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, promptsDir, true, WithIncludeRoots(docsDir))
+	defer promptsClose()
+
+	getText := func() string {
+		var getReq mcp.GetPromptRequest
+		getReq.Params.Name = "review"
+		getResult, err := mcpClient.GetPrompt(ctx, getReq)
+		require.NoError(s.T(), err, "GetPrompt failed")
+		require.Len(s.T(), getResult.Messages, 1, "Expected exactly 1 message")
+		content, ok := getResult.Messages[0].Content.(mcp.TextContent)
+		require.True(s.T(), ok, "Expected TextContent")
+		return content.Text
+	}
+	assert.Equal(s.T(), "Follow the guide:\nBe kind.", getText(), "Unexpected message content")
+
+	require.NoError(s.T(), os.WriteFile(guidePath, []byte("Be concise."), 0644), "Failed to write included file")
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(s.T(), "Follow the guide:\nBe concise.", getText(), "Changed included file should be picked up")
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// fixtureExt is the extension of prompt test fixture files, e.g. "code_review.test.yaml" for "code_review.tmpl".
+	fixtureExt = ".test.yaml"
+	// goldenExt is the extension of golden files with the expected output of test cases.
+	goldenExt = ".golden"
+)
+
+// Statuses of prompt test cases.
+const (
+	promptTestPassed  = "PASS"
+	promptTestFailed  = "FAIL"
+	promptTestUpdated = "UPDATED"
+)
+
+// PromptFixture is a set of test cases of a prompt, declared in a fixture file next to the prompt template.
+type PromptFixture struct {
+	Cases []PromptTestCase `yaml:"cases"`
+}
+
+// PromptTestCase renders the prompt with the arguments and checks the output. If the case expects an error or
+// substrings, only they are checked; otherwise the output is compared with the golden file of the case.
+type PromptTestCase struct {
+	Name string `yaml:"name"`
+	// Arguments are passed to the prompt as in MCP requests: strings as is and other values as JSON
+	Arguments map[string]interface{} `yaml:"arguments"`
+	// Contains lists substrings the output must contain
+	Contains []string `yaml:"contains"`
+	// Error is a substring of the error rendering must fail with
+	Error string `yaml:"error"`
+}
+
+// PromptTestResult is the result of a single test case. Errors of a whole fixture are reported with an empty Case.
+type PromptTestResult struct {
+	Prompt  string
+	Case    string
+	Fixture string
+	Status  string
+	Message string
+}
+
+var goldenNameReplacer = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// goldenPath returns the path of the golden file of the test case, next to the fixture file,
+// e.g. "code_review.basic.golden" for the "basic" case of "code_review.test.yaml".
+func goldenPath(fixturePath, caseName string) string {
+	base := strings.TrimSuffix(fixturePath, fixtureExt)
+	return base + "." + goldenNameReplacer.ReplaceAllString(caseName, "_") + goldenExt
+}
+
+// RunPromptTests renders prompts with the arguments of the test cases in their fixture files and checks the output.
+// Fixture files are overlaid like templates and belong to the prompt loaded from the template with the same path.
+// If promptNames are given, only their fixtures are run. With update, golden files are rewritten
+// with the rendered output instead of being compared with it.
+func (ps *PromptsServer) RunPromptTests(ctx context.Context, update bool, promptNames ...string) ([]PromptTestResult, error) {
+	prompts, templateErrs, err := ps.loadServerPrompts()
+	if err != nil {
+		return nil, fmt.Errorf("load prompts: %w", err)
+	}
+	promptsByName := make(map[string]loadedPrompt, len(prompts))
+	for _, prompt := range prompts {
+		promptsByName[prompt.Prompt.Name] = prompt
+	}
+	selected := make(map[string]struct{}, len(promptNames))
+	for _, name := range promptNames {
+		selected[name] = struct{}{}
+	}
+
+	fixtureFiles, err := listOverlaidFiles(fixtureExt, ps.promptsDirs...)
+	if err != nil {
+		return nil, fmt.Errorf("list fixture files: %w", err)
+	}
+	var results []PromptTestResult
+	for _, fixtureFile := range fixtureFiles {
+		templateRelPath := strings.TrimSuffix(fixtureFile.RelPath, fixtureExt) + templateExt
+		promptName := strings.ReplaceAll(strings.TrimSuffix(templateRelPath, templateExt), "/", ps.promptNameSeparator)
+		if _, ok := selected[promptName]; len(selected) != 0 && !ok {
+			continue
+		}
+		fixtureResult := PromptTestResult{Prompt: promptName, Fixture: fixtureFile.Path(), Status: promptTestFailed}
+
+		prompt, ok := promptsByName[promptName]
+		if !ok {
+			fixtureResult.Message = fmt.Sprintf("no prompt loaded from %q", templateRelPath)
+			for _, templateErr := range templateErrs {
+				if strings.HasSuffix(filepath.ToSlash(templateErr.Path), "/"+templateRelPath) {
+					fixtureResult.Message = templateErr.Error()
+				}
+			}
+			results = append(results, fixtureResult)
+			continue
+		}
+		fixture, err := readPromptFixture(fixtureFile.Path())
+		if err != nil {
+			fixtureResult.Message = err.Error()
+			results = append(results, fixtureResult)
+			continue
+		}
+		for _, testCase := range fixture.Cases {
+			result := runPromptTestCase(ctx, prompt, fixtureFile.Path(), testCase, update)
+			result.Prompt = promptName
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// readPromptFixture reads the fixture file and checks that its cases have unique names.
+func readPromptFixture(fixturePath string) (PromptFixture, error) {
+	content, err := os.ReadFile(fixturePath)
+	if err != nil {
+		return PromptFixture{}, fmt.Errorf("read fixture file: %w", err)
+	}
+	var fixture PromptFixture
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	if err = dec.Decode(&fixture); err != nil && !errors.Is(err, io.EOF) {
+		return PromptFixture{}, fmt.Errorf("decode fixture file: %w", err)
+	}
+	if len(fixture.Cases) == 0 {
+		return PromptFixture{}, fmt.Errorf("fixture file has no test cases")
+	}
+	names := make(map[string]struct{}, len(fixture.Cases))
+	for i, testCase := range fixture.Cases {
+		if testCase.Name == "" {
+			return PromptFixture{}, fmt.Errorf("test case #%d has no name", i+1)
+		}
+		if _, exists := names[testCase.Name]; exists {
+			return PromptFixture{}, fmt.Errorf("test case %q is declared more than once", testCase.Name)
+		}
+		names[testCase.Name] = struct{}{}
+	}
+	return fixture, nil
+}
+
+// runPromptTestCase renders the prompt with the arguments of the test case and checks the output.
+func runPromptTestCase(
+	ctx context.Context, prompt loadedPrompt, fixturePath string, testCase PromptTestCase, update bool,
+) PromptTestResult {
+	result := PromptTestResult{Case: testCase.Name, Fixture: fixturePath, Status: promptTestFailed}
+	args, err := stringifyArgs(testCase.Arguments)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	output, renderErr := prompt.render(ctx, args)
+
+	switch {
+	case testCase.Error != "":
+		if renderErr == nil {
+			result.Message = fmt.Sprintf("expected error containing %q, rendered successfully", testCase.Error)
+			return result
+		}
+		if !strings.Contains(renderErr.Error(), testCase.Error) {
+			result.Message = fmt.Sprintf("expected error containing %q, got: %v", testCase.Error, renderErr)
+			return result
+		}
+	case renderErr != nil:
+		result.Message = fmt.Sprintf("render prompt: %v", renderErr)
+		return result
+	case len(testCase.Contains) != 0:
+		var missing []string
+		for _, substr := range testCase.Contains {
+			if !strings.Contains(output, substr) {
+				missing = append(missing, fmt.Sprintf("%q", substr))
+			}
+		}
+		if len(missing) != 0 {
+			result.Message = fmt.Sprintf("output does not contain %s:\n%s", strings.Join(missing, ", "), output)
+			return result
+		}
+	default:
+		return checkGolden(result, goldenPath(fixturePath, testCase.Name), output, update)
+	}
+	result.Status = promptTestPassed
+	return result
+}
+
+// checkGolden compares the output with the golden file, or rewrites the golden file if it differs in update mode.
+// Golden files end with a newline that is not a part of the output.
+func checkGolden(result PromptTestResult, goldenFilePath, output string, update bool) PromptTestResult {
+	content, err := os.ReadFile(goldenFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		result.Message = fmt.Sprintf("read golden file: %v", err)
+		return result
+	}
+	exists := err == nil
+	expected := strings.TrimSuffix(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	if exists && expected == output {
+		result.Status = promptTestPassed
+		return result
+	}
+
+	if update {
+		if err = os.WriteFile(goldenFilePath, []byte(output+"\n"), 0644); err != nil {
+			result.Message = fmt.Sprintf("write golden file: %v", err)
+			return result
+		}
+		result.Status = promptTestUpdated
+		result.Message = "updated " + goldenFilePath
+		return result
+	}
+	if !exists {
+		result.Message = fmt.Sprintf("golden file %s does not exist, run with -update to create it", goldenFilePath)
+		return result
+	}
+	result.Message = fmt.Sprintf("output differs from %s (-expected +actual):\n%s", goldenFilePath, diffLines(expected, output))
+	return result
+}
+
+// diffLines returns the line diff of the texts: common lines are prefixed with a space, removed lines with "-"
+// and added lines with "+".
+func diffLines(a, b string) string {
+	aLines, bLines := strings.Split(a, "\n"), strings.Split(b, "\n")
+	// lcs[i][j] is the length of the longest common subsequence of aLines[i:] and bLines[j:]
+	lcs := make([][]int, len(aLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bLines)+1)
+	}
+	for i := len(aLines) - 1; i >= 0; i-- {
+		for j := len(bLines) - 1; j >= 0; j-- {
+			if aLines[i] == bLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(aLines) || j < len(bLines) {
+		switch {
+		case i < len(aLines) && j < len(bLines) && aLines[i] == bLines[j]:
+			sb.WriteString(" " + aLines[i] + "\n")
+			i++
+			j++
+		case i < len(aLines) && (j == len(bLines) || lcs[i+1][j] >= lcs[i][j+1]):
+			sb.WriteString("-" + aLines[i] + "\n")
+			i++
+		default:
+			sb.WriteString("+" + bLines[j] + "\n")
+			j++
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRunPromptTests tests running prompt test cases from fixture files
+func (s *PromptsServerTestSuite) TestRunPromptTests() {
+	ctx := context.Background()
+
+	promptsDir := filepath.Join(s.tempDir, "prompts")
+	require.NoError(s.T(), os.MkdirAll(filepath.Join(promptsDir, "review"), 0755), "Failed to create directory")
+	files := map[string]string{
+		"greeting.tmpl": "---\ndescription: Greeting\n---\nHello {{.name}}!{{if .verbose}} Welcome back.{{end}}",
+		"greeting.test.yaml": `cases:
+  - name: plain greeting
+    arguments: {name: Alice}
+  - name: verbose
+    arguments: {name: Bob, verbose: true}
+    contains: [Hello Bob, Welcome back]
+  - name: missing name
+    error: '"name": argument is required'
+`,
+		"review/code.tmpl": "---\ndescription: Review\narguments:\n  - name: lines\n    type: integer\n    minimum: 1\n---\n" +
+			"Review {{.lines}} lines",
+		"review/code.test.yaml": "cases:\n  - name: invalid\n    arguments: {lines: 0}\n    error: must be at least 1\n" +
+			"  - name: wrong error\n    arguments: {lines: 1}\n    error: must be at least 1\n" +
+			"  - name: missing substring\n    arguments: {lines: 1}\n    contains: [Review 2 lines]\n",
+		"orphan.test.yaml":  "cases:\n  - name: any\n",
+		"broken.tmpl":       "{{/* Broken */}}\n{{.unclosed",
+		"broken.test.yaml":  "cases:\n  - name: any\n",
+		"invalid.tmpl":      "{{/* Invalid fixture */}}\nHi",
+		"invalid.test.yaml": "cases:\n  - name: a\n  - name: a\n",
+	}
+	for name, content := range files {
+		require.NoError(s.T(), os.WriteFile(filepath.Join(promptsDir, filepath.FromSlash(name)), []byte(content), 0644),
+			"Failed to write test file")
+	}
+	ps := newOfflinePromptsServer([]string{promptsDir}, true)
+	greetingFixture := filepath.Join(promptsDir, "greeting.test.yaml")
+	golden := filepath.Join(promptsDir, "greeting.plain_greeting.golden")
+
+	results, err := ps.RunPromptTests(ctx, false)
+	require.NoError(s.T(), err, "RunPromptTests() unexpected error")
+	expected := []PromptTestResult{
+		{Prompt: "broken", Fixture: filepath.Join(promptsDir, "broken.test.yaml"), Status: promptTestFailed,
+			Message: filepath.Join(promptsDir, "broken.tmpl") + ": parse template: template: broken.tmpl:2: unclosed action"},
+		{Prompt: "greeting", Case: "plain greeting", Fixture: greetingFixture, Status: promptTestFailed,
+			Message: "golden file " + golden + " does not exist, run with -update to create it"},
+		{Prompt: "greeting", Case: "verbose", Fixture: greetingFixture, Status: promptTestPassed},
+		{Prompt: "greeting", Case: "missing name", Fixture: greetingFixture, Status: promptTestPassed},
+		{Prompt: "invalid", Fixture: filepath.Join(promptsDir, "invalid.test.yaml"), Status: promptTestFailed,
+			Message: `test case "a" is declared more than once`},
+		{Prompt: "orphan", Fixture: filepath.Join(promptsDir, "orphan.test.yaml"), Status: promptTestFailed,
+			Message: `no prompt loaded from "orphan.tmpl"`},
+		{Prompt: "review/code", Case: "invalid", Fixture: filepath.Join(promptsDir, "review", "code.test.yaml"),
+			Status: promptTestPassed},
+		{Prompt: "review/code", Case: "wrong error", Fixture: filepath.Join(promptsDir, "review", "code.test.yaml"),
+			Status: promptTestFailed, Message: `expected error containing "must be at least 1", rendered successfully`},
+		{Prompt: "review/code", Case: "missing substring", Fixture: filepath.Join(promptsDir, "review", "code.test.yaml"),
+			Status: promptTestFailed, Message: "output does not contain \"Review 2 lines\":\nReview 1 lines"},
+	}
+	assert.Equal(s.T(), expected, results, "Unexpected test results")
+
+	// Golden files are created in update mode and compared with afterwards
+	results, err = ps.RunPromptTests(ctx, true, "greeting")
+	require.NoError(s.T(), err, "RunPromptTests() unexpected error")
+	require.Len(s.T(), results, 3, "Only the selected prompt should be tested")
+	assert.Equal(s.T(), promptTestUpdated, results[0].Status, "Golden file should be created")
+	content, err := os.ReadFile(golden)
+	require.NoError(s.T(), err, "Failed to read golden file")
+	assert.Equal(s.T(), "Hello Alice!\n", string(content), "Unexpected golden file")
+
+	results, err = ps.RunPromptTests(ctx, false, "greeting")
+	require.NoError(s.T(), err, "RunPromptTests() unexpected error")
+	assert.Equal(s.T(), promptTestPassed, results[0].Status, "Output should match the golden file: %s", results[0].Message)
+
+	require.NoError(s.T(), os.WriteFile(golden, []byte("Hi Alice!\n"), 0644), "Failed to write golden file")
+	results, err = ps.RunPromptTests(ctx, false, "greeting")
+	require.NoError(s.T(), err, "RunPromptTests() unexpected error")
+	assert.Equal(s.T(), promptTestFailed, results[0].Status, "Output should not match the golden file")
+	assert.Equal(s.T(), "output differs from "+golden+" (-expected +actual):\n-Hi Alice!\n+Hello Alice!\n", results[0].Message)
+}
+
+// TestDiffLines tests the line diff of golden files
+func (s *PromptsServerTestSuite) TestDiffLines() {
+	tests := []struct {
+		name     string
+		a, b     string
+		expected string
+	}{
+		{name: "equal", a: "a\nb", b: "a\nb", expected: " a\n b\n"},
+		{name: "changed line", a: "a\nb\nc", b: "a\nx\nc", expected: " a\n-b\n+x\n c\n"},
+		{name: "added lines", a: "a", b: "a\nb\nc", expected: " a\n+b\n+c\n"},
+		{name: "removed lines", a: "a\nb\nc", b: "c", expected: "-a\n-b\n c\n"},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			assert.Equal(s.T(), tt.expected, diffLines(tt.a, tt.b))
+		})
+	}
+}
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Categories of template functions.
+const (
+	funcCategoryPrompt = "prompt"
+	funcCategoryString = "string"
+	funcCategoryList   = "list"
+	funcCategoryValue  = "value"
+	funcCategoryData   = "data"
+	funcCategoryMath   = "math"
+	funcCategoryRegex  = "regex"
+	funcCategoryFile   = "file"
+	funcCategoryExec   = "exec"
+	funcCategoryTime   = "time"
+)
+
+// templateFunction is a function available in prompt templates. The value a function is applied to comes last,
+// so functions can be used in pipelines, e.g. {{.code | indent 4}}.
+type templateFunction struct {
+	Name        string `json:"name"`
+	Category    string `json:"category"`
+	Signature   string `json:"signature"`
+	Description string `json:"description"`
+	fn          interface{}
+}
+
+// templateFunctions is the library of functions available in prompt templates, in addition to
+// the text/template built-ins such as len, index, printf, eq and and.
+var templateFunctions = []templateFunction{
+	{Name: "dict", Category: funcCategoryPrompt, Signature: "dict KEY VALUE [KEY VALUE...]",
+		Description: "Map of the key-value pairs, e.g. to pass several values to a partial", fn: dict},
+	{Name: "message", Category: funcCategoryPrompt, Signature: "message ROLE",
+		Description: "Starts a new prompt message with the role: user, assistant or system", fn: message},
+
+	{Name: "upper", Category: funcCategoryString, Signature: "upper TEXT",
+		Description: "Text in upper case", fn: upperFunc},
+	{Name: "lower", Category: funcCategoryString, Signature: "lower TEXT",
+		Description: "Text in lower case", fn: lowerFunc},
+	{Name: "trim", Category: funcCategoryString, Signature: "trim TEXT",
+		Description: "Text without leading and trailing white space", fn: trimFunc},
+	{Name: "replace", Category: funcCategoryString, Signature: "replace OLD NEW TEXT",
+		Description: "Text with all occurrences of OLD replaced by NEW", fn: replaceFunc},
+	{Name: "indent", Category: funcCategoryString, Signature: "indent WIDTH TEXT",
+		Description: "Text with every non-empty line indented by WIDTH spaces", fn: indentFunc},
+	{Name: "wrap", Category: funcCategoryString, Signature: "wrap WIDTH TEXT",
+		Description: "Text with lines wrapped at word boundaries to at most WIDTH characters where possible", fn: wrapFunc},
+	{Name: "truncate", Category: funcCategoryString, Signature: "truncate LENGTH TEXT",
+		Description: "Text cut to at most LENGTH characters, ending with \"...\" if cut", fn: truncateFunc},
+
+	{Name: "list", Category: funcCategoryList, Signature: "list [VALUE...]",
+		Description: "List of the values", fn: listFunc},
+	{Name: "join", Category: funcCategoryList, Signature: "join SEPARATOR LIST",
+		Description: "Elements of the list joined with the separator", fn: joinFunc},
+	{Name: "first", Category: funcCategoryList, Signature: "first LIST",
+		Description: "First element of the list, or an empty text if it is empty", fn: firstFunc},
+	{Name: "last", Category: funcCategoryList, Signature: "last LIST",
+		Description: "Last element of the list, or an empty text if it is empty", fn: lastFunc},
+	{Name: "uniq", Category: funcCategoryList, Signature: "uniq LIST",
+		Description: "List without duplicate elements, in the original order", fn: uniqFunc},
+	{Name: "sort", Category: funcCategoryList, Signature: "sort LIST",
+		Description: "List sorted in ascending order: numerically if all elements are numbers, as text otherwise", fn: sortFunc},
+
+	{Name: "default", Category: funcCategoryValue, Signature: "default DEFAULT VALUE",
+		Description: "VALUE, or DEFAULT if VALUE is empty", fn: defaultFunc},
+	{Name: "coalesce", Category: funcCategoryValue, Signature: "coalesce VALUE [VALUE...]",
+		Description: "First value that is not empty, or an empty text if all are", fn: coalesceFunc},
+	{Name: "empty", Category: funcCategoryValue, Signature: "empty VALUE",
+		Description: "Whether the value is missing, false, zero, or an empty text, list or map", fn: isEmpty},
+	{Name: "required", Category: funcCategoryValue, Signature: "required MESSAGE VALUE",
+		Description: "VALUE, or fails rendering with MESSAGE if VALUE is empty", fn: requiredFunc},
+
+	{Name: "toJson", Category: funcCategoryData, Signature: "toJson VALUE",
+		Description: "Value encoded as JSON", fn: toJSONFunc},
+	{Name: "fromJson", Category: funcCategoryData, Signature: "fromJson TEXT",
+		Description: "Value decoded from the JSON text", fn: fromJSONFunc},
+	{Name: "toYaml", Category: funcCategoryData, Signature: "toYaml VALUE",
+		Description: "Value encoded as YAML", fn: toYAMLFunc},
+
+	{Name: "add", Category: funcCategoryMath, Signature: "add NUMBER NUMBER [NUMBER...]",
+		Description: "Sum of the numbers", fn: addFunc},
+	{Name: "sub", Category: funcCategoryMath, Signature: "sub A B",
+		Description: "A minus B", fn: subFunc},
+	{Name: "mul", Category: funcCategoryMath, Signature: "mul NUMBER NUMBER [NUMBER...]",
+		Description: "Product of the numbers", fn: mulFunc},
+	{Name: "div", Category: funcCategoryMath, Signature: "div A B",
+		Description: "A divided by B, truncated if both are integers", fn: divFunc},
+	{Name: "mod", Category: funcCategoryMath, Signature: "mod A B",
+		Description: "Remainder of dividing the integer A by the integer B", fn: modFunc},
+	{Name: "min", Category: funcCategoryMath, Signature: "min NUMBER [NUMBER...]",
+		Description: "Smallest of the numbers", fn: minFunc},
+	{Name: "max", Category: funcCategoryMath, Signature: "max NUMBER [NUMBER...]",
+		Description: "Largest of the numbers", fn: maxFunc},
+
+	{Name: "regexMatch", Category: funcCategoryRegex, Signature: "regexMatch PATTERN TEXT",
+		Description: "Whether the text contains a match of the regular expression", fn: regexMatchFunc},
+	{Name: "regexReplace", Category: funcCategoryRegex, Signature: "regexReplace PATTERN REPLACEMENT TEXT",
+		Description: "Text with matches of the regular expression replaced; $1 in REPLACEMENT refers to the first group",
+		fn:          regexReplaceFunc},
+
+	{Name: "readFile", Category: funcCategoryFile, Signature: "readFile PATH",
+		Description: "Content of the file; relative paths are looked up in the prompts directories and then in the include roots",
+		fn:          noFileAccess.readFile},
+	{Name: "glob", Category: funcCategoryFile, Signature: "glob PATTERN",
+		Description: "Sorted paths of the files matching the pattern, relative to the root they are found in", fn: noFileAccess.glob},
+	{Name: "fileTree", Category: funcCategoryFile, Signature: "fileTree PATH",
+		Description: "Tree of the files and subdirectories of the directory, without hidden ones", fn: noFileAccess.fileTree},
+
+	{Name: "now", Category: funcCategoryTime, Signature: "now",
+		Description: "Current time in the timezone set with -timezone", fn: systemClock.currentTime},
+	{Name: "formatTime", Category: funcCategoryTime, Signature: "formatTime LAYOUT TIME",
+		Description: "Time formatted with a Go layout like \"Jan 2, 2006\" or one of: date, datetime, time, kitchen, RFC3339, RFC1123",
+		fn:          systemClock.formatTime},
+	{Name: "addDuration", Category: funcCategoryTime, Signature: "addDuration DURATION TIME",
+		Description: "Time plus the duration, e.g. \"-1h30m\" or \"7d\"", fn: systemClock.addDuration},
+	{Name: "weekday", Category: funcCategoryTime, Signature: "weekday TIME",
+		Description: "Day of the week of the time, e.g. Monday", fn: systemClock.weekday},
+
+	{Name: "exec", Category: funcCategoryExec, Signature: "exec COMMAND [ARG...]",
+		Description: "Output of the command allowed with -exec-allow, run without a shell", fn: noExec.exec},
+}
+
+// templateFuncs returns the functions available in prompt templates.
+func templateFuncs() template.FuncMap {
+	funcs := make(template.FuncMap, len(templateFunctions))
+	for _, f := range templateFunctions {
+		funcs[f.Name] = f.fn
+	}
+	return funcs
+}
+
+// mergeFuncs returns the functions of all the maps; functions of later maps override the ones of earlier maps.
+func mergeFuncs(funcMaps ...template.FuncMap) template.FuncMap {
+	funcs := make(template.FuncMap)
+	for _, funcMap := range funcMaps {
+		for name, fn := range funcMap {
+			funcs[name] = fn
+		}
+	}
+	return funcs
+}
+
+// guardingFuncs are the template functions that check whether their arguments are empty,
+// so arguments passed to them are optional.
+var guardingFuncs = map[string]struct{}{"default": {}, "coalesce": {}, "empty": {}}
+
+// listFuncs are the template functions that take a list as the last argument.
+var listFuncs = map[string]struct{}{"join": {}, "first": {}, "last": {}, "uniq": {}, "sort": {}}
+
+// stringFuncs are the template functions that take a text as the last argument.
+var stringFuncs = map[string]struct{}{
+	"upper": {}, "lower": {}, "trim": {}, "replace": {}, "indent": {}, "wrap": {}, "truncate": {},
+	"regexMatch": {}, "regexReplace": {},
+}
+
+// toText converts a template value to text. Values of arguments parsed as JSON may be of any type.
+func toText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func upperFunc(text interface{}) string {
+	return strings.ToUpper(toText(text))
+}
+
+func lowerFunc(text interface{}) string {
+	return strings.ToLower(toText(text))
+}
+
+func trimFunc(text interface{}) string {
+	return strings.TrimSpace(toText(text))
+}
+
+func replaceFunc(old, replacement string, text interface{}) string {
+	return strings.ReplaceAll(toText(text), old, replacement)
+}
+
+func indentFunc(width int, text interface{}) string {
+	prefix := strings.Repeat(" ", width)
+	lines := strings.Split(toText(text), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// wrapFunc wraps every line of the text separately, so paragraphs and lists keep their line breaks.
+// Words longer than the width are not broken.
+func wrapFunc(width int, text interface{}) string {
+	lines := strings.Split(toText(text), "\n")
+	for i, line := range lines {
+		var sb strings.Builder
+		lineLen := 0
+		for _, word := range strings.Fields(line) {
+			wordLen := utf8.RuneCountInString(word)
+			if lineLen != 0 && lineLen+1+wordLen > width {
+				sb.WriteByte('\n')
+				lineLen = 0
+			} else if lineLen != 0 {
+				sb.WriteByte(' ')
+				lineLen++
+			}
+			sb.WriteString(word)
+			lineLen += wordLen
+		}
+		lines[i] = sb.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func truncateFunc(length int, text interface{}) string {
+	const ellipsis = "..."
+	runes := []rune(toText(text))
+	if len(runes) <= length {
+		return string(runes)
+	}
+	if length <= len(ellipsis) {
+		return string(runes[:max(length, 0)])
+	}
+	return string(runes[:length-len(ellipsis)]) + ellipsis
+}
+
+func listFunc(values ...interface{}) []interface{} {
+	return append([]interface{}{}, values...)
+}
+
+// toList converts a list or array of any element type to a list of values.
+func toList(list interface{}) ([]interface{}, error) {
+	if list == nil {
+		return nil, nil
+	}
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("expected a list, got %T", list)
+	}
+	values := make([]interface{}, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		values = append(values, v.Index(i).Interface())
+	}
+	return values, nil
+}
+
+func joinFunc(separator string, list interface{}) (string, error) {
+	values, err := toList(list)
+	if err != nil {
+		return "", err
+	}
+	texts := make([]string, 0, len(values))
+	for _, value := range values {
+		texts = append(texts, toText(value))
+	}
+	return strings.Join(texts, separator), nil
+}
+
+func firstFunc(list interface{}) (interface{}, error) {
+	values, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return "", nil
+	}
+	return values[0], nil
+}
+
+func lastFunc(list interface{}) (interface{}, error) {
+	values, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return "", nil
+	}
+	return values[len(values)-1], nil
+}
+
+func uniqFunc(list interface{}) ([]interface{}, error) {
+	values, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		duplicate := false
+		for _, seen := range result {
+			if reflect.DeepEqual(seen, value) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			result = append(result, value)
+		}
+	}
+	return result, nil
+}
+
+func sortFunc(list interface{}) ([]interface{}, error) {
+	values, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	sorted := append([]interface{}{}, values...)
+	allNumbers := true
+	for _, value := range sorted {
+		if _, err = toNumber(value); err != nil {
+			allNumbers = false
+			break
+		}
+	}
+	if allNumbers {
+		sort.SliceStable(sorted, func(i, j int) bool {
+			a, _ := toNumber(sorted[i])
+			b, _ := toNumber(sorted[j])
+			return a < b
+		})
+		return sorted, nil
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return toText(sorted[i]) < toText(sorted[j]) })
+	return sorted, nil
+}
+
+// isEmpty reports whether the value is missing, false, zero, or an empty text, list or map.
+func isEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	default:
+		return v.IsZero()
+	}
+}
+
+func defaultFunc(defaultValue, value interface{}) interface{} {
+	if isEmpty(value) {
+		return defaultValue
+	}
+	return value
+}
+
+func coalesceFunc(values ...interface{}) interface{} {
+	for _, value := range values {
+		if !isEmpty(value) {
+			return value
+		}
+	}
+	return ""
+}
+
+func requiredFunc(msg string, value interface{}) (interface{}, error) {
+	if isEmpty(value) {
+		return nil, errors.New(msg)
+	}
+	return value, nil
+}
+
+func toJSONFunc(value interface{}) (string, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+func fromJSONFunc(text interface{}) (interface{}, error) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(toText(text)), &value); err != nil {
+		return nil, fmt.Errorf("decode JSON: %w", err)
+	}
+	return value, nil
+}
+
+func toYAMLFunc(value interface{}) (string, error) {
+	encoded, err := yaml.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(encoded), "\n"), nil
+}
+
+// number is a numeric template value. Integers are kept apart from floats, so integer arithmetic stays exact.
+type number struct {
+	isInt bool
+	i     int64
+	f     float64
+}
+
+// toNumberValue converts a template value to a number. Texts are parsed, since arguments may be passed as strings.
+func toNumberValue(value interface{}) (number, error) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return number{isInt: true, i: v.Int(), f: float64(v.Int())}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return number{isInt: true, i: int64(v.Uint()), f: float64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return number{f: v.Float()}, nil
+	case reflect.String:
+		n := json.Number(strings.TrimSpace(v.String()))
+		if i, err := n.Int64(); err == nil {
+			return number{isInt: true, i: i, f: float64(i)}, nil
+		}
+		if f, err := n.Float64(); err == nil {
+			return number{f: f}, nil
+		}
+	}
+	return number{}, fmt.Errorf("expected a number, got %v (%T)", value, value)
+}
+
+func toNumber(value interface{}) (float64, error) {
+	n, err := toNumberValue(value)
+	return n.f, err
+}
+
+func toNumbers(values []interface{}) ([]number, bool, error) {
+	numbers := make([]number, 0, len(values))
+	allInts := true
+	for _, value := range values {
+		n, err := toNumberValue(value)
+		if err != nil {
+			return nil, false, err
+		}
+		allInts = allInts && n.isInt
+		numbers = append(numbers, n)
+	}
+	return numbers, allInts, nil
+}
+
+// reduceNumbers applies the operation to the numbers in order. The result is an integer if all numbers are integers.
+func reduceNumbers(
+	values []interface{}, intOp func(a, b int64) int64, floatOp func(a, b float64) float64,
+) (interface{}, error) {
+	if len(values) == 0 {
+		return nil, errors.New("at least one number is required")
+	}
+	numbers, allInts, err := toNumbers(values)
+	if err != nil {
+		return nil, err
+	}
+	if allInts {
+		result := numbers[0].i
+		for _, n := range numbers[1:] {
+			result = intOp(result, n.i)
+		}
+		return result, nil
+	}
+	result := numbers[0].f
+	for _, n := range numbers[1:] {
+		result = floatOp(result, n.f)
+	}
+	return result, nil
+}
+
+func addFunc(a, b interface{}, rest ...interface{}) (interface{}, error) {
+	return reduceNumbers(append([]interface{}{a, b}, rest...),
+		func(a, b int64) int64 { return a + b }, func(a, b float64) float64 { return a + b })
+}
+
+func subFunc(a, b interface{}) (interface{}, error) {
+	return reduceNumbers([]interface{}{a, b},
+		func(a, b int64) int64 { return a - b }, func(a, b float64) float64 { return a - b })
+}
+
+func mulFunc(a, b interface{}, rest ...interface{}) (interface{}, error) {
+	return reduceNumbers(append([]interface{}{a, b}, rest...),
+		func(a, b int64) int64 { return a * b }, func(a, b float64) float64 { return a * b })
+}
+
+func divFunc(a, b interface{}) (interface{}, error) {
+	divisor, err := toNumber(b)
+	if err != nil {
+		return nil, err
+	}
+	if divisor == 0 {
+		return nil, errors.New("division by zero")
+	}
+	return reduceNumbers([]interface{}{a, b},
+		func(a, b int64) int64 { return a / b }, func(a, b float64) float64 { return a / b })
+}
+
+func modFunc(a, b interface{}) (interface{}, error) {
+	numbers, allInts, err := toNumbers([]interface{}{a, b})
+	if err != nil {
+		return nil, err
+	}
+	if !allInts {
+		return nil, errors.New("mod requires integers")
+	}
+	if numbers[1].i == 0 {
+		return nil, errors.New("division by zero")
+	}
+	return numbers[0].i % numbers[1].i, nil
+}
+
+func minFunc(a interface{}, rest ...interface{}) (interface{}, error) {
+	return reduceNumbers(append([]interface{}{a}, rest...), func(a, b int64) int64 { return min(a, b) }, math.Min)
+}
+
+func maxFunc(a interface{}, rest ...interface{}) (interface{}, error) {
+	return reduceNumbers(append([]interface{}{a}, rest...), func(a, b int64) int64 { return max(a, b) }, math.Max)
+}
+
+func regexMatchFunc(pattern string, text interface{}) (bool, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, fmt.Errorf("compile regular expression: %w", err)
+	}
+	return re.MatchString(toText(text)), nil
+}
+
+func regexReplaceFunc(pattern, replacement string, text interface{}) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("compile regular expression: %w", err)
+	}
+	return re.ReplaceAllString(toText(text), replacement), nil
+}
+
+// writeTemplateFunctions writes the library of template functions in the output format.
+func writeTemplateFunctions(w io.Writer, format string) error {
+	switch format {
+	case outputFormatJSON:
+		return writeJSON(w, templateFunctions)
+	case outputFormatMarkdown:
+		rows := make([][]string, 0, len(templateFunctions))
+		for _, f := range templateFunctions {
+			rows = append(rows, []string{f.Category, "`" + f.Signature + "`", f.Description})
+		}
+		return writeMarkdownTable(w, []string{"Category", "Signature", "Description"}, rows)
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "CATEGORY\tSIGNATURE\tDESCRIPTION")
+		for _, f := range templateFunctions {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", f.Category, f.Signature, f.Description)
+		}
+		return tw.Flush()
+	}
+}
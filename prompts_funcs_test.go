@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTemplateFunctions tests the functions available in prompt templates
+func (s *PromptsParserTestSuite) TestTemplateFunctions() {
+	data := map[string]interface{}{
+		"name":    "Alice",
+		"blank":   "",
+		"code":    "a := 1\n\nb := 2",
+		"text":    "The quick brown fox jumps over the lazy dog",
+		"tags":    []interface{}{"go", "mcp", "go", "ai"},
+		"numbers": []interface{}{float64(10), int64(2), "7"},
+		"count":   int64(3),
+		"ratio":   1.5,
+		"config":  map[string]interface{}{"debug": true},
+		"json":    `{"items": [1, 2]}`,
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{name: "upper", template: `{{upper .name}}`, expected: "ALICE"},
+		{name: "lower", template: `{{.name | lower}}`, expected: "alice"},
+		{name: "trim", template: `[{{trim "  x \n"}}]`, expected: "[x]"},
+		{name: "replace", template: `{{replace "o" "0" .text}}`, expected: "The quick br0wn f0x jumps 0ver the lazy d0g"},
+		{name: "indent", template: `{{indent 2 .code}}`, expected: "  a := 1\n\n  b := 2"},
+		{name: "wrap", template: `{{wrap 16 .text}}`, expected: "The quick brown\nfox jumps over\nthe lazy dog"},
+		{name: "wrap long words", template: `{{wrap 3 "abcdef gh"}}`, expected: "abcdef\ngh"},
+		{name: "truncate", template: `{{truncate 10 .text}}`, expected: "The qui..."},
+		{name: "truncate short text", template: `{{truncate 10 .name}}`, expected: "Alice"},
+		{name: "truncate to tiny length", template: `{{truncate 2 .name}}`, expected: "Al"},
+		{name: "string functions accept numbers", template: `{{upper .ratio}}`, expected: "1.5"},
+
+		{name: "list and join", template: `{{list "a" 1 true | join ", "}}`, expected: "a, 1, true"},
+		{name: "first and last", template: `{{first .tags}} {{last .tags}}`, expected: "go ai"},
+		{name: "first of empty list", template: `[{{first (list)}}]`, expected: "[]"},
+		{name: "coalesce of empty values", template: `[{{coalesce .missing .blank}}]`, expected: "[]"},
+		{name: "uniq", template: `{{uniq .tags | join ","}}`, expected: "go,mcp,ai"},
+		{name: "sort texts", template: `{{sort .tags | join ","}}`, expected: "ai,go,go,mcp"},
+		{name: "sort numbers", template: `{{sort .numbers | join ","}}`, expected: "2,7,10"},
+
+		{name: "default for missing value", template: `{{.missing | default "none"}}`, expected: "none"},
+		{name: "default for empty value", template: `{{default "none" .blank}}`, expected: "none"},
+		{name: "default for set value", template: `{{default "none" .name}}`, expected: "Alice"},
+		{name: "coalesce", template: `{{coalesce .missing .blank .name}}`, expected: "Alice"},
+		{name: "empty", template: `{{empty .blank}} {{empty .tags}} {{empty 0}} {{empty .config}}`,
+			expected: "true false true false"},
+		{name: "required", template: `{{required "name is required" .name}}`, expected: "Alice"},
+
+		{name: "toJson", template: `{{toJson .config}}`, expected: `{"debug":true}`},
+		{name: "fromJson", template: `{{range (fromJson .json).items}}{{.}};{{end}}`, expected: "1;2;"},
+		{name: "toYaml", template: `{{toYaml .config}}`, expected: "debug: true"},
+
+		{name: "add integers", template: `{{add 1 .count "2"}}`, expected: "6"},
+		{name: "add floats", template: `{{add .count .ratio}}`, expected: "4.5"},
+		{name: "sub", template: `{{sub .count 5}}`, expected: "-2"},
+		{name: "mul", template: `{{mul 2 .count 2}}`, expected: "12"},
+		{name: "integer div", template: `{{div 7 2}}`, expected: "3"},
+		{name: "float div", template: `{{div 3 .ratio}}`, expected: "2"},
+		{name: "mod", template: `{{mod 7 .count}}`, expected: "1"},
+		{name: "min and max", template: `{{min 3 1 2}} {{max 3 .ratio}}`, expected: "1 3"},
+
+		{name: "regexMatch", template: `{{regexMatch "^[A-Z][a-z]+$" .name}}`, expected: "true"},
+		{name: "regexReplace", template: `{{regexReplace "(\\w+)@(\\w+)" "$2 at $1" "bob@example"}}`,
+			expected: "example at bob"},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			tmpl, err := template.New("test").Funcs(templateFuncs()).Parse(tt.template)
+			require.NoError(s.T(), err, "Failed to parse template")
+			var buf bytes.Buffer
+			require.NoError(s.T(), tmpl.Execute(&buf, data), "Failed to execute template")
+			assert.Equal(s.T(), tt.expected, buf.String())
+		})
+	}
+
+	errorTests := []struct {
+		name        string
+		template    string
+		expectedErr string
+	}{
+		{name: "required", template: `{{required "name is required" .blank}}`, expectedErr: "name is required"},
+		{name: "join of non-list", template: `{{join "," .name}}`, expectedErr: "expected a list, got string"},
+		{name: "fromJson of invalid JSON", template: `{{fromJson .name}}`, expectedErr: "decode JSON"},
+		{name: "add non-number", template: `{{add 1 .name}}`, expectedErr: "expected a number, got Alice (string)"},
+		{name: "division by zero", template: `{{div 1 0}}`, expectedErr: "division by zero"},
+		{name: "mod of floats", template: `{{mod .ratio 1}}`, expectedErr: "mod requires integers"},
+		{name: "invalid regular expression", template: `{{regexMatch "(" .name}}`, expectedErr: "compile regular expression"},
+	}
+	for _, tt := range errorTests {
+		s.Run(tt.name, func() {
+			tmpl, err := template.New("test").Funcs(templateFuncs()).Parse(tt.template)
+			require.NoError(s.T(), err, "Failed to parse template")
+			err = tmpl.Execute(&bytes.Buffer{}, data)
+			require.Error(s.T(), err, "Expected execution error")
+			assert.Contains(s.T(), err.Error(), tt.expectedErr)
+		})
+	}
+}
+
+// TestWriteTemplateFunctions tests listing of the template functions
+func (s *PromptsParserTestSuite) TestWriteTemplateFunctions() {
+	var buf bytes.Buffer
+	require.NoError(s.T(), writeTemplateFunctions(&buf, outputFormatJSON), "writeTemplateFunctions() unexpected error")
+	var functions []templateFunction
+	require.NoError(s.T(), json.Unmarshal(buf.Bytes(), &functions), "Failed to unmarshal functions")
+	require.Len(s.T(), functions, len(templateFuncs()), "Every function should be listed")
+	for _, f := range functions {
+		assert.True(s.T(), strings.HasPrefix(f.Signature, f.Name), "Signature of %q should start with its name", f.Name)
+		assert.NotEmpty(s.T(), f.Description, "Function %q should be described", f.Name)
+	}
+
+	buf.Reset()
+	require.NoError(s.T(), writeTemplateFunctions(&buf, outputFormatMarkdown), "writeTemplateFunctions() unexpected error")
+	assert.Contains(s.T(), buf.String(), "| list | `join SEPARATOR LIST` | Elements of the list joined with the separator |\n")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// gitBuiltIn is the built-in data field with the state of the git repository, e.g. {{.git.branch}}.
+const gitBuiltIn = "git"
+
+// gitFieldCommands are the git commands computing the fields of the git built-in data.
+var gitFieldCommands = map[string][]string{
+	// branch is the name of the current branch, or "HEAD" if it is detached
+	"branch": {"rev-parse", "--abbrev-ref", "HEAD"},
+	// head is the hash of the current commit
+	"head": {"rev-parse", "HEAD"},
+	// status lists changed and untracked files in the short format
+	"status": {"status", "--short"},
+	// diff is the diff of the staged and unstaged changes against the current commit
+	"diff": {"diff", "HEAD"},
+	// log lists the last commits, one per line
+	"log": {"log", "--oneline", "-n", "10"},
+}
+
+// errGitNotConfigured is returned when the git built-in data is referenced but no repository is configured.
+var errGitNotConfigured = errors.New("git repository is not configured")
+
+// gitRepository computes the git built-in data of templates. Git commands are run by a command executor
+// allowing only the commands of gitFieldCommands, so they have the same timeout, output limit and audit logging
+// as commands run with exec.
+type gitRepository struct {
+	executor *commandExecutor
+}
+
+// WithGitDir sets the directory of the repository the git built-in data is computed from.
+func WithGitDir(dir string) PromptsServerOption {
+	return func(ps *PromptsServer) {
+		ps.gitDir = dir
+	}
+}
+
+// newGitRepository returns a gitRepository for the directory, or for the current directory if it is empty.
+func newGitRepository(dir string, timeout time.Duration, maxOutput int, logger *slog.Logger) *gitRepository {
+	allowed := make([]string, 0, len(gitFieldCommands))
+	for _, args := range gitFieldCommands {
+		allowed = append(allowed, strings.Join(append([]string{"git"}, args...), " "))
+	}
+	return &gitRepository{executor: newCommandExecutor(allowed, timeout, maxOutput, dir, logger)}
+}
+
+// gitFields returns the sorted fields of the git built-in data referenced by a template, given the built-in data
+// it references. All fields are returned if the whole git data is referenced.
+func gitFields(builtIns []string) []string {
+	fieldsSet := make(map[string]struct{})
+	for _, builtIn := range builtIns {
+		parts := strings.Split(builtIn, ".")
+		if parts[0] != gitBuiltIn {
+			continue
+		}
+		if len(parts) == 1 {
+			for field := range gitFieldCommands {
+				fieldsSet[field] = struct{}{}
+			}
+			continue
+		}
+		if _, known := gitFieldCommands[parts[1]]; known {
+			fieldsSet[parts[1]] = struct{}{}
+		}
+	}
+	return sortedKeys(fieldsSet)
+}
+
+// data computes the fields of the git built-in data for the prompt. Only the given fields are computed,
+// since some of them, like diff, may be expensive.
+func (g *gitRepository) data(ctx context.Context, promptName string, fields []string) (map[string]interface{}, error) {
+	if g == nil {
+		return nil, errGitNotConfigured
+	}
+	data := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		commandLine := append([]string{"git"}, gitFieldCommands[field]...)
+		output, err := g.executor.run(ctx, promptName, commandLine)
+		if err != nil {
+			return nil, fmt.Errorf("compute git %s: %w", field, err)
+		}
+		data[field] = output
+	}
+	return data, nil
+}
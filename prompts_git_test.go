@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGitFields tests selection of the git fields referenced by templates
+func (s *PromptsServerTestSuite) TestGitFields() {
+	tests := []struct {
+		name     string
+		builtIns []string
+		expected []string
+	}{
+		{name: "no git data", builtIns: []string{"date"}, expected: nil},
+		{name: "referenced fields", builtIns: []string{"date", "git.head", "git.branch"}, expected: []string{"branch", "head"}},
+		{name: "nested field", builtIns: []string{"git.log.first"}, expected: []string{"log"}},
+		{name: "unknown field", builtIns: []string{"git.unknown"}, expected: nil},
+		{name: "whole git data", builtIns: []string{"git", "git.diff"}, expected: []string{"branch", "diff", "head", "log", "status"}},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			assert.Equal(s.T(), tt.expected, gitFields(tt.builtIns))
+		})
+	}
+}
+
+// TestServeStdioWithGitBuiltIns tests rendering prompts that reference the git built-in data
+func (s *PromptsServerTestSuite) TestServeStdioWithGitBuiltIns() {
+	ctx := context.Background()
+
+	repoDir := filepath.Join(s.tempDir, "repo")
+	require.NoError(s.T(), os.MkdirAll(repoDir, 0755), "Failed to create repository directory")
+	runGit := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repoDir
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com")
+		output, err := cmd.CombinedOutput()
+		require.NoError(s.T(), err, "git %v failed: %s", args, output)
+		return string(bytes.TrimSpace(output))
+	}
+	runGit("init", "-q", "-b", "feature")
+	require.NoError(s.T(), os.WriteFile(filepath.Join(repoDir, "main.go"), []byte("package main\n"), 0644),
+		"Failed to write repository file")
+	runGit("add", "main.go")
+	runGit("commit", "-q", "-m", "Initial commit")
+	require.NoError(s.T(), os.WriteFile(filepath.Join(repoDir, "new.go"), []byte("package main\n"), 0644),
+		"Failed to write repository file")
+	head := runGit("rev-parse", "HEAD")
+
+	promptsDir := filepath.Join(s.tempDir, "prompts")
+	require.NoError(s.T(), os.MkdirAll(promptsDir, 0755), "Failed to create prompts directory")
+	require.NoError(s.T(), os.WriteFile(filepath.Join(promptsDir, "branch.tmpl"),
+		[]byte("{{with .git}}On {{.branch}} at {{.head}}:\n{{.status}}{{end}}"), 0644), "Failed to write prompt file")
+
+	var logBuf bytes.Buffer
+	s.logger = slog.New(slog.NewTextHandler(&logBuf, nil))
+	_, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, promptsDir, true, WithGitDir(repoDir))
+	defer promptsClose()
+
+	listResult, err := mcpClient.ListPrompts(ctx, mcp.ListPromptsRequest{})
+	require.NoError(s.T(), err, "ListPrompts failed")
+	require.Len(s.T(), listResult.Prompts, 1, "Expected exactly 1 prompt")
+	assert.Empty(s.T(), listResult.Prompts[0].Arguments, "Git data should not be an argument")
+
+	var getReq mcp.GetPromptRequest
+	getReq.Params.Name = "branch"
+	getResult, err := mcpClient.GetPrompt(ctx, getReq)
+	require.NoError(s.T(), err, "GetPrompt failed")
+	require.Len(s.T(), getResult.Messages, 1, "Expected exactly 1 message")
+	content, ok := getResult.Messages[0].Content.(mcp.TextContent)
+	require.True(s.T(), ok, "Expected TextContent")
+	assert.Equal(s.T(), "On feature at "+head+":\n?? new.go", content.Text, "Unexpected message content")
+
+	assert.Contains(s.T(), logBuf.String(), `command="[git status --short]"`, "Git commands should be logged")
+	assert.NotContains(s.T(), logBuf.String(), `command="[git diff HEAD]"`, "Unreferenced git data should not be computed")
+
+	// Rendering fails if the git data cannot be computed
+	_, mcpClient, promptsClose = s.makePromptsServerAndClient(ctx, promptsDir, true, WithGitDir(s.tempDir))
+	defer promptsClose()
+	_, err = mcpClient.GetPrompt(ctx, getReq)
+	require.Error(s.T(), err, "GetPrompt should fail outside a git repository")
+	assert.Contains(s.T(), err.Error(), "compute git branch")
+}
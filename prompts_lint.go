@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"unicode/utf8"
+)
+
+// Severities of lint issues.
+const (
+	lintSeverityError   = "error"
+	lintSeverityWarning = "warning"
+)
+
+// Rules checked by the linter.
+const (
+	lintRuleLoadError          = "load-error"
+	lintRuleSyntaxError        = "syntax-error"
+	lintRuleCyclicPartial      = "cyclic-partial"
+	lintRuleUndefinedPartial   = "undefined-partial"
+	lintRuleUnusedPartial      = "unused-partial"
+	lintRuleMissingDescription = "missing-description"
+	lintRuleBuiltInArgument    = "builtin-argument"
+	lintRuleArgumentCase       = "argument-case"
+	lintRuleSystemMessage      = "system-message"
+)
+
+// LintIssue is a problem found in a template file. Line and Column are 1-based and zero when unknown.
+type LintIssue struct {
+	Path     string `json:"path"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity"`
+	Rule     string `json:"rule"`
+	Message  string `json:"message"`
+}
+
+// String formats the issue as "path:line:col: severity: message (rule)".
+func (i LintIssue) String() string {
+	location := i.Path
+	if i.Line != 0 {
+		location += ":" + strconv.Itoa(i.Line)
+		if i.Column != 0 {
+			location += ":" + strconv.Itoa(i.Column)
+		}
+	}
+	return fmt.Sprintf("%s: %s: %s (%s)", location, i.Severity, i.Message, i.Rule)
+}
+
+// lintFile is a template file parsed on its own, so issues can be attributed to it.
+type lintFile struct {
+	TemplateFile
+	body []byte
+	// lineOffset is the number of front matter lines preceding the body
+	lineOffset int
+	// templates are the templates defined in the file, including the file itself
+	templates []*template.Template
+}
+
+// isPartial reports whether the file is a partial rather than a prompt.
+func (lf *lintFile) isPartial() bool {
+	return strings.HasPrefix(path.Base(lf.RelPath), "_")
+}
+
+// position returns the line and column of the byte offset in the body of the file.
+func (lf *lintFile) position(offset int) (line, col int) {
+	if offset > len(lf.body) {
+		offset = len(lf.body)
+	}
+	lineStart := bytes.LastIndexByte(lf.body[:offset], '\n') + 1
+	line = bytes.Count(lf.body[:offset], []byte("\n")) + 1 + lf.lineOffset
+	return line, utf8.RuneCount(lf.body[lineStart:offset]) + 1
+}
+
+// Lint checks the templates in the directories, overlaid as by ParseDir, and returns the issues found sorted
+// by path and position. Syntax errors, load errors, cyclic and undefined partial references are errors;
+// unused partials, prompts without a description, suspicious argument names and system messages are warnings.
+func (pp *PromptsParser) Lint(promptsDirs ...string) ([]LintIssue, error) {
+	files, err := pp.ListTemplateFiles(promptsDirs...)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := pp.ParseDir(promptsDirs...)
+	var templateErrs TemplateErrors
+	if err != nil && !errors.As(err, &templateErrs) {
+		return nil, err
+	}
+
+	var issues []LintIssue
+	var lintFiles []*lintFile
+	for _, file := range files {
+		lf, issue := pp.parseLintFile(file)
+		if issue != nil {
+			issues = append(issues, *issue)
+			continue
+		}
+		lintFiles = append(lintFiles, lf)
+	}
+
+	// owners maps names of templates to the files defining them, the same way ParseDir registers them
+	owners := make(map[string]*lintFile)
+	for _, lf := range lintFiles {
+		for _, t := range lf.templates {
+			owners[t.Name()] = lf
+		}
+	}
+	for _, lf := range lintFiles {
+		alias := strings.TrimSuffix(lf.RelPath, templateExt)
+		if _, exists := owners[alias]; !exists && strings.Contains(alias, "/") {
+			owners[alias] = lf
+		}
+	}
+	lookupOwner := func(name string) *lintFile {
+		if lf, ok := owners[name]; ok {
+			return lf
+		}
+		return owners[name+templateExt]
+	}
+
+	// references maps files to the files defining the templates they call
+	references := make(map[*lintFile][]*lintFile)
+	for _, lf := range lintFiles {
+		for _, t := range lf.templates {
+			for _, node := range templateCalls(t.Root) {
+				if referenced := lookupOwner(node.Name); referenced != nil {
+					references[lf] = append(references[lf], referenced)
+					continue
+				}
+				line, col := lf.position(int(node.Position()))
+				issues = append(issues, LintIssue{
+					Path: lf.Path(), Line: line, Column: col, Severity: lintSeverityError, Rule: lintRuleUndefinedPartial,
+					Message: fmt.Sprintf("template %q is not defined", node.Name),
+				})
+			}
+		}
+	}
+
+	// MCP prompts have no system role, so system messages are sent as user messages
+	for _, lf := range lintFiles {
+		for _, t := range lf.templates {
+			for _, node := range functionCalls(t.Root, "message") {
+				if len(node.Args) < 2 {
+					continue
+				}
+				if role, ok := node.Args[1].(*parse.StringNode); ok && role.Text == messageRoleSystem {
+					line, col := lf.position(int(node.Position()))
+					issues = append(issues, LintIssue{
+						Path: lf.Path(), Line: line, Column: col, Severity: lintSeverityWarning, Rule: lintRuleSystemMessage,
+						Message: "system messages are sent with the user role, since MCP prompts have no system role",
+					})
+				}
+			}
+		}
+	}
+
+	used := make(map[*lintFile]bool)
+	var queue []*lintFile
+	for _, lf := range lintFiles {
+		if !lf.isPartial() {
+			used[lf] = true
+			queue = append(queue, lf)
+		}
+	}
+	for len(queue) != 0 {
+		lf := queue[0]
+		queue = queue[1:]
+		for _, referenced := range references[lf] {
+			if !used[referenced] {
+				used[referenced] = true
+				queue = append(queue, referenced)
+			}
+		}
+	}
+
+	for _, lf := range lintFiles {
+		if lf.isPartial() {
+			if !used[lf] {
+				issues = append(issues, LintIssue{
+					Path: lf.Path(), Severity: lintSeverityWarning, Rule: lintRuleUnusedPartial,
+					Message: "partial is not used by any prompt",
+				})
+			}
+			continue
+		}
+		issues = append(issues, pp.lintPrompt(tmpl, lf)...)
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Path != issues[j].Path {
+			return issues[i].Path < issues[j].Path
+		}
+		if issues[i].Line != issues[j].Line {
+			return issues[i].Line < issues[j].Line
+		}
+		return issues[i].Column < issues[j].Column
+	})
+	return issues, nil
+}
+
+// parseLintFile parses the template file on its own. The issue is returned if the file cannot be loaded.
+func (pp *PromptsParser) parseLintFile(file TemplateFile) (*lintFile, *LintIssue) {
+	loadIssue := func(err error) *LintIssue {
+		return &LintIssue{Path: file.Path(), Severity: lintSeverityError, Rule: lintRuleLoadError, Message: err.Error()}
+	}
+
+	content, err := os.ReadFile(file.Path())
+	if err != nil {
+		return nil, loadIssue(fmt.Errorf("read file: %w", err))
+	}
+	_, body, err := splitFrontMatter(content)
+	if err != nil {
+		return nil, loadIssue(fmt.Errorf("split front matter: %w", err))
+	}
+	lf := &lintFile{
+		TemplateFile: file,
+		body:         body,
+		lineOffset:   bytes.Count(content[:len(content)-len(body)], []byte("\n")),
+	}
+	if _, err = pp.ExtractPromptMetadataFromFile(file.Path()); err != nil {
+		return nil, loadIssue(err)
+	}
+
+	fileTmpl, err := template.New(file.RelPath).Funcs(pp.templateFuncs()).Parse(string(body))
+	if err != nil {
+		issue := &LintIssue{Path: file.Path(), Severity: lintSeverityError, Rule: lintRuleSyntaxError, Message: err.Error()}
+		if offset, ok := pp.syntaxErrorOffset(file.RelPath, body, err); ok {
+			issue.Line, issue.Column = lf.position(offset)
+		}
+		issue.Message = strings.TrimPrefix(issue.Message, "template: ")
+		if _, msg, found := strings.Cut(issue.Message, ": "); found && issue.Line != 0 {
+			issue.Message = msg
+		}
+		return nil, issue
+	}
+	for _, t := range fileTmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		if err = resolveTemplateReferences(t.Root, path.Dir(file.RelPath)); err != nil {
+			return nil, loadIssue(fmt.Errorf("resolve template references: %w", err))
+		}
+		lf.templates = append(lf.templates, t)
+	}
+	return lf, nil
+}
+
+// lintPrompt checks the description and arguments of the prompt defined by the file.
+func (pp *PromptsParser) lintPrompt(tmpl *template.Template, lf *lintFile) []LintIssue {
+	var issues []LintIssue
+	addIssue := func(severity, rule, msg string) {
+		issues = append(issues, LintIssue{Path: lf.Path(), Severity: severity, Rule: rule, Message: msg})
+	}
+
+	metadata, err := pp.ExtractPromptMetadataFromFile(lf.Path())
+	if err != nil {
+		addIssue(lintSeverityError, lintRuleLoadError, err.Error())
+		return issues
+	}
+	if metadata.Description == "" {
+		addIssue(lintSeverityWarning, lintRuleMissingDescription, "prompt has no description")
+	}
+	declaredBuiltIns := make(map[string]struct{})
+	for _, argMeta := range metadata.Arguments {
+		if _, isBuiltIn := builtInArguments[strings.ToLower(argMeta.Name)]; isBuiltIn {
+			declaredBuiltIns[strings.ToLower(argMeta.Name)] = struct{}{}
+			addIssue(lintSeverityWarning, lintRuleBuiltInArgument, fmt.Sprintf(
+				"argument %q collides with the built-in field and is not exposed to clients", argMeta.Name))
+		}
+	}
+
+	templateName := strings.TrimSuffix(lf.RelPath, templateExt)
+	if tmpl.Lookup(templateName) == nil {
+		templateName = lf.RelPath
+	}
+	args, err := pp.ExtractPromptArgumentsFromTemplate(tmpl, templateName)
+	if err != nil {
+		rule := lintRuleLoadError
+		if errors.Is(err, errCyclicPartialReference) {
+			rule = lintRuleCyclicPartial
+		}
+		addIssue(lintSeverityError, rule, err.Error())
+		return issues
+	}
+	builtIns, err := pp.ExtractPromptBuiltInsFromTemplate(tmpl, templateName)
+	if err != nil {
+		addIssue(lintSeverityError, lintRuleLoadError, err.Error())
+		return issues
+	}
+	unknownGitFields := make(map[string]struct{})
+	for _, builtIn := range builtIns {
+		fields := strings.SplitN(builtIn, ".", 3)
+		if fields[0] != gitBuiltIn {
+			continue
+		}
+		// Templates written before the git data was added may use git as an argument
+		// without declaring it in the front matter
+		if len(fields) == 1 {
+			if _, declared := declaredBuiltIns[gitBuiltIn]; declared {
+				continue
+			}
+			addIssue(lintSeverityWarning, lintRuleBuiltInArgument, fmt.Sprintf(
+				"field %q referenced by the template is the built-in git data, not an argument; "+
+					"reference its fields, e.g. .git.branch, or rename the argument", builtIn))
+			continue
+		}
+		if _, known := gitFieldCommands[fields[1]]; !known {
+			unknownGitFields[gitBuiltIn+"."+fields[1]] = struct{}{}
+		}
+	}
+	for _, field := range sortedKeys(unknownGitFields) {
+		addIssue(lintSeverityWarning, lintRuleBuiltInArgument, fmt.Sprintf(
+			"field %q is not a field of the built-in git data; known fields: %s",
+			field, strings.Join(gitFields([]string{gitBuiltIn}), ", ")))
+	}
+	for _, arg := range args {
+		var mismatched []string
+		for _, spelling := range arg.Spellings {
+			if spelling != arg.Name {
+				mismatched = append(mismatched, strconv.Quote(spelling))
+			}
+		}
+		if len(mismatched) != 0 {
+			addIssue(lintSeverityWarning, lintRuleArgumentCase, fmt.Sprintf(
+				"argument %q is referenced as %s; arguments are passed in lower case, so these fields are never set",
+				arg.Name, strings.Join(mismatched, ", ")))
+		}
+	}
+	return issues
+}
+
+// templateCalls returns all template actions within the node.
+func templateCalls(node parse.Node) []*parse.TemplateNode {
+	var calls []*parse.TemplateNode
+	var walk func(node parse.Node)
+	walkBranch := func(n *parse.BranchNode) {
+		walk(n.List)
+		walk(n.ElseList)
+	}
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.IfNode:
+			walkBranch(&n.BranchNode)
+		case *parse.RangeNode:
+			walkBranch(&n.BranchNode)
+		case *parse.WithNode:
+			walkBranch(&n.BranchNode)
+		case *parse.TemplateNode:
+			calls = append(calls, n)
+		}
+	}
+	walk(node)
+	return calls
+}
+
+// functionCalls returns all commands within the node that call the function with the name.
+func functionCalls(node parse.Node, name string) []*parse.CommandNode {
+	var calls []*parse.CommandNode
+	var walk func(node parse.Node)
+	walkBranch := func(n *parse.BranchNode) {
+		walk(n.Pipe)
+		walk(n.List)
+		walk(n.ElseList)
+	}
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walkBranch(&n.BranchNode)
+		case *parse.RangeNode:
+			walkBranch(&n.BranchNode)
+		case *parse.WithNode:
+			walkBranch(&n.BranchNode)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			if ident, ok := n.Args[0].(*parse.IdentifierNode); ok && ident.Ident == name {
+				calls = append(calls, n)
+			}
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		}
+	}
+	walk(node)
+	return calls
+}
+
+// syntaxErrorOffset returns the byte offset of the syntax error in the template body. text/template reports
+// only the line of a syntax error, so the error is located at the end of the shortest prefix of that line
+// that fails to parse with the same error.
+func (pp *PromptsParser) syntaxErrorOffset(name string, body []byte, parseErr error) (int, bool) {
+	var line int
+	if _, err := fmt.Sscanf(strings.TrimPrefix(parseErr.Error(), "template: "+name+":"), "%d:", &line); err != nil {
+		return 0, false
+	}
+	lineStart := 0
+	for i := 1; i < line; i++ {
+		idx := bytes.IndexByte(body[lineStart:], '\n')
+		if idx == -1 {
+			return 0, false
+		}
+		lineStart += idx + 1
+	}
+	lineEnd := len(body)
+	if idx := bytes.IndexByte(body[lineStart:], '\n'); idx != -1 {
+		lineEnd = lineStart + idx
+	}
+
+	for end := lineStart + 1; end <= lineEnd; end++ {
+		_, err := template.New(name).Funcs(pp.templateFuncs()).Parse(string(body[:end]))
+		if err != nil && err.Error() == parseErr.Error() {
+			return end - 1, true
+		}
+	}
+	return lineStart, true
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLint tests detection of issues in prompt templates
+func (s *PromptsParserTestSuite) TestLint() {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected []LintIssue
+	}{
+		{
+			name: "clean templates",
+			files: map[string]string{
+				"greeting.tmpl": "{{/* Greeting */}}\n{{template \"_header\" .}}Hello {{.name}}",
+				"_header.tmpl":  "{{define \"_header\"}}Header{{end}}",
+			},
+		},
+		{
+			name: "syntax errors with positions",
+			files: map[string]string{
+				"action.tmpl":   "{{/* Action */}}\nHello {{if}}",
+				"function.tmpl": "---\ndescription: Function\n---\nHi\nHello {{foo .name}}",
+			},
+			expected: []LintIssue{
+				{Path: "action.tmpl", Line: 2, Column: 12, Severity: lintSeverityError, Rule: lintRuleSyntaxError,
+					Message: "missing value for if"},
+				{Path: "function.tmpl", Line: 5, Column: 11, Severity: lintSeverityError, Rule: lintRuleSyntaxError,
+					Message: `function "foo" not defined`},
+			},
+		},
+		{
+			name: "invalid front matter",
+			files: map[string]string{
+				"prompt.tmpl": "---\nunknown: field\n---\nHello",
+			},
+			expected: []LintIssue{
+				{Path: "prompt.tmpl", Severity: lintSeverityError, Rule: lintRuleLoadError,
+					Message: "decode front matter: yaml: unmarshal errors:\n  line 1: field unknown not found in type main.PromptMetadata"},
+			},
+		},
+		{
+			name: "invalid default values",
+			files: map[string]string{
+				"count.tmpl":    "---\narguments:\n  - name: count\n    type: integer\n    default: abc\n---\n{{.count}}",
+				"severity.tmpl": "---\narguments:\n  - name: severity\n    type: enum\n    enum: [low, high]\n    default: medium\n---\n{{.severity}}",
+			},
+			expected: []LintIssue{
+				{Path: "count.tmpl", Severity: lintSeverityError, Rule: lintRuleLoadError,
+					Message: `invalid default value of argument "count": expected integer, got string`},
+				{Path: "severity.tmpl", Severity: lintSeverityError, Rule: lintRuleLoadError,
+					Message: `invalid default value of argument "severity": must be one of: low, high`},
+			},
+		},
+		{
+			name: "undefined and cyclic partials",
+			files: map[string]string{
+				"prompt.tmpl": "{{/* Prompt */}}\n{{template \"_a\" .}}\n  {{template \"_missing\" .}}",
+				"_a.tmpl":     "{{define \"_a\"}}{{template \"_b\" .}}{{end}}",
+				"_b.tmpl":     "{{define \"_b\"}}{{template \"_a\" .}}{{end}}",
+			},
+			expected: []LintIssue{
+				{Path: "prompt.tmpl", Severity: lintSeverityError, Rule: lintRuleCyclicPartial,
+					Message: "cyclic partial reference detected: _a -> _b -> _a"},
+				{Path: "prompt.tmpl", Line: 3, Column: 14, Severity: lintSeverityError, Rule: lintRuleUndefinedPartial,
+					Message: `template "_missing" is not defined`},
+			},
+		},
+		{
+			name: "unused partials",
+			files: map[string]string{
+				"prompt.tmpl":         "{{/* Prompt */}}\n{{template \"_used\" .}}",
+				"_used.tmpl":          "{{define \"_used\"}}{{template \"shared/_nested\" .}}{{end}}",
+				"shared/_nested.tmpl": "Nested",
+				"_unused.tmpl":        "{{define \"_unused\"}}{{template \"_unused_dep\" .}}{{end}}",
+				"_unused_dep.tmpl":    "{{define \"_unused_dep\"}}Dependency{{end}}",
+			},
+			expected: []LintIssue{
+				{Path: "_unused.tmpl", Severity: lintSeverityWarning, Rule: lintRuleUnusedPartial,
+					Message: "partial is not used by any prompt"},
+				{Path: "_unused_dep.tmpl", Severity: lintSeverityWarning, Rule: lintRuleUnusedPartial,
+					Message: "partial is not used by any prompt"},
+			},
+		},
+		{
+			name: "prompt and argument warnings",
+			files: map[string]string{
+				"prompt.tmpl": "---\narguments:\n  - name: date\n---\nHello {{.UserName}} {{.username}} on {{.date}}",
+			},
+			expected: []LintIssue{
+				{Path: "prompt.tmpl", Severity: lintSeverityWarning, Rule: lintRuleMissingDescription,
+					Message: "prompt has no description"},
+				{Path: "prompt.tmpl", Severity: lintSeverityWarning, Rule: lintRuleBuiltInArgument,
+					Message: `argument "date" collides with the built-in field and is not exposed to clients`},
+				{Path: "prompt.tmpl", Severity: lintSeverityWarning, Rule: lintRuleArgumentCase,
+					Message: `argument "username" is referenced as "UserName"; ` +
+						`arguments are passed in lower case, so these fields are never set`},
+			},
+		},
+		{
+			name: "git argument",
+			files: map[string]string{
+				"prompt.tmpl": "---\ndescription: Review\narguments:\n  - name: git\n    description: Repository URL\n---\nReview {{.git}}",
+			},
+			expected: []LintIssue{
+				{Path: "prompt.tmpl", Severity: lintSeverityWarning, Rule: lintRuleBuiltInArgument,
+					Message: `argument "git" collides with the built-in field and is not exposed to clients`},
+			},
+		},
+		{
+			name: "git referenced by template",
+			files: map[string]string{
+				"prompt.tmpl": "{{/* Review */}}\nReview {{.git}} on {{.git.branch}}: {{.git.commit}} {{.git.author.name}}",
+			},
+			expected: []LintIssue{
+				{Path: "prompt.tmpl", Severity: lintSeverityWarning, Rule: lintRuleBuiltInArgument,
+					Message: `field "git" referenced by the template is the built-in git data, not an argument; ` +
+						`reference its fields, e.g. .git.branch, or rename the argument`},
+				{Path: "prompt.tmpl", Severity: lintSeverityWarning, Rule: lintRuleBuiltInArgument,
+					Message: `field "git.author" is not a field of the built-in git data; known fields: branch, diff, head, log, status`},
+				{Path: "prompt.tmpl", Severity: lintSeverityWarning, Rule: lintRuleBuiltInArgument,
+					Message: `field "git.commit" is not a field of the built-in git data; known fields: branch, diff, head, log, status`},
+			},
+		},
+		{
+			name: "system messages",
+			files: map[string]string{
+				"prompt.tmpl": "{{/* Prompt */}}\n{{message \"system\"}}Be brief.\n{{if .verbose}}{{message \"user\"}}{{end}}" +
+					"{{template \"_system\" .}}",
+				"_system.tmpl": "{{define \"_system\"}}{{if true}} {{message \"system\" | print}}{{end}}{{end}}",
+			},
+			expected: []LintIssue{
+				{Path: "_system.tmpl", Line: 1, Column: 35, Severity: lintSeverityWarning, Rule: lintRuleSystemMessage,
+					Message: "system messages are sent with the user role, since MCP prompts have no system role"},
+				{Path: "prompt.tmpl", Line: 2, Column: 3, Severity: lintSeverityWarning, Rule: lintRuleSystemMessage,
+					Message: "system messages are sent with the user role, since MCP prompts have no system role"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			testDir := filepath.Join(s.tempDir, tt.name)
+			for relPath, content := range tt.files {
+				filePath := filepath.Join(testDir, filepath.FromSlash(relPath))
+				require.NoError(s.T(), os.MkdirAll(filepath.Dir(filePath), 0755), "Failed to create directory")
+				require.NoError(s.T(), os.WriteFile(filePath, []byte(content), 0644), "Failed to write test file")
+			}
+
+			issues, err := s.parser.Lint(testDir)
+			require.NoError(s.T(), err, "Lint() unexpected error")
+			for i := range issues {
+				relPath, err := filepath.Rel(testDir, issues[i].Path)
+				require.NoError(s.T(), err, "Issue path should be in the test directory")
+				issues[i].Path = filepath.ToSlash(relPath)
+			}
+			assert.Equal(s.T(), tt.expected, issues, "Lint() returned unexpected issues")
+		})
+	}
+
+	_, err := s.parser.Lint(filepath.Join(s.tempDir, "missing"))
+	assert.Error(s.T(), err, "Lint() expected error for non-existent directory")
+}
+
+// TestLintWithParserFuncs tests that templates are linted with the template functions of the parser
+func (s *PromptsParserTestSuite) TestLintWithParserFuncs() {
+	content := "{{/* Custom */}}\n{{custom .name}} {{if}}"
+	require.NoError(s.T(), os.WriteFile(filepath.Join(s.tempDir, "custom.tmpl"), []byte(content), 0644),
+		"Failed to write test file")
+	parser := &PromptsParser{funcs: template.FuncMap{"custom": func(s string) string { return s }}}
+
+	issues, err := parser.Lint(s.tempDir)
+	require.NoError(s.T(), err, "Lint() unexpected error")
+	assert.Equal(s.T(), []LintIssue{
+		{Path: filepath.Join(s.tempDir, "custom.tmpl"), Line: 2, Column: 23, Severity: lintSeverityError,
+			Rule: lintRuleSyntaxError, Message: "missing value for if"},
+	}, issues, "Lint() should report only the syntax error after the function of the parser")
+}
+
+// TestLintIssueString tests formatting of lint issues
+func (s *PromptsParserTestSuite) TestLintIssueString() {
+	issue := LintIssue{Path: "a.tmpl", Line: 3, Column: 7, Severity: lintSeverityError, Rule: lintRuleSyntaxError, Message: "bad"}
+	assert.Equal(s.T(), "a.tmpl:3:7: error: bad (syntax-error)", issue.String())
+	issue.Column = 0
+	assert.Equal(s.T(), "a.tmpl:3: error: bad (syntax-error)", issue.String())
+	issue.Line = 0
+	assert.Equal(s.T(), "a.tmpl: error: bad (syntax-error)", issue.String())
+}
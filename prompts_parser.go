@@ -2,34 +2,349 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"text/template"
 	"text/template/parse"
+
+	"gopkg.in/yaml.v3"
 )
 
+const frontMatterDelimiter = "---"
+
+// builtInArguments are fields of the template data set by the server, so they are not prompt arguments.
+var builtInArguments = map[string]struct{}{"date": {}, "git": {}}
+
+// errCyclicPartialReference is returned when templates reference each other in a cycle.
+var errCyclicPartialReference = errors.New("cyclic partial reference detected")
+
+// PromptMetadata describes a prompt template. It is declared in an optional YAML front matter block
+// at the top of the template file, or falls back to the first-line comment for the description.
+type PromptMetadata struct {
+	Title       string                   `yaml:"title"`
+	Description string                   `yaml:"description"`
+	Tags        []string                 `yaml:"tags"`
+	Arguments   []PromptArgumentMetadata `yaml:"arguments"`
+}
+
+// PromptArgumentMetadata documents a single prompt argument in the front matter.
+type PromptArgumentMetadata struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	// Required overrides whether the argument is required. When omitted, arguments with a default value
+	// and arguments that are only used under if/with guards are optional.
+	Required *bool `yaml:"required"`
+	// Default is the value used when the argument is not provided by the client.
+	Default interface{} `yaml:"default"`
+	// ArgumentSchema declares the argument type and constraints used to validate and coerce argument values.
+	ArgumentSchema `yaml:",inline"`
+}
+
+// Argument returns the metadata declared for the argument with the given name, if any.
+func (m PromptMetadata) Argument(name string) (PromptArgumentMetadata, bool) {
+	for _, arg := range m.Arguments {
+		if strings.EqualFold(arg.Name, name) {
+			return arg, true
+		}
+	}
+	return PromptArgumentMetadata{}, false
+}
+
 type PromptsParser struct {
+	// funcs override the template functions of templateFuncs, e.g. with the file functions bound to allowed roots
+	funcs template.FuncMap
+}
+
+// templateFuncs returns the functions available in the parsed templates.
+func (pp *PromptsParser) templateFuncs() template.FuncMap {
+	return mergeFuncs(templateFuncs(), pp.funcs)
+}
+
+// TemplateFile is a template file found in one of the prompts directories.
+type TemplateFile struct {
+	// RelPath is the slash-separated path of the file relative to its prompts directory.
+	RelPath string
+	// Root is the prompts directory the file is loaded from.
+	Root string
+	// ShadowedRoots lists earlier prompts directories whose files with the same relative path are overridden.
+	ShadowedRoots []string
 }
 
-func (pp *PromptsParser) ParseDir(promptsDir string) (*template.Template, error) {
-	tmpl := template.New("base").Funcs(template.FuncMap{
-		"dict": dict,
-	})
-	var err error
-	tmpl, err = tmpl.ParseGlob(filepath.Join(promptsDir, "*"+templateExt))
+// Path returns the path of the template file on disk.
+func (tf TemplateFile) Path() string {
+	return filepath.Join(tf.Root, filepath.FromSlash(tf.RelPath))
+}
+
+// TemplateError is an error of loading a single template file.
+type TemplateError struct {
+	Path string
+	Err  error
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// TemplateErrors lists template files that failed to load. Other templates are loaded regardless of these errors.
+type TemplateErrors []*TemplateError
+
+func (e TemplateErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, templateErr := range e {
+		msgs = append(msgs, templateErr.Error())
+	}
+	return fmt.Sprintf("%d template file(s) failed to load: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// ParseDir parses all template files in the directories and their subdirectories into a single template set.
+// Directories are overlaid in order: a file in a later directory overrides the file with the same relative path
+// in earlier ones. Each file is registered under its slash-separated path relative to its directory
+// (e.g. "review/security.tmpl") and, for files in subdirectories, also under the same path without the extension.
+// Front matter is stripped from each file before its body is handed to text/template.
+//
+// Files are parsed individually, so a broken file does not prevent other files from loading. In this case
+// the template set of the successfully parsed files is returned together with a TemplateErrors error.
+func (pp *PromptsParser) ParseDir(promptsDirs ...string) (*template.Template, error) {
+	files, err := pp.ListTemplateFiles(promptsDirs...)
 	if err != nil {
-		return nil, fmt.Errorf("parse template glob %q: %w", filepath.Join(promptsDir, "*"+templateExt), err)
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no %s files found in %q", templateExt, promptsDirs)
+	}
+
+	tmpl := template.New("base").Funcs(pp.templateFuncs())
+	var templateErrs TemplateErrors
+	for _, file := range files {
+		if err = pp.parseFile(tmpl, file); err != nil {
+			templateErrs = append(templateErrs, &TemplateError{Path: file.Path(), Err: err})
+		}
+	}
+
+	// Allow partials in subdirectories to be referenced by their path without the extension
+	for _, file := range files {
+		alias := strings.TrimSuffix(file.RelPath, templateExt)
+		if !strings.Contains(alias, "/") || tmpl.Lookup(alias) != nil {
+			continue
+		}
+		if t := tmpl.Lookup(file.RelPath); t != nil && t.Tree != nil {
+			if _, err = tmpl.AddParseTree(alias, t.Tree); err != nil {
+				return nil, fmt.Errorf("add template alias %q: %w", alias, err)
+			}
+		}
+	}
+
+	if len(templateErrs) != 0 {
+		return tmpl, templateErrs
 	}
 	return tmpl, nil
 }
 
+// parseFile parses the template file and adds all templates defined in it to the template set.
+// The template set is left untouched if the file cannot be parsed.
+func (pp *PromptsParser) parseFile(tmpl *template.Template, file TemplateFile) error {
+	content, err := os.ReadFile(file.Path())
+	if err != nil {
+		return fmt.Errorf("read file: %w", err)
+	}
+	_, body, err := splitFrontMatter(content)
+	if err != nil {
+		return fmt.Errorf("split front matter: %w", err)
+	}
+	fileTmpl, err := template.New(file.RelPath).Funcs(pp.templateFuncs()).Parse(string(body))
+	if err != nil {
+		return fmt.Errorf("parse template: %w", err)
+	}
+	var fileTemplates []*template.Template
+	for _, t := range fileTmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		if err = resolveTemplateReferences(t.Root, path.Dir(file.RelPath)); err != nil {
+			return fmt.Errorf("resolve template references: %w", err)
+		}
+		fileTemplates = append(fileTemplates, t)
+	}
+	for _, t := range fileTemplates {
+		if _, err = tmpl.AddParseTree(t.Name(), t.Tree); err != nil {
+			return fmt.Errorf("add template %q: %w", t.Name(), err)
+		}
+	}
+	return nil
+}
+
+// ListTemplateFiles returns all template files in the directories and their subdirectories sorted by relative path.
+// When several directories contain a file with the same relative path, the file from the last directory wins.
+// Hidden subdirectories are skipped.
+func (pp *PromptsParser) ListTemplateFiles(promptsDirs ...string) ([]TemplateFile, error) {
+	return listOverlaidFiles(templateExt, promptsDirs...)
+}
+
+// listOverlaidFiles returns the files with the extension in the directories and their subdirectories, overlaid
+// and sorted as by ListTemplateFiles.
+func listOverlaidFiles(ext string, promptsDirs ...string) ([]TemplateFile, error) {
+	filesByPath := make(map[string]*TemplateFile)
+	for _, promptsDir := range promptsDirs {
+		err := filepath.WalkDir(promptsDir, func(filePath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if filePath != promptsDir && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !strings.HasSuffix(d.Name(), ext) {
+				return nil
+			}
+			relPath, err := filepath.Rel(promptsDir, filePath)
+			if err != nil {
+				return err
+			}
+			relPath = filepath.ToSlash(relPath)
+			if file, exists := filesByPath[relPath]; exists {
+				file.ShadowedRoots = append(file.ShadowedRoots, file.Root)
+				file.Root = promptsDir
+				return nil
+			}
+			filesByPath[relPath] = &TemplateFile{RelPath: relPath, Root: promptsDir}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("walk prompts directory %q: %w", promptsDir, err)
+		}
+	}
+
+	files := make([]TemplateFile, 0, len(filesByPath))
+	for _, file := range filesByPath {
+		files = append(files, *file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].RelPath < files[j].RelPath })
+	return files, nil
+}
+
+// resolveTemplateReferences rewrites template calls with relative names (starting with "./" or "../")
+// into names relative to the prompts directory, using dir as the directory of the calling template file.
+func resolveTemplateReferences(node parse.Node, dir string) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := resolveTemplateReferences(child, dir); err != nil {
+				return err
+			}
+		}
+	case *parse.IfNode:
+		return resolveBranchTemplateReferences(&n.BranchNode, dir)
+	case *parse.RangeNode:
+		return resolveBranchTemplateReferences(&n.BranchNode, dir)
+	case *parse.WithNode:
+		return resolveBranchTemplateReferences(&n.BranchNode, dir)
+	case *parse.TemplateNode:
+		if !strings.HasPrefix(n.Name, "./") && !strings.HasPrefix(n.Name, "../") {
+			return nil
+		}
+		resolved := path.Join(dir, n.Name)
+		if resolved == ".." || strings.HasPrefix(resolved, "../") {
+			return fmt.Errorf("template reference %q escapes the prompts directory", n.Name)
+		}
+		n.Name = resolved
+	}
+	return nil
+}
+
+func resolveBranchTemplateReferences(n *parse.BranchNode, dir string) error {
+	if err := resolveTemplateReferences(n.List, dir); err != nil {
+		return err
+	}
+	return resolveTemplateReferences(n.ElseList, dir)
+}
+
+// ExtractPromptDescriptionFromFile returns the prompt description declared in the template file.
 func (pp *PromptsParser) ExtractPromptDescriptionFromFile(filePath string) (string, error) {
+	metadata, err := pp.ExtractPromptMetadataFromFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	return metadata.Description, nil
+}
+
+// ExtractPromptMetadataFromFile reads prompt metadata from the YAML front matter of the template file.
+// If the front matter is absent or has no description, the first-line comment is used as the description.
+func (pp *PromptsParser) ExtractPromptMetadataFromFile(filePath string) (PromptMetadata, error) {
 	content, err := os.ReadFile(filePath)
 	if err != nil {
-		return "", fmt.Errorf("read file: %w", err)
+		return PromptMetadata{}, fmt.Errorf("read file: %w", err)
 	}
+
+	frontMatter, body, err := splitFrontMatter(content)
+	if err != nil {
+		return PromptMetadata{}, fmt.Errorf("split front matter: %w", err)
+	}
+
+	var metadata PromptMetadata
+	if len(bytes.TrimSpace(frontMatter)) != 0 {
+		dec := yaml.NewDecoder(bytes.NewReader(frontMatter))
+		dec.KnownFields(true)
+		if err = dec.Decode(&metadata); err != nil {
+			return PromptMetadata{}, fmt.Errorf("decode front matter: %w", err)
+		}
+	}
+	for _, arg := range metadata.Arguments {
+		if err = arg.ArgumentSchema.Validate(); err != nil {
+			return PromptMetadata{}, fmt.Errorf("invalid schema of argument %q: %w", arg.Name, err)
+		}
+		if err = arg.ArgumentSchema.ValidateDefault(arg.Default); err != nil {
+			return PromptMetadata{}, fmt.Errorf("invalid default value of argument %q: %w", arg.Name, err)
+		}
+	}
+	metadata.Description = strings.TrimSpace(metadata.Description)
+	if metadata.Description == "" {
+		metadata.Description = extractDescriptionComment(body)
+	}
+
+	return metadata, nil
+}
+
+// splitFrontMatter separates an optional YAML front matter block delimited by "---" lines
+// from the template body. Content without front matter is returned as the body unchanged.
+func splitFrontMatter(content []byte) (frontMatter []byte, body []byte, err error) {
+	firstLine, rest, found := bytes.Cut(content, []byte("\n"))
+	if !found || string(bytes.TrimRight(firstLine, "\r")) != frontMatterDelimiter {
+		return nil, content, nil
+	}
+
+	for offset := 0; offset < len(rest); {
+		line := rest[offset:]
+		next := len(rest)
+		if idx := bytes.IndexByte(line, '\n'); idx != -1 {
+			line = line[:idx]
+			next = offset + idx + 1
+		}
+		if string(bytes.TrimRight(line, "\r")) == frontMatterDelimiter {
+			return rest[:offset], rest[next:], nil
+		}
+		offset = next
+	}
+
+	return nil, nil, fmt.Errorf("front matter is not terminated with %q line", frontMatterDelimiter)
+}
+
+// extractDescriptionComment returns the text of a single-line comment on the first line of the template body.
+func extractDescriptionComment(content []byte) string {
 	content = bytes.TrimSpace(content)
 
 	var firstLine string
@@ -50,18 +365,209 @@ func (pp *PromptsParser) ExtractPromptDescriptionFromFile(filePath string) (stri
 			comment := firstLine
 			comment = strings.TrimPrefix(comment, c[0])
 			comment = strings.TrimSuffix(comment, c[1])
-			return strings.TrimSpace(comment), nil
+			return strings.TrimSpace(comment)
+		}
+	}
+
+	return ""
+}
+
+// Kinds of template arguments inferred from how the template uses them.
+const (
+	// argKindScalar is a value that is printed, directly or through string functions.
+	argKindScalar = "scalar"
+	// argKindBoolean is a value used only as a condition of if/with actions or an operand of not, and and or.
+	argKindBoolean = "boolean"
+	// argKindNumber is a value compared with a number.
+	argKindNumber = "number"
+	// argKindUnknown is a value passed to other functions, compared with non-constants or bound to a variable,
+	// whose type the usage does not tell. It is reported as an empty kind.
+	argKindUnknown = "unknown"
+	// argKindIterable is a value iterated over with range, either an array or an object.
+	argKindIterable = "iterable"
+	// argKindArray is a value passed as a list to list functions.
+	argKindArray = "array"
+	// argKindObject is a value whose fields are referenced.
+	argKindObject = "object"
+)
+
+// argKindPriorities resolves the kind of an argument used in several ways: the most specific usage wins,
+// e.g. an argument that is both checked with if and printed is a scalar.
+var argKindPriorities = map[string]int{
+	argKindBoolean:  1,
+	argKindScalar:   2,
+	argKindUnknown:  3,
+	argKindNumber:   4,
+	argKindIterable: 5,
+	argKindArray:    6,
+	argKindObject:   7,
+}
+
+// comparisonFuncs are the built-in template functions comparing their arguments.
+var comparisonFuncs = map[string]struct{}{"eq": {}, "ne": {}, "lt": {}, "le": {}, "gt": {}, "ge": {}}
+
+// logicalFuncs are the built-in template functions treating their arguments as conditions.
+var logicalFuncs = map[string]struct{}{"not": {}, "and": {}, "or": {}}
+
+// TemplateArgument is an argument referenced by a prompt template.
+type TemplateArgument struct {
+	Name string
+	// Optional is true when every reference to the argument is guarded by an if/with action,
+	// so the template still renders meaningfully when the argument is not provided.
+	Optional bool
+	// Kind is the argument kind inferred from its usage: scalar, boolean, number, iterable, array or object.
+	// It is empty when the usage does not tell the type, e.g. for values passed to len or bound to variables.
+	Kind string
+	// Fields lists sorted nested field paths referenced under the argument,
+	// e.g. "timeout" and "db.host" for {{.config.timeout}} and {{with .config.db}}{{.host}}{{end}}.
+	Fields []string
+	// Spellings lists sorted field names the template uses to reference the argument.
+	// Argument names are lower-cased, so they differ from Name only in case.
+	Spellings []string
+}
+
+// argumentUsage collects how an argument is referenced by a template.
+type argumentUsage struct {
+	// unguarded is true if the argument is referenced outside any if/with guard
+	unguarded bool
+	kind      string
+	// fields is the set of nested field paths referenced under the argument
+	fields map[string]struct{}
+	// spellings is the set of field names referencing the argument
+	spellings map[string]struct{}
+}
+
+// dataRef tells where a value evaluated by a template comes from.
+// The zero dataRef is a value that does not come from the root template data,
+// such as a range element or the result of a function call.
+type dataRef struct {
+	// rooted is true if the value is resolved against the root template data
+	rooted bool
+	// fields is the field path of the value within the root data, empty for the root data itself
+	fields []string
+	// dict maps the keys of a map built with the dict function to the values passed for them
+	dict map[string]dataRef
+}
+
+// rootDataRef refers to the root template data.
+var rootDataRef = dataRef{rooted: true}
+
+// field returns the reference to the nested field of the value.
+// Fields of a dict resolve to the values passed for its keys.
+func (r dataRef) field(idents ...string) dataRef {
+	if r.dict != nil {
+		if len(idents) == 0 {
+			return r
 		}
+		value, ok := r.dict[idents[0]]
+		if !ok {
+			return dataRef{}
+		}
+		return value.field(idents[1:]...)
 	}
+	if !r.rooted {
+		return dataRef{}
+	}
+	return dataRef{rooted: true, fields: append(append([]string(nil), r.fields...), idents...)}
+}
 
-	return "", nil
+// key identifies the referenced value, so a template is walked once for every distinct data it is called with.
+func (r dataRef) key() string {
+	if r.dict != nil {
+		keys := make([]string, 0, len(r.dict))
+		for key := range r.dict {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		entries := make([]string, 0, len(keys))
+		for _, key := range keys {
+			entries = append(entries, key+"="+r.dict[key].key())
+		}
+		return "dict(" + strings.Join(entries, ",") + ")"
+	}
+	if !r.rooted {
+		return "?"
+	}
+	return "." + strings.Join(r.fields, ".")
+}
+
+// walkScope is the context in which a template node is evaluated.
+type walkScope struct {
+	// path is the chain of template calls leading to the node, used to detect cycles
+	path []string
+	// dot and dollar tell what {{.}} and {{$}} evaluate to
+	dot, dollar dataRef
+	// guarded is set for nodes within if/with actions (both their conditions and bodies)
+	guarded bool
+}
+
+// argumentsWalker collects the arguments referenced by a template and the templates it calls.
+type argumentsWalker struct {
+	tmpl          *template.Template
+	builtInFields map[string]struct{}
+	args          map[string]*argumentUsage
+	// builtIns is the set of referenced field paths of the built-in data, e.g. "git.branch"
+	builtIns map[string]struct{}
+	// processedTemplates maps template name and data to whether it has only been walked under a guard,
+	// so a template first seen under a guard is walked again when it is also called unguarded
+	processedTemplates map[string]bool
+}
+
+func newArgumentsWalker(tmpl *template.Template) *argumentsWalker {
+	return &argumentsWalker{
+		tmpl:               tmpl,
+		builtInFields:      builtInArguments,
+		args:               make(map[string]*argumentUsage),
+		builtIns:           make(map[string]struct{}),
+		processedTemplates: make(map[string]bool),
+	}
 }
 
 // ExtractPromptArgumentsFromTemplate analyzes template to find field references using template tree traversal,
-// leveraging text/template built-in functionality to automatically resolve partials
+// leveraging text/template built-in functionality to automatically resolve partials.
+// Only fields resolved against the root template data are reported: the dot is tracked through
+// range, with and template calls, so fields of range elements are not mistaken for arguments.
+// The kind of every argument is inferred from its usage. Arguments are sorted by name, so prompts loaded
+// from unchanged templates are identical.
 func (pp *PromptsParser) ExtractPromptArgumentsFromTemplate(
 	tmpl *template.Template, templateName string,
-) ([]string, error) {
+) ([]TemplateArgument, error) {
+	walker, err := walkTemplate(tmpl, templateName)
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]TemplateArgument, 0, len(walker.args))
+	for arg, usage := range walker.args {
+		kind := usage.kind
+		if kind == argKindUnknown {
+			kind = ""
+		}
+		args = append(args, TemplateArgument{
+			Name:      arg,
+			Optional:  !usage.unguarded,
+			Kind:      kind,
+			Fields:    sortedKeys(usage.fields),
+			Spellings: sortedKeys(usage.spellings),
+		})
+	}
+	sort.Slice(args, func(i, j int) bool { return args[i].Name < args[j].Name })
+
+	return args, nil
+}
+
+// ExtractPromptBuiltInsFromTemplate returns the sorted field paths of the built-in data referenced by the template,
+// e.g. "date" and "git.branch", so that only the referenced built-in data is computed when the template is rendered.
+func (pp *PromptsParser) ExtractPromptBuiltInsFromTemplate(tmpl *template.Template, templateName string) ([]string, error) {
+	walker, err := walkTemplate(tmpl, templateName)
+	if err != nil {
+		return nil, err
+	}
+	return sortedKeys(walker.builtIns), nil
+}
+
+// walkTemplate walks the template and all templates it calls recursively, collecting the referenced data.
+func walkTemplate(tmpl *template.Template, templateName string) (*argumentsWalker, error) {
 	targetTemplate := tmpl.Lookup(templateName)
 	if targetTemplate == nil {
 		if targetTemplate = tmpl.Lookup(templateName + templateExt); targetTemplate == nil {
@@ -69,132 +575,323 @@ func (pp *PromptsParser) ExtractPromptArgumentsFromTemplate(
 		}
 	}
 
-	argsMap := make(map[string]struct{})
-	builtInFields := map[string]struct{}{"date": {}}
-	processedTemplates := make(map[string]bool)
-
-	// Extract arguments from the target template and all referenced templates recursively
-	err := pp.walkNodes(targetTemplate.Root, argsMap, builtInFields, tmpl, processedTemplates, []string{})
-	if err != nil {
+	walker := newArgumentsWalker(tmpl)
+	rootScope := walkScope{path: []string{}, dot: rootDataRef, dollar: rootDataRef}
+	if err := walker.walkNodes(targetTemplate.Root, rootScope, argKindScalar); err != nil {
 		return nil, err
 	}
+	return walker, nil
+}
 
-	args := make([]string, 0, len(argsMap))
-	for arg := range argsMap {
-		args = append(args, arg)
+// ExtractPromptPartialsFromTemplate returns the sorted names of templates called by the template,
+// directly or through other called templates. Templates that are not defined are reported as well.
+func (pp *PromptsParser) ExtractPromptPartialsFromTemplate(tmpl *template.Template, templateName string) []string {
+	visited := make(map[string]struct{})
+	var visit func(name string)
+	visit = func(name string) {
+		t := tmpl.Lookup(name)
+		if t == nil {
+			t = tmpl.Lookup(name + templateExt)
+		}
+		if t == nil || t.Tree == nil {
+			return
+		}
+		for _, node := range templateCalls(t.Root) {
+			if _, seen := visited[node.Name]; !seen {
+				visited[node.Name] = struct{}{}
+				visit(node.Name)
+			}
+		}
 	}
-
-	return args, nil
+	visit(templateName)
+	return sortedKeys(visited)
 }
 
 // walkNodes recursively walks the template parse tree to find variable references,
-// automatically resolving template calls to include variables from referenced templates
-func (pp *PromptsParser) walkNodes(
-	node parse.Node,
-	argsMap map[string]struct{},
-	builtInFields map[string]struct{},
-	tmpl *template.Template,
-	processedTemplates map[string]bool,
-	path []string,
-) error {
+// automatically resolving template calls to include variables from referenced templates.
+// The kind is the usage of fields evaluated directly by the node, e.g. a range pipeline is iterated over.
+func (w *argumentsWalker) walkNodes(node parse.Node, scope walkScope, kind string) error {
 	if node == nil {
 		return nil
 	}
 
+	guardedScope := scope
+	guardedScope.guarded = true
+
 	switch n := node.(type) {
 	case *parse.ActionNode:
-		return pp.walkNodes(n.Pipe, argsMap, builtInFields, tmpl, processedTemplates, path)
+		// Values bound to variables may be used in any way
+		if len(n.Pipe.Decl) > 0 {
+			return w.walkNodes(n.Pipe, scope, argKindUnknown)
+		}
+		return w.walkNodes(n.Pipe, scope, argKindScalar)
 	case *parse.IfNode:
-		if err := pp.walkNodes(n.Pipe, argsMap, builtInFields, tmpl, processedTemplates, path); err != nil {
+		if err := w.walkNodes(n.Pipe, guardedScope, argKindBoolean); err != nil {
 			return err
 		}
-		if err := pp.walkNodes(n.List, argsMap, builtInFields, tmpl, processedTemplates, path); err != nil {
+		if err := w.walkNodes(n.List, guardedScope, argKindScalar); err != nil {
 			return err
 		}
-		return pp.walkNodes(n.ElseList, argsMap, builtInFields, tmpl, processedTemplates, path)
+		return w.walkNodes(n.ElseList, guardedScope, argKindScalar)
 	case *parse.RangeNode:
-		if err := pp.walkNodes(n.Pipe, argsMap, builtInFields, tmpl, processedTemplates, path); err != nil {
+		if err := w.walkNodes(n.Pipe, scope, argKindIterable); err != nil {
 			return err
 		}
-		if err := pp.walkNodes(n.List, argsMap, builtInFields, tmpl, processedTemplates, path); err != nil {
+		// The dot is set to the elements, which are not the root data
+		elemScope := scope
+		elemScope.dot = dataRef{}
+		if err := w.walkNodes(n.List, elemScope, argKindScalar); err != nil {
 			return err
 		}
-		return pp.walkNodes(n.ElseList, argsMap, builtInFields, tmpl, processedTemplates, path)
+		return w.walkNodes(n.ElseList, scope, argKindScalar)
 	case *parse.WithNode:
-		if err := pp.walkNodes(n.Pipe, argsMap, builtInFields, tmpl, processedTemplates, path); err != nil {
+		if err := w.walkNodes(n.Pipe, guardedScope, argKindBoolean); err != nil {
 			return err
 		}
-		if err := pp.walkNodes(n.List, argsMap, builtInFields, tmpl, processedTemplates, path); err != nil {
+		// The dot is set to the value of the pipeline
+		withScope := guardedScope
+		withScope.dot = pipeDataRef(n.Pipe, scope)
+		if err := w.walkNodes(n.List, withScope, argKindScalar); err != nil {
 			return err
 		}
-		return pp.walkNodes(n.ElseList, argsMap, builtInFields, tmpl, processedTemplates, path)
+		return w.walkNodes(n.ElseList, guardedScope, argKindScalar)
 	case *parse.ListNode:
 		if n != nil {
 			for _, child := range n.Nodes {
-				if err := pp.walkNodes(child, argsMap, builtInFields, tmpl, processedTemplates, path); err != nil {
+				if err := w.walkNodes(child, scope, argKindScalar); err != nil {
 					return err
 				}
 			}
 		}
 	case *parse.PipeNode:
 		if n != nil {
-			for _, cmd := range n.Cmds {
-				if err := pp.walkNodes(cmd, argsMap, builtInFields, tmpl, processedTemplates, path); err != nil {
+			// Values of piped commands are passed to the next command, so only the last command
+			// is used the way the pipeline is
+			for i, cmd := range n.Cmds {
+				cmdScope, cmdKind := scope, kind
+				// The value of the command is the last argument of the next one
+				if i+1 < len(n.Cmds) {
+					nextFunc := commandFunc(n.Cmds[i+1])
+					if _, isGuarding := guardingFuncs[nextFunc]; isGuarding {
+						cmdScope = guardedScope
+					}
+					cmdKind = funcArgKind(nextFunc)
+				}
+				if err := w.walkNodes(cmd, cmdScope, cmdKind); err != nil {
 					return err
 				}
 			}
 		}
 	case *parse.CommandNode:
 		if n != nil {
-			for _, arg := range n.Args {
-				if err := pp.walkNodes(arg, argsMap, builtInFields, tmpl, processedTemplates, path); err != nil {
+			funcName := commandFunc(n)
+			argScope := scope
+			if _, isGuarding := guardingFuncs[funcName]; isGuarding {
+				argScope = guardedScope
+			}
+			for i, arg := range n.Args {
+				argKind := kind
+				if len(n.Args) > 1 {
+					argKind = commandArgsKind(n)
+					// The last argument is the value the function works on
+					if i != 0 && i == len(n.Args)-1 && argKind == argKindUnknown {
+						argKind = funcArgKind(funcName)
+					}
+				}
+				if err := w.walkNodes(arg, argScope, argKind); err != nil {
 					return err
 				}
 			}
 		}
+	case *parse.ChainNode:
+		return w.walkNodes(n.Node, scope, argKindUnknown)
+	case *parse.DotNode:
+		w.recordArgument(scope.dot, scope.guarded, kind)
 	case *parse.FieldNode:
-		if len(n.Ident) > 0 {
-			fieldName := strings.ToLower(n.Ident[0])
-			if _, isBuiltIn := builtInFields[fieldName]; !isBuiltIn {
-				argsMap[fieldName] = struct{}{}
-			}
-		}
+		w.recordArgument(scope.dot.field(n.Ident...), scope.guarded, kind)
 	case *parse.VariableNode:
-		if len(n.Ident) > 0 {
-			fieldName := strings.ToLower(n.Ident[0])
-			// Skip variable names that start with $ (template variables)
-			if !strings.HasPrefix(fieldName, "$") {
-				if _, isBuiltIn := builtInFields[fieldName]; !isBuiltIn {
-					argsMap[fieldName] = struct{}{}
-				}
-			}
+		// Only fields of $ refer to the data, other variables are declared by the template
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			w.recordArgument(scope.dollar.field(n.Ident[1:]...), scope.guarded, kind)
 		}
 	case *parse.TemplateNode:
 		templateName := n.Name
 		// Check for cycles
-		for _, ancestor := range path {
+		for _, ancestor := range scope.path {
 			if ancestor == templateName {
-				return fmt.Errorf("cyclic partial reference detected: %s", strings.Join(append(path, templateName), " -> "))
+				return fmt.Errorf("%w: %s", errCyclicPartialReference, strings.Join(append(scope.path, templateName), " -> "))
 			}
 		}
-		if !processedTemplates[templateName] {
-			processedTemplates[templateName] = true
-			// Try to find the template by name or name + extension
-			var referencedTemplate *template.Template
-			if referencedTemplate = tmpl.Lookup(templateName); referencedTemplate == nil {
-				referencedTemplate = tmpl.Lookup(templateName + templateExt)
+		// The dot of the referenced template, as well as its $, is set to the value of the pipeline
+		templateDot := pipeDataRef(n.Pipe, scope)
+		// Try to find the template by name or name + extension
+		var referencedTemplate *template.Template
+		if referencedTemplate = w.tmpl.Lookup(templateName); referencedTemplate == nil {
+			referencedTemplate = w.tmpl.Lookup(templateName + templateExt)
+		}
+		referenced := referencedTemplate != nil && referencedTemplate.Tree != nil
+		processedKey := templateName + "\x00" + templateDot.key()
+		if guardedOnly, processed := w.processedTemplates[processedKey]; !processed || (guardedOnly && !scope.guarded) {
+			w.processedTemplates[processedKey] = scope.guarded
+			if referenced {
+				templateScope := walkScope{
+					path:    append(scope.path, templateName),
+					dot:     templateDot,
+					dollar:  templateDot,
+					guarded: scope.guarded,
+				}
+				if err := w.walkNodes(referencedTemplate.Root, templateScope, argKindScalar); err != nil {
+					return err
+				}
 			}
-			if referencedTemplate != nil && referencedTemplate.Tree != nil {
-				if err := pp.walkNodes(referencedTemplate.Root, argsMap, builtInFields, tmpl, processedTemplates, append(path, templateName)); err != nil {
+		}
+		if referenced && templateDot.dict != nil {
+			// Data fields passed as dict values have been recorded with their usage by the referenced template.
+			// Fields the template does not use are still arguments, optional since passing a missing field does not fail
+			args := n.Pipe.Cmds[0].Args
+			for i := 2; i < len(args); i += 2 {
+				if ref := nodeDataRef(args[i], scope); ref.rooted {
+					if len(ref.fields) > 0 {
+						if _, recorded := w.args[strings.ToLower(ref.fields[0])]; !recorded {
+							w.recordArgument(dataRef{rooted: true, fields: ref.fields[:1]}, true, argKindUnknown)
+						}
+					}
+					continue
+				}
+				if err := w.walkNodes(args[i], scope, argKindUnknown); err != nil {
 					return err
 				}
 			}
+			return nil
 		}
-		return pp.walkNodes(n.Pipe, argsMap, builtInFields, tmpl, processedTemplates, path)
+		return w.walkNodes(n.Pipe, scope, argKindUnknown)
 	}
 	return nil
 }
 
+// recordArgument records the reference to the root data field as the argument named by the first field
+// and its nested path as the argument structure.
+func (w *argumentsWalker) recordArgument(ref dataRef, guarded bool, kind string) {
+	if !ref.rooted || len(ref.fields) == 0 {
+		return
+	}
+	argName := strings.ToLower(ref.fields[0])
+	if _, isBuiltIn := w.builtInFields[argName]; isBuiltIn {
+		// Conditions like {{with .git}} do not need the whole built-in data, only the fields used within them
+		if len(ref.fields) > 1 || kind != argKindBoolean {
+			w.builtIns[strings.Join(append([]string{argName}, ref.fields[1:]...), ".")] = struct{}{}
+		}
+		return
+	}
+	usage, exists := w.args[argName]
+	if !exists {
+		usage = &argumentUsage{fields: make(map[string]struct{}), spellings: make(map[string]struct{})}
+		w.args[argName] = usage
+	}
+	usage.spellings[ref.fields[0]] = struct{}{}
+	usage.unguarded = usage.unguarded || !guarded
+	if len(ref.fields) > 1 {
+		usage.fields[strings.Join(ref.fields[1:], ".")] = struct{}{}
+		kind = argKindObject
+	}
+	if argKindPriorities[kind] > argKindPriorities[usage.kind] {
+		usage.kind = kind
+	}
+}
+
+// sortedKeys returns the keys of the set in sorted order, or nil if the set is empty.
+func sortedKeys(set map[string]struct{}) []string {
+	var keys []string
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// commandArgsKind returns the usage of the fields passed to the function called by the command.
+func commandArgsKind(cmd *parse.CommandNode) string {
+	funcName := commandFunc(cmd)
+	if _, isLogical := logicalFuncs[funcName]; isLogical {
+		return argKindBoolean
+	}
+	if _, isComparison := comparisonFuncs[funcName]; isComparison {
+		for _, arg := range cmd.Args[1:] {
+			switch arg.(type) {
+			case *parse.NumberNode:
+				return argKindNumber
+			case *parse.BoolNode:
+				return argKindBoolean
+			}
+		}
+	}
+	return argKindUnknown
+}
+
+// funcArgKind returns the usage of the value the function works on, passed as its last argument.
+func funcArgKind(funcName string) string {
+	if _, isList := listFuncs[funcName]; isList {
+		return argKindArray
+	}
+	if _, isString := stringFuncs[funcName]; isString {
+		return argKindScalar
+	}
+	return argKindUnknown
+}
+
+// commandFunc returns the name of the function called by the command, or an empty string if it calls none.
+func commandFunc(cmd *parse.CommandNode) string {
+	if len(cmd.Args) == 0 {
+		return ""
+	}
+	if ident, ok := cmd.Args[0].(*parse.IdentifierNode); ok {
+		return ident.Ident
+	}
+	return ""
+}
+
+// pipeDataRef returns what the pipeline evaluates to. Only pipelines of a single dot, field, $ field or
+// dict call are resolved, the values of all other pipelines are considered not to come from the root data.
+func pipeDataRef(pipe *parse.PipeNode, scope walkScope) dataRef {
+	if pipe == nil || len(pipe.Cmds) != 1 {
+		return dataRef{}
+	}
+	args := pipe.Cmds[0].Args
+	if len(args) == 1 {
+		return nodeDataRef(args[0], scope)
+	}
+	ident, ok := args[0].(*parse.IdentifierNode)
+	if !ok || ident.Ident != "dict" || len(args)%2 != 1 {
+		return dataRef{}
+	}
+	dict := make(map[string]dataRef, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		key, ok := args[i].(*parse.StringNode)
+		if !ok {
+			return dataRef{}
+		}
+		dict[key.Text] = nodeDataRef(args[i+1], scope)
+	}
+	return dataRef{dict: dict}
+}
+
+// nodeDataRef returns what the command argument evaluates to.
+func nodeDataRef(node parse.Node, scope walkScope) dataRef {
+	switch n := node.(type) {
+	case *parse.DotNode:
+		return scope.dot
+	case *parse.FieldNode:
+		return scope.dot.field(n.Ident...)
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" {
+			return scope.dollar.field(n.Ident[1:]...)
+		}
+	case *parse.PipeNode:
+		return pipeDataRef(n, scope)
+	}
+	return dataRef{}
+}
+
 // dict creates a map from key-value pairs for template usage
 func dict(values ...interface{}) map[string]interface{} {
 	if len(values)%2 != 0 {
@@ -210,3 +907,70 @@ func dict(values ...interface{}) map[string]interface{} {
 	}
 	return result
 }
+
+// Message roles accepted by the message template function.
+const (
+	messageRoleUser      = "user"
+	messageRoleAssistant = "assistant"
+	messageRoleSystem    = "system"
+)
+
+// messageMarker separates messages in the rendered prompt output. It contains NUL bytes,
+// so it cannot collide with text produced by regular templates.
+const messageMarker = "\x00message:"
+
+// message starts a new prompt message with the given role, e.g. {{message "assistant"}}.
+// All output up to the next message call belongs to this message.
+func message(role string) (string, error) {
+	switch role {
+	case messageRoleUser, messageRoleAssistant, messageRoleSystem:
+		return messageMarker + role + "\x00", nil
+	default:
+		return "", fmt.Errorf("unknown message role %q, must be one of: %s, %s, %s",
+			role, messageRoleUser, messageRoleAssistant, messageRoleSystem)
+	}
+}
+
+// renderedMessage is a single message of the rendered prompt.
+type renderedMessage struct {
+	Role string
+	Text string
+}
+
+// splitRenderedMessages splits the rendered prompt into messages at the markers emitted by the message function.
+// Output without markers is returned as a single user message unchanged. Otherwise, message texts are trimmed,
+// empty messages are dropped and any text before the first marker becomes a user message.
+func splitRenderedMessages(output string) []renderedMessage {
+	if !strings.Contains(output, messageMarker) {
+		return []renderedMessage{{Role: messageRoleUser, Text: output}}
+	}
+
+	var messages []renderedMessage
+	parts := strings.Split(output, messageMarker)
+	if text := strings.TrimSpace(parts[0]); text != "" {
+		messages = append(messages, renderedMessage{Role: messageRoleUser, Text: text})
+	}
+	for _, part := range parts[1:] {
+		role, text, _ := strings.Cut(part, "\x00")
+		if text = strings.TrimSpace(text); text != "" {
+			messages = append(messages, renderedMessage{Role: role, Text: text})
+		}
+	}
+	return messages
+}
+
+// formatRenderedMessages formats messages as plain text. A single user message is returned as is,
+// otherwise each message is preceded by a "--- role ---" header.
+func formatRenderedMessages(messages []renderedMessage) string {
+	if len(messages) == 1 && messages[0].Role == messageRoleUser {
+		return messages[0].Text
+	}
+	var sb strings.Builder
+	for i, msg := range messages {
+		if i > 0 {
+			sb.WriteString("\n\n")
+		}
+		fmt.Fprintf(&sb, "--- %s ---\n%s", msg.Role, msg.Text)
+	}
+	return sb.String()
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -124,7 +125,7 @@ func (s *PromptsParserTestSuite) TestExtractTemplateArgumentsFromTemplate() {
 			name:        "template with range node",
 			content:     "{{/* Template with range */}}\n{{range .items}}Item: {{.name}} - {{.value}}{{end}}\nTotal: {{.total}}",
 			partials:    map[string]string{},
-			expected:    []string{"items", "name", "value", "total"},
+			expected:    []string{"items", "total"}, // name and value are fields of the range elements
 			description: "Template with range",
 			shouldError: false,
 		},
@@ -163,10 +164,388 @@ func (s *PromptsParserTestSuite) TestExtractTemplateArgumentsFromTemplate() {
 			require.NoError(s.T(), err, "ExtractPromptArgumentsFromTemplate() unexpected error")
 
 			// Sort both slices for consistent comparison
-			sort.Strings(got)
+			gotNames := templateArgumentNames(got)
+			sort.Strings(gotNames)
 			sort.Strings(tt.expected)
 
-			assert.Equal(s.T(), tt.expected, got, "ExtractPromptArgumentsFromTemplate() returned unexpected arguments")
+			assert.Equal(s.T(), tt.expected, gotNames, "ExtractPromptArgumentsFromTemplate() returned unexpected arguments")
+		})
+	}
+}
+
+// TestExtractPromptArgumentsOptionality tests inference of optional arguments from if/with guards
+func (s *PromptsParserTestSuite) TestExtractPromptArgumentsOptionality() {
+	tests := []struct {
+		name             string
+		content          string
+		partials         map[string]string
+		expectedOptional map[string]bool
+	}{
+		{
+			name:             "unguarded argument is required",
+			content:          "Hello {{.name}}",
+			expectedOptional: map[string]bool{"name": false},
+		},
+		{
+			name:             "argument used only in if is optional",
+			content:          "{{.code}}{{if .urgency_level}}Urgency: {{.urgency_level}}{{end}}",
+			expectedOptional: map[string]bool{"code": false, "urgency_level": true},
+		},
+		{
+			name:             "argument used only in with is optional",
+			content:          "{{with .context}}Context: {{.}}{{end}}",
+			expectedOptional: map[string]bool{"context": true},
+		},
+		{
+			name:             "argument used in if and outside of it is required",
+			content:          "{{if .name}}Hi{{end}} {{.name}}",
+			expectedOptional: map[string]bool{"name": false},
+		},
+		{
+			name:             "arguments in else branch and nested range are optional",
+			content:          "{{if .show}}{{range .items}}{{.}}{{end}}{{else}}{{.fallback}}{{end}}",
+			expectedOptional: map[string]bool{"show": true, "items": true, "fallback": true},
+		},
+		{
+			name:             "arguments checked by default, coalesce and empty are optional",
+			content:          "{{.tone | default \"neutral\"}} {{default \"Go\" .lang}} {{coalesce .nick .name}} {{if not (empty .extra)}}x{{end}}",
+			expectedOptional: map[string]bool{"tone": true, "lang": true, "nick": true, "name": true, "extra": true},
+		},
+		{
+			name:             "argument passed to other functions is required",
+			content:          "{{.name | upper | default \"x\"}} {{required \"missing\" .code}}",
+			expectedOptional: map[string]bool{"name": false, "code": false},
+		},
+		{
+			name:             "partial called under guard and unguarded is required",
+			content:          "{{if .show}}{{template \"_p\" .}}{{end}}{{template \"_p\" .}}",
+			partials:         map[string]string{"_p": "{{define \"_p\"}}{{.value}}{{end}}"},
+			expectedOptional: map[string]bool{"show": true, "value": false},
+		},
+		{
+			name:             "dict value guarded in partial is optional",
+			content:          "{{template \"_p\" dict \"title\" .title \"body\" .body}}",
+			partials:         map[string]string{"_p": "{{define \"_p\"}}{{if .title}}# {{.title}}{{end}}{{.body}}{{end}}"},
+			expectedOptional: map[string]bool{"title": true, "body": false},
+		},
+		{
+			name:             "dict value unused by partial is optional",
+			content:          "{{template \"_p\" dict \"title\" .title \"role\" .role}}",
+			partials:         map[string]string{"_p": "{{define \"_p\"}}{{.title}}{{end}}"},
+			expectedOptional: map[string]bool{"title": false, "role": true},
+		},
+		{
+			name:             "partial called only under guard is optional",
+			content:          "{{if .show}}{{template \"_p\" .}}{{end}}",
+			partials:         map[string]string{"_p": "{{define \"_p\"}}{{.value}}{{end}}"},
+			expectedOptional: map[string]bool{"show": true, "value": true},
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			testDir := filepath.Join(s.tempDir, tt.name)
+			require.NoError(s.T(), os.MkdirAll(testDir, 0755), "Failed to create test directory")
+			err := os.WriteFile(filepath.Join(testDir, "prompt.tmpl"), []byte(tt.content), 0644)
+			require.NoError(s.T(), err, "Failed to write test file")
+			for partialName, partialContent := range tt.partials {
+				err = os.WriteFile(filepath.Join(testDir, partialName+".tmpl"), []byte(partialContent), 0644)
+				require.NoError(s.T(), err, "Failed to write partial file")
+			}
+
+			tmpl, err := s.parser.ParseDir(testDir)
+			require.NoError(s.T(), err, "Failed to parse templates")
+
+			args, err := s.parser.ExtractPromptArgumentsFromTemplate(tmpl, "prompt")
+			require.NoError(s.T(), err, "ExtractPromptArgumentsFromTemplate() unexpected error")
+
+			gotOptional := make(map[string]bool, len(args))
+			for _, arg := range args {
+				gotOptional[arg.Name] = arg.Optional
+			}
+			assert.Equal(s.T(), tt.expectedOptional, gotOptional, "ExtractPromptArgumentsFromTemplate() returned unexpected optionality")
+		})
+	}
+}
+
+// TestExtractPromptArgumentsDotScope tests that only fields resolved against the root data are extracted
+func (s *PromptsParserTestSuite) TestExtractPromptArgumentsDotScope() {
+	tests := []struct {
+		name           string
+		content        string
+		partials       map[string]string
+		expectedFields map[string][]string
+	}{
+		{
+			name:           "fields of range elements are not arguments",
+			content:        "{{range .users}}{{.name}} ({{.age}}){{end}} Total: {{.total}}",
+			expectedFields: map[string][]string{"users": nil, "total": nil},
+		},
+		{
+			name:           "root fields inside range are arguments",
+			content:        "{{range .users}}{{.name}} at {{$.company}}{{else}}{{.fallback}}{{end}}",
+			expectedFields: map[string][]string{"users": nil, "company": nil, "fallback": nil},
+		},
+		{
+			name:           "fields inside with are nested paths",
+			content:        "{{with .config}}{{.version}}{{with .db}}{{.host}}{{end}}{{end}} {{.environment}}",
+			expectedFields: map[string][]string{"config": {"db", "db.host", "version"}, "environment": nil},
+		},
+		{
+			name:           "nested field references",
+			content:        "Timeout: {{.config.timeout}}, retries: {{$.config.retries}}",
+			expectedFields: map[string][]string{"config": {"retries", "timeout"}},
+		},
+		{
+			name:           "with else branch keeps the outer dot",
+			content:        "{{with .context}}{{.summary}}{{else}}{{.fallback}}{{end}}",
+			expectedFields: map[string][]string{"context": {"summary"}, "fallback": nil},
+		},
+		{
+			name:           "with over a function result",
+			content:        "{{with index .items 0}}{{.name}}{{end}}",
+			expectedFields: map[string][]string{"items": nil},
+		},
+		{
+			name:           "template called with dot inside range",
+			content:        "{{range .users}}{{template \"_user\" .}}{{end}}{{template \"_user\" .}}",
+			partials:       map[string]string{"_user": "{{define \"_user\"}}{{.name}}{{end}}"},
+			expectedFields: map[string][]string{"users": nil, "name": nil},
+		},
+		{
+			name:           "template called with a field",
+			content:        "{{template \"_db\" .config.db}}",
+			partials:       map[string]string{"_db": "{{define \"_db\"}}{{.host}}:{{$.port}}{{end}}"},
+			expectedFields: map[string][]string{"config": {"db", "db.host", "db.port"}},
+		},
+		{
+			name:           "dict keys satisfy fields of the template",
+			content:        "{{template \"_header\" dict \"title\" .page_title \"role\" \"engineer\"}}",
+			partials:       map[string]string{"_header": "{{define \"_header\"}}{{.title}} for {{.role}}{{.missing}}{{end}}"},
+			expectedFields: map[string][]string{"page_title": nil},
+		},
+		{
+			name:           "dict values map to nested paths",
+			content:        "{{template \"_db\" dict \"db\" .config.db \"all\" .}}",
+			partials:       map[string]string{"_db": "{{define \"_db\"}}{{.db.host}} {{$.all.environment}}{{end}}"},
+			expectedFields: map[string][]string{"config": {"db.host"}, "environment": nil},
+		},
+		{
+			name:           "dict values unused by the template are arguments",
+			content:        "{{template \"_p\" dict \"used\" .a \"unused\" .b \"computed\" (printf \"%s!\" .c)}}",
+			partials:       map[string]string{"_p": "{{define \"_p\"}}{{.used}}{{end}}"},
+			expectedFields: map[string][]string{"a": nil, "b": nil, "c": nil},
+		},
+		{
+			name:           "dict passed to unknown template",
+			content:        "{{template \"_missing\" dict \"title\" .title}}",
+			expectedFields: map[string][]string{"title": nil},
+		},
+		{
+			name:           "template called without data",
+			content:        "{{template \"_p\"}}{{.name}}",
+			partials:       map[string]string{"_p": "{{define \"_p\"}}{{.value}}{{end}}"},
+			expectedFields: map[string][]string{"name": nil},
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			testDir := filepath.Join(s.tempDir, tt.name)
+			require.NoError(s.T(), os.MkdirAll(testDir, 0755), "Failed to create test directory")
+			err := os.WriteFile(filepath.Join(testDir, "prompt.tmpl"), []byte(tt.content), 0644)
+			require.NoError(s.T(), err, "Failed to write test file")
+			for partialName, partialContent := range tt.partials {
+				err = os.WriteFile(filepath.Join(testDir, partialName+".tmpl"), []byte(partialContent), 0644)
+				require.NoError(s.T(), err, "Failed to write partial file")
+			}
+
+			tmpl, err := s.parser.ParseDir(testDir)
+			require.NoError(s.T(), err, "Failed to parse templates")
+
+			args, err := s.parser.ExtractPromptArgumentsFromTemplate(tmpl, "prompt")
+			require.NoError(s.T(), err, "ExtractPromptArgumentsFromTemplate() unexpected error")
+
+			gotFields := make(map[string][]string, len(args))
+			for _, arg := range args {
+				gotFields[arg.Name] = arg.Fields
+			}
+			assert.Equal(s.T(), tt.expectedFields, gotFields, "ExtractPromptArgumentsFromTemplate() returned unexpected arguments")
+		})
+	}
+
+	s.Run("testdata", func() {
+		tmpl, err := s.parser.ParseDir("./testdata")
+		require.NoError(s.T(), err, "Failed to parse templates")
+		for templateName, expected := range map[string][]string{
+			"range_structs": {"total", "users"},
+			"with_object":   {"config", "environment"},
+		} {
+			args, err := s.parser.ExtractPromptArgumentsFromTemplate(tmpl, templateName)
+			require.NoError(s.T(), err, "ExtractPromptArgumentsFromTemplate() unexpected error")
+			names := templateArgumentNames(args)
+			sort.Strings(names)
+			assert.Equal(s.T(), expected, names, "Unexpected arguments of %q", templateName)
+		}
+	})
+}
+
+// TestExtractPromptArgumentsKinds tests inference of argument kinds from their usage
+func (s *PromptsParserTestSuite) TestExtractPromptArgumentsKinds() {
+	tests := []struct {
+		name          string
+		content       string
+		partials      map[string]string
+		expectedKinds map[string]string
+	}{
+		{
+			name:          "printed argument is scalar",
+			content:       "Hello {{.name}} {{.title | upper}} {{indent 2 .subject}} {{.body | trim | wrap 80}}",
+			expectedKinds: map[string]string{"name": argKindScalar, "title": argKindScalar, "subject": argKindScalar, "body": argKindScalar},
+		},
+		{
+			name: "argument passed to other functions or bound to variable is unknown",
+			content: "{{len .items}} {{index .list 0}} {{toJson .config}} {{printf \"%s\" .title}} {{.subject | printf \"%q\"}}" +
+				"{{$c := .settings}}{{$c.timeout}}{{(.data).field}}",
+			expectedKinds: map[string]string{
+				"items": "", "list": "", "config": "", "title": "", "subject": "", "settings": "", "data": "",
+			},
+		},
+		{
+			name:          "condition is boolean",
+			content:       "{{if .verbose}}v{{end}}{{if and .a (not .b)}}ab{{end}}{{with .c}}c{{end}}",
+			expectedKinds: map[string]string{"verbose": argKindBoolean, "a": argKindBoolean, "b": argKindBoolean, "c": argKindBoolean},
+		},
+		{
+			name:          "argument passed to list functions is array",
+			content:       "{{join \", \" .tags}} {{.items | sort | join \",\"}} {{first .steps}} {{.name | upper}}",
+			expectedKinds: map[string]string{"tags": argKindArray, "items": argKindArray, "steps": argKindArray, "name": argKindScalar},
+		},
+		{
+			name:          "condition that is also printed is scalar",
+			content:       "{{if .name}}Hello {{.name}}{{end}}{{with .context}}{{.}}{{end}}",
+			expectedKinds: map[string]string{"name": argKindScalar, "context": argKindScalar},
+		},
+		{
+			name:          "comparison with number",
+			content:       "{{if gt .count 3}}many{{end}}{{if eq .level \"high\"}}!{{end}}{{if eq .strict true}}strict{{end}}",
+			expectedKinds: map[string]string{"count": argKindNumber, "level": "", "strict": argKindBoolean},
+		},
+		{
+			name:          "range pipeline is iterable",
+			content:       "{{range .items}}{{.}}{{end}}{{range $k, $v := .labels}}{{$k}}{{end}}{{range .steps}}{{end}}{{first .steps}}",
+			expectedKinds: map[string]string{"items": argKindIterable, "labels": argKindIterable, "steps": argKindArray},
+		},
+		{
+			name:          "usage in template called with dict",
+			content:       "{{template \"_list\" dict \"items\" .tasks \"show\" .verbose}}",
+			partials:      map[string]string{"_list": "{{define \"_list\"}}{{if .show}}{{range .items}}{{.}}{{end}}{{end}}{{end}}"},
+			expectedKinds: map[string]string{"tasks": argKindIterable, "verbose": argKindBoolean},
+		},
+		{
+			name:          "dereferenced argument is object",
+			content:       "{{if .config}}{{.config.timeout}}{{end}}{{range .db.hosts}}{{.}}{{end}}",
+			expectedKinds: map[string]string{"config": argKindObject, "db": argKindObject},
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			testDir := filepath.Join(s.tempDir, tt.name)
+			require.NoError(s.T(), os.MkdirAll(testDir, 0755), "Failed to create test directory")
+			err := os.WriteFile(filepath.Join(testDir, "prompt.tmpl"), []byte(tt.content), 0644)
+			require.NoError(s.T(), err, "Failed to write test file")
+			for partialName, partialContent := range tt.partials {
+				err = os.WriteFile(filepath.Join(testDir, partialName+".tmpl"), []byte(partialContent), 0644)
+				require.NoError(s.T(), err, "Failed to write partial file")
+			}
+
+			tmpl, err := s.parser.ParseDir(testDir)
+			require.NoError(s.T(), err, "Failed to parse templates")
+
+			args, err := s.parser.ExtractPromptArgumentsFromTemplate(tmpl, "prompt")
+			require.NoError(s.T(), err, "ExtractPromptArgumentsFromTemplate() unexpected error")
+
+			gotKinds := make(map[string]string, len(args))
+			for _, arg := range args {
+				gotKinds[arg.Name] = arg.Kind
+			}
+			assert.Equal(s.T(), tt.expectedKinds, gotKinds, "ExtractPromptArgumentsFromTemplate() returned unexpected kinds")
+		})
+	}
+}
+
+// TestExtractPromptPartialsFromTemplate tests collection of partials used by a prompt
+func (s *PromptsParserTestSuite) TestExtractPromptPartialsFromTemplate() {
+	tmpl, err := s.parser.ParseDir("./testdata")
+	require.NoError(s.T(), err, "Failed to parse templates")
+
+	tests := []struct {
+		templateName string
+		expected     []string
+	}{
+		{templateName: "greeting", expected: nil},
+		{templateName: "greeting_with_partials", expected: []string{"_greeting_body"}},
+		{templateName: "multiple_partials", expected: []string{"_content", "_footer", "_header"}},
+		{templateName: "review/security", expected: []string{"shared/_role"}},
+	}
+	for _, tt := range tests {
+		s.Run(tt.templateName, func() {
+			assert.Equal(s.T(), tt.expected, s.parser.ExtractPromptPartialsFromTemplate(tmpl, tt.templateName))
+		})
+	}
+
+	testDir := filepath.Join(s.tempDir, "nested")
+	require.NoError(s.T(), os.MkdirAll(testDir, 0755), "Failed to create test directory")
+	files := map[string]string{
+		"prompt.tmpl": "{{if .a}}{{template \"_outer\" .}}{{else}}{{template \"_missing\" .}}{{end}}",
+		"_outer.tmpl": "{{define \"_outer\"}}{{range .items}}{{template \"_inner\" .}}{{end}}{{end}}",
+		"_inner.tmpl": "{{define \"_inner\"}}{{.}}{{template \"_outer\" .}}{{end}}",
+	}
+	for name, content := range files {
+		require.NoError(s.T(), os.WriteFile(filepath.Join(testDir, name), []byte(content), 0644), "Failed to write test file")
+	}
+	tmpl, err = s.parser.ParseDir(testDir)
+	require.NoError(s.T(), err, "Failed to parse templates")
+	assert.Equal(s.T(), []string{"_inner", "_missing", "_outer"}, s.parser.ExtractPromptPartialsFromTemplate(tmpl, "prompt"),
+		"Nested, undefined and cyclic partials should be reported once")
+}
+
+// TestExtractPromptBuiltInsFromTemplate tests extraction of the built-in data referenced by templates
+func (s *PromptsParserTestSuite) TestExtractPromptBuiltInsFromTemplate() {
+	tests := []struct {
+		name             string
+		content          string
+		expectedBuiltIns []string
+		expectedArgs     []string
+	}{
+		{name: "no built-ins", content: "Hello {{.name}}", expectedArgs: []string{"name"}},
+		{name: "date", content: "Today is {{.date}}", expectedBuiltIns: []string{"date"}},
+		{
+			name:             "git fields",
+			content:          "{{.git.branch}}{{with .git}}{{.diff}}{{end}}{{template \"_log\" .}}{{define \"_log\"}}{{.git.log}}{{end}}",
+			expectedBuiltIns: []string{"git.branch", "git.diff", "git.log"},
+		},
+		{name: "whole git data", content: "{{toJson .git}} for {{.user}}", expectedBuiltIns: []string{"git"}, expectedArgs: []string{"user"}},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			testDir := s.T().TempDir()
+			require.NoError(s.T(), os.WriteFile(filepath.Join(testDir, "test.tmpl"), []byte(tt.content), 0644),
+				"Failed to write test file")
+			tmpl, err := s.parser.ParseDir(testDir)
+			require.NoError(s.T(), err, "Failed to parse templates")
+			builtIns, err := s.parser.ExtractPromptBuiltInsFromTemplate(tmpl, "test")
+			require.NoError(s.T(), err, "ExtractPromptBuiltInsFromTemplate() unexpected error")
+			assert.Equal(s.T(), tt.expectedBuiltIns, builtIns, "Unexpected built-ins")
+
+			args, err := s.parser.ExtractPromptArgumentsFromTemplate(tmpl, "test")
+			require.NoError(s.T(), err, "ExtractPromptArgumentsFromTemplate() unexpected error")
+			var argNames []string
+			for _, arg := range args {
+				argNames = append(argNames, arg.Name)
+			}
+			assert.Equal(s.T(), tt.expectedArgs, argNames, "Built-ins should not be arguments")
 		})
 	}
 }
@@ -223,6 +602,89 @@ func (s *PromptsParserTestSuite) TestExtractPromptDescriptionFromFile() {
 	}
 }
 
+// TestExtractPromptMetadataFromFile tests metadata extraction from YAML front matter
+func (s *PromptsParserTestSuite) TestExtractPromptMetadataFromFile() {
+	tests := []struct {
+		name             string
+		content          string
+		expectedMetadata PromptMetadata
+		shouldError      bool
+	}{
+		{
+			name: "front matter with all fields",
+			content: "---\ntitle: Code review\ndescription: Review the code\ntags: [review, go]\n" +
+				"arguments:\n  - name: language\n    description: Programming language\n---\nReview {{.language}} code",
+			expectedMetadata: PromptMetadata{
+				Title:       "Code review",
+				Description: "Review the code",
+				Tags:        []string{"review", "go"},
+				Arguments:   []PromptArgumentMetadata{{Name: "language", Description: "Programming language"}},
+			},
+		},
+		{
+			name:             "front matter without description falls back to comment",
+			content:          "---\ntitle: Greeting\n---\n{{/* Comment description */}}\nHello {{.name}}",
+			expectedMetadata: PromptMetadata{Title: "Greeting", Description: "Comment description"},
+		},
+		{
+			name:             "front matter with CRLF line endings",
+			content:          "---\r\ndescription: Windows template\r\n---\r\nHello {{.name}}",
+			expectedMetadata: PromptMetadata{Description: "Windows template"},
+		},
+		{
+			name:             "empty front matter",
+			content:          "---\n---\n{{/* Comment description */}}\nHello",
+			expectedMetadata: PromptMetadata{Description: "Comment description"},
+		},
+		{
+			name:             "no front matter",
+			content:          "{{/* Comment description */}}\nHello {{.name}}",
+			expectedMetadata: PromptMetadata{Description: "Comment description"},
+		},
+		{
+			name:        "unterminated front matter",
+			content:     "---\ndescription: Broken\nHello {{.name}}",
+			shouldError: true,
+		},
+		{
+			name:        "unknown front matter field",
+			content:     "---\ndescriptoin: Typo\n---\nHello {{.name}}",
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			testFile := filepath.Join(s.tempDir, tt.name+".tmpl")
+			err := os.WriteFile(testFile, []byte(tt.content), 0644)
+			require.NoError(s.T(), err, "Failed to write test file")
+
+			metadata, err := s.parser.ExtractPromptMetadataFromFile(testFile)
+			if tt.shouldError {
+				assert.Error(s.T(), err, "ExtractPromptMetadataFromFile() expected error, but got none")
+				return
+			}
+			require.NoError(s.T(), err, "ExtractPromptMetadataFromFile() unexpected error")
+			assert.Equal(s.T(), tt.expectedMetadata, metadata, "ExtractPromptMetadataFromFile() returned unexpected metadata")
+		})
+	}
+}
+
+// TestParseDirStripsFrontMatter tests that front matter is not part of the rendered template body
+func (s *PromptsParserTestSuite) TestParseDirStripsFrontMatter() {
+	testFile := filepath.Join(s.tempDir, "with_front_matter.tmpl")
+	err := os.WriteFile(testFile, []byte("---\ndescription: Greeting\n---\nHello {{.name}}!"), 0644)
+	require.NoError(s.T(), err, "Failed to write test file")
+
+	tmpl, err := s.parser.ParseDir(s.tempDir)
+	require.NoError(s.T(), err, "Failed to parse templates")
+
+	var result strings.Builder
+	err = tmpl.ExecuteTemplate(&result, "with_front_matter.tmpl", map[string]interface{}{"name": "John"})
+	require.NoError(s.T(), err, "Failed to execute template")
+	assert.Equal(s.T(), "Hello John!", result.String(), "Front matter should be stripped from template body")
+}
+
 // TestExtractPromptDescriptionFromFileErrorCases tests error cases for description extraction
 func (s *PromptsParserTestSuite) TestExtractPromptDescriptionFromFileErrorCases() {
 	// Test non-existent file
@@ -260,18 +722,165 @@ func (s *PromptsParserTestSuite) TestParseDirErrorCases() {
 	assert.Error(s.T(), err, "ParseDir() expected error for invalid template syntax, but got none")
 }
 
+// TestParseDirIsolatesBrokenTemplates tests that broken template files do not prevent other files from loading
+func (s *PromptsParserTestSuite) TestParseDirIsolatesBrokenTemplates() {
+	files := map[string]string{
+		"good.tmpl":        "Hello {{.name}}",
+		"broken.tmpl":      "{{.unclosed",
+		"bad_front.tmpl":   "---\ndescription: never closed\n",
+		"nested/_bad.tmpl": "{{template \"../../outside\" .}}",
+		"nested/good.tmpl": "Nested {{.name}}",
+	}
+	for relPath, content := range files {
+		filePath := filepath.Join(s.tempDir, filepath.FromSlash(relPath))
+		require.NoError(s.T(), os.MkdirAll(filepath.Dir(filePath), 0755), "Failed to create directory")
+		require.NoError(s.T(), os.WriteFile(filePath, []byte(content), 0644), "Failed to write test file")
+	}
+
+	tmpl, err := s.parser.ParseDir(s.tempDir)
+	var templateErrs TemplateErrors
+	require.ErrorAs(s.T(), err, &templateErrs, "ParseDir() should return TemplateErrors")
+	require.NotNil(s.T(), tmpl, "ParseDir() should return successfully parsed templates")
+
+	var failedPaths []string
+	for _, templateErr := range templateErrs {
+		failedPaths = append(failedPaths, templateErr.Path)
+	}
+	assert.Equal(s.T(), []string{
+		filepath.Join(s.tempDir, "bad_front.tmpl"),
+		filepath.Join(s.tempDir, "broken.tmpl"),
+		filepath.Join(s.tempDir, "nested", "_bad.tmpl"),
+	}, failedPaths, "Unexpected failed template files")
+
+	for templateName, expected := range map[string]string{
+		"good.tmpl":   "Hello Alice",
+		"nested/good": "Nested Alice",
+	} {
+		var result strings.Builder
+		require.NoError(s.T(), tmpl.ExecuteTemplate(&result, templateName, map[string]interface{}{"name": "Alice"}),
+			"Failed to execute %q", templateName)
+		assert.Equal(s.T(), expected, result.String(), "Unexpected output of %q", templateName)
+	}
+	assert.Nil(s.T(), tmpl.Lookup("broken.tmpl"), "Broken template should not be registered")
+	assert.Nil(s.T(), tmpl.Lookup("nested/_bad"), "Broken template should not be registered")
+}
+
+// TestParseDirRecursive tests parsing of templates in subdirectories with relative partial references
+func (s *PromptsParserTestSuite) TestParseDirRecursive() {
+	files := map[string]string{
+		"top.tmpl":                   "Top {{.a}} {{template \"shared/_common\" .}}",
+		"review/security.tmpl":       "{{template \"../shared/_common\" .}} {{template \"./_local\" .}}",
+		"review/_local.tmpl":         "local {{.b}}",
+		"shared/_common.tmpl":        "common {{.c}}",
+		".git/ignored.tmpl":          "{{.unclosed",
+		"review/deep/checklist.tmpl": "{{template \"../../shared/_common\" .}}",
+	}
+	for relPath, content := range files {
+		filePath := filepath.Join(s.tempDir, filepath.FromSlash(relPath))
+		require.NoError(s.T(), os.MkdirAll(filepath.Dir(filePath), 0755), "Failed to create directory")
+		require.NoError(s.T(), os.WriteFile(filePath, []byte(content), 0644), "Failed to write test file")
+	}
+
+	templateFiles, err := s.parser.ListTemplateFiles(s.tempDir)
+	require.NoError(s.T(), err, "ListTemplateFiles() unexpected error")
+	relPaths := make([]string, 0, len(templateFiles))
+	for _, file := range templateFiles {
+		relPaths = append(relPaths, file.RelPath)
+	}
+	assert.Equal(s.T(), []string{
+		"review/_local.tmpl", "review/deep/checklist.tmpl", "review/security.tmpl", "shared/_common.tmpl", "top.tmpl",
+	}, relPaths, "ListTemplateFiles() returned unexpected files")
+
+	tmpl, err := s.parser.ParseDir(s.tempDir)
+	require.NoError(s.T(), err, "ParseDir() unexpected error")
+
+	data := map[string]interface{}{"a": "A", "b": "B", "c": "C"}
+	for templateName, expected := range map[string]string{
+		"top.tmpl":                   "Top A common C",
+		"review/security":            "common C local B",
+		"review/deep/checklist.tmpl": "common C",
+	} {
+		var result strings.Builder
+		require.NoError(s.T(), tmpl.ExecuteTemplate(&result, templateName, data), "Failed to execute %q", templateName)
+		assert.Equal(s.T(), expected, result.String(), "Unexpected output of %q", templateName)
+	}
+
+	args, err := s.parser.ExtractPromptArgumentsFromTemplate(tmpl, "review/security")
+	require.NoError(s.T(), err, "ExtractPromptArgumentsFromTemplate() unexpected error")
+	gotNames := templateArgumentNames(args)
+	sort.Strings(gotNames)
+	assert.Equal(s.T(), []string{"b", "c"}, gotNames, "Arguments of relatively referenced partials should be extracted")
+
+	// Relative references must stay within the prompts directory
+	escapeFile := filepath.Join(s.tempDir, "escape.tmpl")
+	require.NoError(s.T(), os.WriteFile(escapeFile, []byte("{{template \"../outside\" .}}"), 0644), "Failed to write test file")
+	_, err = s.parser.ParseDir(s.tempDir)
+	assert.Error(s.T(), err, "ParseDir() expected error for template reference outside of prompts directory")
+}
+
+// TestParseDirOverlay tests that templates in later prompts directories override ones in earlier directories
+func (s *PromptsParserTestSuite) TestParseDirOverlay() {
+	baseDir := filepath.Join(s.tempDir, "base")
+	overlayDir := filepath.Join(s.tempDir, "overlay")
+	files := map[string]string{
+		"base/greeting.tmpl":       "{{template \"_header\" .}} Hello {{.name}}",
+		"base/_header.tmpl":        "{{define \"_header\"}}Base header{{end}}",
+		"base/review/code.tmpl":    "Base review of {{.code}}",
+		"overlay/_header.tmpl":     "{{define \"_header\"}}Overlay header{{end}}",
+		"overlay/review/code.tmpl": "Overlay review of {{.code}} in {{.language}}",
+		"overlay/extra.tmpl":       "Extra {{.topic}}",
+	}
+	for relPath, content := range files {
+		filePath := filepath.Join(s.tempDir, filepath.FromSlash(relPath))
+		require.NoError(s.T(), os.MkdirAll(filepath.Dir(filePath), 0755), "Failed to create directory")
+		require.NoError(s.T(), os.WriteFile(filePath, []byte(content), 0644), "Failed to write test file")
+	}
+
+	templateFiles, err := s.parser.ListTemplateFiles(baseDir, overlayDir)
+	require.NoError(s.T(), err, "ListTemplateFiles() unexpected error")
+	assert.Equal(s.T(), []TemplateFile{
+		{RelPath: "_header.tmpl", Root: overlayDir, ShadowedRoots: []string{baseDir}},
+		{RelPath: "extra.tmpl", Root: overlayDir},
+		{RelPath: "greeting.tmpl", Root: baseDir},
+		{RelPath: "review/code.tmpl", Root: overlayDir, ShadowedRoots: []string{baseDir}},
+	}, templateFiles, "ListTemplateFiles() returned unexpected files")
+
+	tmpl, err := s.parser.ParseDir(baseDir, overlayDir)
+	require.NoError(s.T(), err, "ParseDir() unexpected error")
+
+	data := map[string]interface{}{"name": "Alice", "code": "main.go", "language": "Go", "topic": "overlays"}
+	for templateName, expected := range map[string]string{
+		"greeting.tmpl": "Overlay header Hello Alice",
+		"review/code":   "Overlay review of main.go in Go",
+		"extra.tmpl":    "Extra overlays",
+		"_header":       "Overlay header",
+	} {
+		var result strings.Builder
+		require.NoError(s.T(), tmpl.ExecuteTemplate(&result, templateName, data), "Failed to execute %q", templateName)
+		assert.Equal(s.T(), expected, result.String(), "Unexpected output of %q", templateName)
+	}
+
+	// Reversing the order of directories reverses the precedence
+	tmpl, err = s.parser.ParseDir(overlayDir, baseDir)
+	require.NoError(s.T(), err, "ParseDir() unexpected error")
+	var result strings.Builder
+	require.NoError(s.T(), tmpl.ExecuteTemplate(&result, "review/code", data), "Failed to execute template")
+	assert.Equal(s.T(), "Base review of main.go", result.String(), "Earlier directory should be overridden")
+
+	_, err = s.parser.ParseDir(baseDir, filepath.Join(s.tempDir, "missing"))
+	assert.Error(s.T(), err, "ParseDir() expected error for non-existent directory")
+}
+
 // TestWalkNodesNilHandling tests nil node handling in walkNodes
 func (s *PromptsParserTestSuite) TestWalkNodesNilHandling() {
-	argsMap := make(map[string]struct{})
-	builtInFields := map[string]struct{}{"date": {}}
-	processedTemplates := make(map[string]bool)
+	walker := newArgumentsWalker(nil)
 
 	// This should return nil immediately for nil node
-	err := s.parser.walkNodes(nil, argsMap, builtInFields, nil, processedTemplates, []string{})
+	err := walker.walkNodes(nil, walkScope{path: []string{}, dot: rootDataRef, dollar: rootDataRef}, argKindScalar)
 	assert.NoError(s.T(), err, "walkNodes() with nil node should return nil")
 
-	// argsMap should remain empty
-	assert.Empty(s.T(), argsMap, "walkNodes() with nil node should not modify argsMap")
+	// args should remain empty
+	assert.Empty(s.T(), walker.args, "walkNodes() with nil node should not record arguments")
 }
 
 // TestWalkNodesVariableHandling tests variable node handling in walkNodes
@@ -290,7 +899,7 @@ func (s *PromptsParserTestSuite) TestWalkNodesVariableHandling() {
 
 	// Should only contain "input", not the template variables
 	expected := []string{"input"}
-	assert.Equal(s.T(), expected, args, "ExtractPromptArgumentsFromTemplate() should only return template data arguments, not dollar variables")
+	assert.Equal(s.T(), expected, templateArgumentNames(args), "ExtractPromptArgumentsFromTemplate() should only return template data arguments, not dollar variables")
 }
 
 // TestDict tests the dict helper function
@@ -351,3 +960,61 @@ func (s *PromptsParserTestSuite) TestDict() {
 		assert.Nil(s.T(), result, "dict() expected nil result for non-string key")
 	})
 }
+
+// templateArgumentNames is a helper function that returns names of the template arguments
+func templateArgumentNames(args []TemplateArgument) []string {
+	names := make([]string, 0, len(args))
+	for _, arg := range args {
+		names = append(names, arg.Name)
+	}
+	return names
+}
+
+// TestSplitRenderedMessages tests splitting of rendered prompt output into messages
+func (s *PromptsParserTestSuite) TestSplitRenderedMessages() {
+	marker := func(role string) string {
+		m, err := message(role)
+		require.NoError(s.T(), err, "message() unexpected error")
+		return m
+	}
+
+	tests := []struct {
+		name     string
+		output   string
+		expected []renderedMessage
+	}{
+		{
+			name:     "no markers",
+			output:   "  Hello John!\n",
+			expected: []renderedMessage{{Role: "user", Text: "  Hello John!\n"}},
+		},
+		{
+			name:   "multiple messages",
+			output: "\n" + marker("system") + "\nBe brief.\n" + marker("user") + "Hi\n" + marker("assistant") + " Hello ",
+			expected: []renderedMessage{
+				{Role: "system", Text: "Be brief."},
+				{Role: "user", Text: "Hi"},
+				{Role: "assistant", Text: "Hello"},
+			},
+		},
+		{
+			name:   "text before first marker and empty messages",
+			output: "Intro" + marker("assistant") + "\n\n" + marker("assistant") + "Prefill",
+			expected: []renderedMessage{
+				{Role: "user", Text: "Intro"},
+				{Role: "assistant", Text: "Prefill"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			assert.Equal(s.T(), tt.expected, splitRenderedMessages(tt.output), "splitRenderedMessages() returned unexpected messages")
+		})
+	}
+
+	s.Run("unknown role", func() {
+		_, err := message("tool")
+		assert.Error(s.T(), err, "message() expected error for unknown role")
+	})
+}
@@ -3,11 +3,18 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
+	"net"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"text/template"
@@ -18,19 +25,85 @@ import (
 	"github.com/mark3labs/mcp-go/server"
 )
 
+const (
+	streamableHTTPEndpoint = "/mcp"
+	httpReadHeaderTimeout  = 10 * time.Second
+	httpShutdownTimeout    = 5 * time.Second
+)
+
+const defaultPromptNameSeparator = "/"
+
+// defaultReloadDebounce is long enough to coalesce an editor's save sequence or a git checkout into a single reload.
+const defaultReloadDebounce = 100 * time.Millisecond
+
+// loadErrorsResourceURI is the URI of the MCP resource listing templates that failed to load.
+const loadErrorsResourceURI = "prompt-engine://load-errors"
+
+// Template files are exposed as MCP resources with URIs like "prompt://review/security.tmpl".
+const (
+	templateResourceScheme   = "prompt://"
+	templateResourceMIMEType = "text/x-go-template"
+)
+
 type PromptsServer struct {
-	mcpServer         *server.MCPServer
-	parser            *PromptsParser
-	promptsDir        string
-	enableJSONArgs    bool
-	logger            *slog.Logger
-	watcher           *fsnotify.Watcher
-	registeredPrompts []string
+	mcpServer           *server.MCPServer
+	parser              *PromptsParser
+	promptsDirs         []string
+	enableJSONArgs      bool
+	promptNameSeparator string
+	reloadDebounce      time.Duration
+	enablePromptTools   bool
+	includeRoots        []string
+	maxIncludeSize      int64
+	files               *fileIncluder
+	execAllow           []string
+	execTimeout         time.Duration
+	execMaxOutput       int
+	execDir             string
+	executor            *commandExecutor
+	gitDir              string
+	git                 *gitRepository
+	now                 func() time.Time
+	timezone            *time.Location
+	clock               *templateClock
+	logger              *slog.Logger
+	// auditLogger logs commands run by exec and the git built-in data, the logger of the server if it is nil
+	auditLogger         *slog.Logger
+	watcher             *fsnotify.Watcher
+	argHistory          *argumentHistory
+	registeredPrompts   map[string]mcp.Prompt
+	registeredResources map[string]mcp.Resource
+
+	mu            sync.RWMutex
+	prompts       map[string]loadedPrompt
+	resourcePaths map[string]string
+	loadErrors    TemplateErrors
+}
+
+// PromptsServerOption configures optional PromptsServer behavior.
+type PromptsServerOption func(ps *PromptsServer)
+
+// WithPromptNameSeparator sets the separator used to join subdirectory names into prompt names
+// (e.g. "review/security" with the default "/" separator, or "review.security" with ".").
+func WithPromptNameSeparator(separator string) PromptsServerOption {
+	return func(ps *PromptsServer) {
+		ps.promptNameSeparator = separator
+	}
 }
 
-// NewPromptsServer creates a new PromptsServer instance that serves prompts from the specified directory.
+// WithReloadDebounce sets how long the server waits after the last file change before reloading prompts.
+// All changes within the window are coalesced into a single reload.
+func WithReloadDebounce(debounce time.Duration) PromptsServerOption {
+	return func(ps *PromptsServer) {
+		ps.reloadDebounce = debounce
+	}
+}
+
+// NewPromptsServer creates a new PromptsServer instance that serves prompts from the specified directories.
+// Directories are overlaid in order: a template in a later directory overrides the template with the same
+// relative path in earlier ones.
 func NewPromptsServer(
-	promptsDir string, enableJSONArgs bool, logger *slog.Logger,
+	promptsDirs []string, enableJSONArgs bool, logger *slog.Logger, opts ...PromptsServerOption,
 ) (promptsServer *PromptsServer, err error) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -44,10 +117,6 @@ func NewPromptsServer(
 		}
 	}()
 
-	if err = watcher.Add(promptsDir); err != nil {
-		return nil, fmt.Errorf("add prompts directory to watcher: %w", err)
-	}
-
 	srvHooks := &server.Hooks{}
 	srvHooks.AddBeforeGetPrompt(func(ctx context.Context, id any, message *mcp.GetPromptRequest) {
 		logger.Info("Received prompt request",
@@ -58,6 +127,31 @@ func NewPromptsServer(
 			"id", id, "params_name", message.Params.Name, "params_args", message.Params.Arguments)
 
 	})
+	argHistory := newArgumentHistory()
+	srvHooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+		argHistory.Forget(session.SessionID())
+	})
+	promptsServer = &PromptsServer{
+		promptsDirs:         promptsDirs,
+		enableJSONArgs:      enableJSONArgs,
+		promptNameSeparator: defaultPromptNameSeparator,
+		reloadDebounce:      defaultReloadDebounce,
+		logger:              logger,
+		watcher:             watcher,
+		argHistory:          argHistory,
+	}
+	for _, opt := range opts {
+		opt(promptsServer)
+	}
+	promptsServer.initTemplateFuncs()
+	// Directories of included files are watched in addition to the prompts directories,
+	// so changes of the files reload prompts and clear the cached contents
+	promptsServer.files.watch = func(dir string) {
+		if err := watcher.Add(dir); err != nil {
+			logger.Error("Failed to watch directory of included file", "dir", dir, "error", err)
+		}
+	}
+
 	mcpServer := server.NewMCPServer(
 		"Custom Prompts Server",
 		"1.0.0",
@@ -65,15 +159,24 @@ func NewPromptsServer(
 		server.WithRecovery(),
 		server.WithHooks(srvHooks),
 		server.WithPromptCapabilities(true),
+		server.WithResourceCapabilities(false, true),
+		server.WithCompletions(),
+		server.WithPromptCompletionProvider(promptsServer),
 	)
+	promptsServer.mcpServer = mcpServer
+
+	mcpServer.AddResource(mcp.NewResource(loadErrorsResourceURI, "Prompt load errors",
+		mcp.WithResourceDescription("Template files that failed to load and were skipped"),
+		mcp.WithMIMEType("application/json"),
+	), promptsServer.handleLoadErrorsResource)
+	if promptsServer.enablePromptTools {
+		promptsServer.addPromptTools()
+	}
 
-	promptsServer = &PromptsServer{
-		mcpServer:      mcpServer,
-		parser:         &PromptsParser{},
-		promptsDir:     promptsDir,
-		enableJSONArgs: enableJSONArgs,
-		logger:         logger,
-		watcher:        watcher,
+	for _, promptsDir := range promptsDirs {
+		if err = promptsServer.watchDirs(promptsDir); err != nil {
+			return nil, fmt.Errorf("add prompts directory %q to watcher: %w", promptsDir, err)
+		}
 	}
 
 	if err = promptsServer.reloadPrompts(); err != nil {
@@ -83,6 +186,20 @@ func NewPromptsServer(
 	return promptsServer, nil
 }
 
+// initTemplateFuncs creates the file includer, the clock, the command executor and the git repository of the server
+// and the parser that binds the file and time functions to them.
+func (ps *PromptsServer) initTemplateFuncs() {
+	ps.files = newFileIncluder(ps.promptsDirs, ps.includeRoots, ps.maxIncludeSize)
+	ps.clock = newTemplateClock(ps.now, ps.timezone)
+	ps.parser = &PromptsParser{funcs: mergeFuncs(ps.files.funcs(), ps.clock.funcs())}
+	auditLogger := ps.auditLogger
+	if auditLogger == nil {
+		auditLogger = ps.logger
+	}
+	ps.executor = newCommandExecutor(ps.execAllow, ps.execTimeout, ps.execMaxOutput, ps.execDir, auditLogger)
+	ps.git = newGitRepository(ps.gitDir, ps.execTimeout, ps.execMaxOutput, auditLogger)
+}
+
 func (ps *PromptsServer) Close() error {
 	if ps.watcher != nil {
 		if err := ps.watcher.Close(); err != nil {
@@ -95,6 +212,35 @@ func (ps *PromptsServer) Close() error {
 
 // ServeStdio starts the MCP server with stdio transport and file watching.
 func (ps *PromptsServer) ServeStdio(ctx context.Context, stdin io.Reader, stdout io.Writer) error {
+	return ps.serve(ctx, "stdio", func(ctx context.Context) error {
+		return server.NewStdioServer(ps.mcpServer).Listen(ctx, stdin, stdout)
+	})
+}
+
+// ServeStreamableHTTP starts the MCP server with streamable HTTP transport on the given listener and file watching.
+// The MCP endpoint is served at streamableHTTPEndpoint.
+func (ps *PromptsServer) ServeStreamableHTTP(ctx context.Context, ln net.Listener) error {
+	mux := http.NewServeMux()
+	mux.Handle(streamableHTTPEndpoint, server.NewStreamableHTTPServer(ps.mcpServer))
+	return ps.serve(ctx, "streamable HTTP", func(ctx context.Context) error {
+		return ps.serveHTTP(ctx, ln, mux)
+	})
+}
+
+// ServeSSE starts the MCP server with legacy SSE transport on the given listener and file watching.
+// Clients connect to the "/sse" endpoint and post messages to the "/message" endpoint.
+func (ps *PromptsServer) ServeSSE(ctx context.Context, ln net.Listener) error {
+	return ps.serve(ctx, "SSE", func(ctx context.Context) error {
+		return ps.serveHTTP(ctx, ln, server.NewSSEServer(ps.mcpServer))
+	})
+}
+
+// serve runs the given transport listener alongside the prompts watcher until the context is cancelled
+// or the listener fails.
+func (ps *PromptsServer) serve(ctx context.Context, transportName string, listen func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	var wg sync.WaitGroup
 
 	wg.Add(1)
@@ -107,161 +253,515 @@ func (ps *PromptsServer) ServeStdio(ctx context.Context, stdin io.Reader, stdout
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		ps.logger.Info("Starting stdio server")
-		srvErrChan <- server.NewStdioServer(ps.mcpServer).Listen(ctx, stdin, stdout)
+		ps.logger.Info("Starting server", "transport", transportName)
+		srvErrChan <- listen(ctx)
 	}()
 
 	var srvErr error
 	select {
 	case srvErr = <-srvErrChan:
 		if srvErr != nil {
-			ps.logger.Error("Stdio server error", "error", srvErr)
+			ps.logger.Error("Server error", "transport", transportName, "error", srvErr)
 		}
 	case <-ctx.Done():
-		ps.logger.Info("Context cancelled, stopping server")
+		ps.logger.Info("Context cancelled, stopping server", "transport", transportName)
 	}
 
+	cancel()
 	wg.Wait()
 
 	return srvErr
 }
 
-func (ps *PromptsServer) loadServerPrompts() ([]server.ServerPrompt, error) {
-	tmpl, err := ps.parser.ParseDir(ps.promptsDir)
-	if err != nil {
-		return nil, fmt.Errorf("parse all prompts: %w", err)
+// serveHTTP serves the handler on the listener until the context is cancelled and then shuts the HTTP server down.
+// Request contexts are derived from ctx, so long-lived streams are closed as part of the shutdown.
+func (ps *PromptsServer) serveHTTP(ctx context.Context, ln net.Listener, handler http.Handler) error {
+	httpSrv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	srvErrChan := make(chan error, 1)
+	go func() {
+		srvErrChan <- httpSrv.Serve(ln)
+	}()
+
+	select {
+	case err := <-srvErrChan:
+		return fmt.Errorf("serve HTTP: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer shutdownCancel()
+	if err := httpSrv.Shutdown(shutdownCtx); err != nil {
+		ps.logger.Error("Failed to shutdown HTTP server gracefully", "error", err)
+		return fmt.Errorf("shutdown HTTP server: %w", err)
+	}
+	if err := <-srvErrChan; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serve HTTP: %w", err)
+	}
+	return nil
+}
+
+// loadedPrompt is a prompt loaded from a template file along with its arguments.
+type loadedPrompt struct {
+	server.ServerPrompt
+	args []promptArgument
+	// path is the path of the template file the prompt is loaded from
+	path     string
+	metadata PromptMetadata
+	// partials are the names of templates called by the prompt template, directly or transitively
+	partials []string
+	// envArgs are the argument values set by environment variables, which are not exposed to clients
+	envArgs map[string]string
+}
+
+// loadServerPrompts loads prompts from all template files. Template files that fail to load are skipped
+// and reported in the returned TemplateErrors. The error is returned only if the prompts directories cannot be read.
+func (ps *PromptsServer) loadServerPrompts() ([]loadedPrompt, TemplateErrors, error) {
+	tmpl, err := ps.parser.ParseDir(ps.promptsDirs...)
+	var templateErrs TemplateErrors
+	if err != nil && !errors.As(err, &templateErrs) {
+		return nil, nil, fmt.Errorf("parse all prompts: %w", err)
+	}
+	failedPaths := make(map[string]struct{}, len(templateErrs))
+	for _, templateErr := range templateErrs {
+		failedPaths[templateErr.Path] = struct{}{}
 	}
 
-	files, err := os.ReadDir(ps.promptsDir)
+	files, err := ps.parser.ListTemplateFiles(ps.promptsDirs...)
 	if err != nil {
-		return nil, fmt.Errorf("read prompts directory: %w", err)
+		return nil, nil, fmt.Errorf("list template files: %w", err)
+	}
+	for _, file := range files {
+		if len(file.ShadowedRoots) != 0 {
+			ps.logger.Info("Template overrides templates from earlier prompts directories",
+				"path", file.RelPath, "root", file.Root, "shadowed_roots", file.ShadowedRoots)
+		}
 	}
 
-	var serverPrompts []server.ServerPrompt
+	var loadedPrompts []loadedPrompt
+	promptPaths := make(map[string]string)
 	for _, file := range files {
-		if !file.Type().IsRegular() || !strings.HasSuffix(file.Name(), templateExt) || strings.HasPrefix(file.Name(), "_") {
+		relPath := file.RelPath
+		if strings.HasPrefix(path.Base(relPath), "_") {
 			continue
 		}
 
-		filePath := filepath.Join(ps.promptsDir, file.Name())
-		promptName := strings.TrimSuffix(file.Name(), templateExt)
+		filePath := file.Path()
+		if _, failed := failedPaths[filePath]; failed {
+			continue
+		}
+		templatePath := strings.TrimSuffix(relPath, templateExt)
+		promptName := strings.ReplaceAll(templatePath, "/", ps.promptNameSeparator)
+		if otherPath, exists := promptPaths[promptName]; exists {
+			templateErrs = append(templateErrs, &TemplateError{
+				Path: filePath, Err: fmt.Errorf("prompt name %q conflicts with %q", promptName, otherPath)})
+			continue
+		}
+		promptPaths[promptName] = relPath
 
-		templateName := promptName
+		templateName := templatePath
 		if tmpl.Lookup(templateName) == nil {
 			if tmpl.Lookup(templateName+templateExt) == nil {
-				return nil, fmt.Errorf("template %q or %q not found", templateName, templateName+templateExt)
+				templateErrs = append(templateErrs, &TemplateError{
+					Path: filePath, Err: fmt.Errorf("template %q or %q not found", templateName, templateName+templateExt)})
+				continue
 			}
 			templateName = templateName + templateExt
 		}
 
-		var description string
-		if description, err = ps.parser.ExtractPromptDescriptionFromFile(filePath); err != nil {
-			return nil, fmt.Errorf("extract prompt description from %q template file: %w", filePath, err)
+		var metadata PromptMetadata
+		if metadata, err = ps.parser.ExtractPromptMetadataFromFile(filePath); err != nil {
+			templateErrs = append(templateErrs, &TemplateError{Path: filePath, Err: fmt.Errorf("extract prompt metadata: %w", err)})
+			continue
 		}
 
-		var args []string
-		if args, err = ps.parser.ExtractPromptArgumentsFromTemplate(tmpl, promptName); err != nil {
-			return nil, fmt.Errorf("extract prompt arguments from %q template file: %w", filePath, err)
+		var args []TemplateArgument
+		if args, err = ps.parser.ExtractPromptArgumentsFromTemplate(tmpl, templateName); err != nil {
+			templateErrs = append(templateErrs, &TemplateError{Path: filePath, Err: fmt.Errorf("extract prompt arguments: %w", err)})
+			continue
 		}
-
-		envArgs := make(map[string]string)
-		var promptArgs []string
-		for _, arg := range args {
-			// Convert arg to TITLE_CASE for env var
-			envVarName := strings.ToUpper(arg)
-			if envValue, exists := os.LookupEnv(envVarName); exists {
-				envArgs[arg] = envValue
-			} else {
-				promptArgs = append(promptArgs, arg)
-			}
+		var builtIns []string
+		if builtIns, err = ps.parser.ExtractPromptBuiltInsFromTemplate(tmpl, templateName); err != nil {
+			templateErrs = append(templateErrs, &TemplateError{Path: filePath, Err: fmt.Errorf("extract prompt built-ins: %w", err)})
+			continue
 		}
 
 		promptOpts := []mcp.PromptOption{
-			mcp.WithPromptDescription(description),
+			mcp.WithPromptDescription(metadata.Description),
 		}
+		promptArgs, envArgs := newPromptArguments(args, metadata, ps.enableJSONArgs)
 		for _, promptArg := range promptArgs {
-			promptOpts = append(promptOpts, mcp.WithArgument(promptArg, mcp.RequiredArgument()))
+			var argOpts []mcp.ArgumentOption
+			if promptArg.required {
+				argOpts = append(argOpts, mcp.RequiredArgument())
+			}
+			if promptArg.description != "" {
+				argOpts = append(argOpts, mcp.ArgumentDescription(promptArg.description))
+			}
+			promptOpts = append(promptOpts, mcp.WithArgument(promptArg.name, argOpts...))
 		}
 
-		serverPrompts = append(serverPrompts, server.ServerPrompt{
-			Prompt:  mcp.NewPrompt(promptName, promptOpts...),
-			Handler: ps.makeMCPHandler(tmpl, templateName, description, envArgs),
+		loadedPrompts = append(loadedPrompts, loadedPrompt{
+			ServerPrompt: server.ServerPrompt{
+				Prompt:  mcp.NewPrompt(promptName, promptOpts...),
+				Handler: ps.makeMCPHandler(tmpl, templateName, metadata.Description, envArgs, promptArgs, gitFields(builtIns)),
+			},
+			args:     promptArgs,
+			path:     filePath,
+			metadata: metadata,
+			partials: ps.parser.ExtractPromptPartialsFromTemplate(tmpl, templateName),
+			envArgs:  envArgs,
 		})
 
 		ps.logger.Info("Prompt will be registered",
 			"name", promptName,
-			"description", description,
-			"prompt_args", promptArgs,
+			"root", file.Root,
+			"title", metadata.Title,
+			"description", metadata.Description,
+			"tags", metadata.Tags,
+			"prompt_args", promptArgNames(promptArgs),
 			"env_args", envArgs)
 	}
 
-	return serverPrompts, nil
+	sort.Slice(templateErrs, func(i, j int) bool { return templateErrs[i].Path < templateErrs[j].Path })
+	return loadedPrompts, templateErrs, nil
+}
+
+// LoadErrors returns template files that failed to load during the last successful reload.
+func (ps *PromptsServer) LoadErrors() TemplateErrors {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return ps.loadErrors
+}
+
+// loadErrorEntry is a JSON representation of a template load error.
+type loadErrorEntry struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+func (ps *PromptsServer) handleLoadErrorsResource(
+	ctx context.Context, request mcp.ReadResourceRequest,
+) ([]mcp.ResourceContents, error) {
+	templateErrs := ps.LoadErrors()
+	entries := make([]loadErrorEntry, 0, len(templateErrs))
+	for _, templateErr := range templateErrs {
+		entries = append(entries, loadErrorEntry{Path: templateErr.Path, Error: templateErr.Err.Error()})
+	}
+	content, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal load errors: %w", err)
+	}
+	return []mcp.ResourceContents{mcp.TextResourceContents{
+		URI:      loadErrorsResourceURI,
+		MIMEType: "application/json",
+		Text:     string(content),
+	}}, nil
 }
 
 func (ps *PromptsServer) reloadPrompts() error {
-	newServerPrompts, err := ps.loadServerPrompts()
+	ps.files.reset()
+	newPrompts, templateErrs, err := ps.loadServerPrompts()
 	if err != nil {
 		return fmt.Errorf("load server prompts: %w", err)
 	}
+	for _, templateErr := range templateErrs {
+		ps.logger.Error("Failed to load template, skipping it", "path", templateErr.Path, "error", templateErr.Err)
+	}
+	if err = ps.reloadResources(); err != nil {
+		return fmt.Errorf("reload template resources: %w", err)
+	}
 
-	if len(ps.registeredPrompts) > 0 {
-		ps.mcpServer.DeletePrompts(ps.registeredPrompts...)
+	newPromptsByName := make(map[string]loadedPrompt, len(newPrompts))
+	newRegisteredPrompts := make(map[string]mcp.Prompt, len(newPrompts))
+	var changedPrompts []server.ServerPrompt
+	for _, prompt := range newPrompts {
+		name := prompt.Prompt.Name
+		newPromptsByName[name] = prompt
+		newRegisteredPrompts[name] = prompt.Prompt
+		if oldPrompt, exists := ps.registeredPrompts[name]; !exists || !reflect.DeepEqual(oldPrompt, prompt.Prompt) {
+			changedPrompts = append(changedPrompts, server.ServerPrompt{Prompt: prompt.Prompt, Handler: ps.handleGetPrompt})
+		}
+	}
+	var removedPrompts []string
+	for name := range ps.registeredPrompts {
+		if _, exists := newRegisteredPrompts[name]; !exists {
+			removedPrompts = append(removedPrompts, name)
+		}
 	}
-	ps.logger.Info("Removed existing prompts", "count", len(ps.registeredPrompts))
 
-	ps.mcpServer.AddPrompts(newServerPrompts...)
-	ps.logger.Info("Added new prompts", "count", len(newServerPrompts))
+	// Handlers are swapped in place, so template changes that keep the catalog identical
+	// do not touch the MCP server and do not notify clients
+	ps.mu.Lock()
+	ps.prompts = newPromptsByName
+	ps.loadErrors = templateErrs
+	ps.mu.Unlock()
+	ps.registeredPrompts = newRegisteredPrompts
+
+	if len(changedPrompts) == 0 && len(removedPrompts) == 0 {
+		ps.logger.Info("Prompts catalog is unchanged, clients are not notified", "count", len(newPrompts))
+		return nil
+	}
 
-	ps.registeredPrompts = make([]string, 0, len(newServerPrompts))
-	for _, prompt := range newServerPrompts {
-		ps.registeredPrompts = append(ps.registeredPrompts, prompt.Prompt.Name)
+	// Both calls notify clients with notifications/prompts/list_changed
+	if len(removedPrompts) != 0 {
+		sort.Strings(removedPrompts)
+		ps.mcpServer.DeletePrompts(removedPrompts...)
 	}
+	if len(changedPrompts) != 0 {
+		ps.mcpServer.AddPrompts(changedPrompts...)
+	}
+	ps.logger.Info("Prompts catalog changed, clients are notified",
+		"count", len(newPrompts), "added_or_changed", len(changedPrompts), "removed", removedPrompts)
 
 	return nil
 }
 
+// loadTemplateResources returns MCP resources for all template files, including partials and templates
+// that failed to load, along with the paths of the files keyed by resource URI.
+func (ps *PromptsServer) loadTemplateResources() ([]mcp.Resource, map[string]string, error) {
+	files, err := ps.parser.ListTemplateFiles(ps.promptsDirs...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list template files: %w", err)
+	}
+
+	resources := make([]mcp.Resource, 0, len(files))
+	paths := make(map[string]string, len(files))
+	for _, file := range files {
+		// Broken front matter is reported by the prompts loading, the raw source is still worth exposing
+		metadata, _ := ps.parser.ExtractPromptMetadataFromFile(file.Path())
+		var description string
+		if strings.HasPrefix(path.Base(file.RelPath), "_") {
+			description = "Partial template"
+		} else {
+			promptName := strings.ReplaceAll(strings.TrimSuffix(file.RelPath, templateExt), "/", ps.promptNameSeparator)
+			description = fmt.Sprintf("Template of the %q prompt", promptName)
+		}
+		if metadata.Description != "" {
+			description += ": " + metadata.Description
+		}
+
+		uri := templateResourceScheme + file.RelPath
+		resources = append(resources, mcp.NewResource(uri, file.RelPath,
+			mcp.WithResourceDescription(description),
+			mcp.WithMIMEType(templateResourceMIMEType),
+		))
+		paths[uri] = file.Path()
+	}
+	return resources, paths, nil
+}
+
+// reloadResources syncs template resources registered in the MCP server with the template files.
+// Clients are notified with notifications/resources/list_changed only if resources are added, removed or changed.
+func (ps *PromptsServer) reloadResources() error {
+	resources, paths, err := ps.loadTemplateResources()
+	if err != nil {
+		return err
+	}
+
+	newRegisteredResources := make(map[string]mcp.Resource, len(resources))
+	var changedResources []server.ServerResource
+	for _, resource := range resources {
+		newRegisteredResources[resource.URI] = resource
+		if oldResource, exists := ps.registeredResources[resource.URI]; !exists || !reflect.DeepEqual(oldResource, resource) {
+			changedResources = append(changedResources, server.ServerResource{Resource: resource, Handler: ps.handleTemplateResource})
+		}
+	}
+	var removedURIs []string
+	for uri := range ps.registeredResources {
+		if _, exists := newRegisteredResources[uri]; !exists {
+			removedURIs = append(removedURIs, uri)
+		}
+	}
+
+	ps.mu.Lock()
+	ps.resourcePaths = paths
+	ps.mu.Unlock()
+	ps.registeredResources = newRegisteredResources
+
+	sort.Strings(removedURIs)
+	for _, uri := range removedURIs {
+		ps.mcpServer.RemoveResource(uri)
+	}
+	if len(changedResources) != 0 {
+		ps.mcpServer.AddResources(changedResources...)
+	}
+	if len(changedResources) != 0 || len(removedURIs) != 0 {
+		ps.logger.Info("Template resources changed, clients are notified",
+			"count", len(resources), "added_or_changed", len(changedResources), "removed", removedURIs)
+	}
+	return nil
+}
+
+// handleTemplateResource returns the current source of the template file.
+func (ps *PromptsServer) handleTemplateResource(
+	ctx context.Context, request mcp.ReadResourceRequest,
+) ([]mcp.ResourceContents, error) {
+	ps.mu.RLock()
+	filePath, ok := ps.resourcePaths[request.Params.URI]
+	ps.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("template resource %q not found", request.Params.URI)
+	}
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("read template file: %w", err)
+	}
+	return []mcp.ResourceContents{mcp.TextResourceContents{
+		URI:      request.Params.URI,
+		MIMEType: templateResourceMIMEType,
+		Text:     string(content),
+	}}, nil
+}
+
+// handleGetPrompt dispatches the prompt request to the handler of the currently loaded prompt.
+func (ps *PromptsServer) handleGetPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	ps.mu.RLock()
+	prompt, ok := ps.prompts[request.Params.Name]
+	ps.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("prompt %q not found", request.Params.Name)
+	}
+	result, err := prompt.Handler(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	ps.argHistory.Record(sessionID(ctx), request.Params.Name, request.Params.Arguments)
+	return result, nil
+}
+
 func (ps *PromptsServer) makeMCPHandler(
-	tmpl *template.Template, templateName string, description string, envArgs map[string]string,
+	tmpl *template.Template,
+	templateName string,
+	description string,
+	envArgs map[string]string,
+	promptArgs []promptArgument,
+	gitFields []string,
 ) func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
 	return func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
 		data := make(map[string]interface{})
-		data["date"] = time.Now().Format("2006-01-02 15:04:05")
+		data["date"] = ps.clock.date()
 		for arg, value := range envArgs {
 			data[arg] = value
 		}
-		parseMCPArgs(request.Params.Arguments, ps.enableJSONArgs, data)
+		if err := parsePromptArgs(promptArgs, request.Params.Arguments, ps.enableJSONArgs, data); err != nil {
+			return nil, err
+		}
+		// Git data is computed only if the template references it, and only the referenced fields.
+		// It can be given as an argument instead, e.g. to pin it in prompt tests
+		if _, provided := data[gitBuiltIn]; !provided && len(gitFields) != 0 {
+			gitData, err := ps.git.data(ctx, request.Params.Name, gitFields)
+			if err != nil {
+				return nil, err
+			}
+			data[gitBuiltIn] = gitData
+		}
+
+		// Commands executed by the template are bound to the request, so the template set is cloned
+		// to give it its own exec function
+		execTmpl := tmpl
+		if ps.executor != nil {
+			var err error
+			if execTmpl, err = tmpl.Clone(); err != nil {
+				return nil, fmt.Errorf("clone template %q: %w", templateName, err)
+			}
+			execTmpl.Funcs(template.FuncMap{"exec": ps.executor.bind(ctx, request.Params.Name)})
+		}
 
 		var result strings.Builder
-		if err := tmpl.ExecuteTemplate(&result, templateName, data); err != nil {
+		if err := execTmpl.ExecuteTemplate(&result, templateName, data); err != nil {
 			return nil, fmt.Errorf("execute template %q: %w", templateName, err)
 		}
 
-		return mcp.NewGetPromptResult(
-			description,
-			[]mcp.PromptMessage{
-				mcp.NewPromptMessage(
-					mcp.RoleUser,
-					mcp.NewTextContent(result.String()),
-				),
-			},
-		), nil
+		renderedMessages := splitRenderedMessages(result.String())
+		promptMessages := make([]mcp.PromptMessage, 0, len(renderedMessages))
+		for _, msg := range renderedMessages {
+			promptMessages = append(promptMessages, mcp.NewPromptMessage(
+				mcpRole(msg.Role),
+				mcp.NewTextContent(msg.Text),
+			))
+		}
+
+		return mcp.NewGetPromptResult(description, promptMessages), nil
 	}
 }
 
-// startWatcher monitors file system changes and reloads prompts
+// mcpRole maps the message role to the MCP role.
+// MCP prompts have no system role, so system messages are sent as user messages.
+func mcpRole(role string) mcp.Role {
+	if role == messageRoleAssistant {
+		return mcp.RoleAssistant
+	}
+	return mcp.RoleUser
+}
+
+// watchDirs adds the directory and all its non-hidden subdirectories to the file watcher.
+func (ps *PromptsServer) watchDirs(dir string) error {
+	return filepath.WalkDir(dir, func(dirPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if dirPath != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if err = ps.watcher.Add(dirPath); err != nil {
+			return fmt.Errorf("watch %q: %w", dirPath, err)
+		}
+		return nil
+	})
+}
+
+// startWatcher monitors file system changes and reloads prompts.
+// Changes are coalesced: prompts are reloaded once no further changes arrive within the reload debounce window.
 func (ps *PromptsServer) startWatcher(ctx context.Context) {
-	ps.logger.Info("Started watching prompts directory for changes", "dir", ps.promptsDir)
+	ps.logger.Info("Started watching prompts directories for changes",
+		"dirs", ps.promptsDirs, "reload_debounce", ps.reloadDebounce)
 
+	reloadTimer := time.NewTimer(ps.reloadDebounce)
+	reloadTimer.Stop()
+	defer reloadTimer.Stop()
+
+	// Operations on every changed path since the last reload
+	changes := make(map[string]fsnotify.Op)
 	for {
 		select {
 		case event, ok := <-ps.watcher.Events:
 			if !ok {
 				return
 			}
-			if !strings.HasSuffix(event.Name, templateExt) {
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if strings.HasPrefix(filepath.Base(event.Name), ".") {
+						continue
+					}
+					// Watch the new subdirectory right away, so files created in it during the burst are not missed
+					if err = ps.watchDirs(event.Name); err != nil {
+						ps.logger.Error("Failed to watch prompts subdirectory", "dir", event.Name, "error", err)
+					}
+					changes[event.Name] |= event.Op
+					reloadTimer.Reset(ps.reloadDebounce)
+					continue
+				}
+			}
+			// Removed or renamed paths without extension are most likely subdirectories with templates
+			isDirRemoval := event.Has(fsnotify.Remove|fsnotify.Rename) && filepath.Ext(event.Name) == ""
+			if !strings.HasSuffix(event.Name, templateExt) && !isDirRemoval && !ps.files.isIncluded(event.Name) {
 				continue
 			}
-			ps.logger.Info("Prompt template file changed", "file", event.Name, "operation", event.Op.String())
+			changes[event.Name] |= event.Op
+			reloadTimer.Reset(ps.reloadDebounce)
+
+		case <-reloadTimer.C:
+			ps.logger.Info("Prompt template or included files changed, reloading prompts",
+				"count", len(changes), "changes", summarizeChanges(changes))
+			changes = make(map[string]fsnotify.Op)
 			if err := ps.reloadPrompts(); err != nil {
 				ps.logger.Error("Failed to reload prompts", "error", err)
 			}
@@ -279,18 +779,12 @@ func (ps *PromptsServer) startWatcher(ctx context.Context) {
 	}
 }
 
-// parseMCPArgs attempts to parse each argument value as JSON when enableJSONArgs is true.
-// If parsing succeeds, stores the parsed value (bool, number, nil, object, etc.) in the data map.
-// If parsing fails or JSON parsing is disabled, stores the original string value.
-func parseMCPArgs(args map[string]string, enableJSONArgs bool, data map[string]interface{}) {
-	for key, value := range args {
-		if enableJSONArgs {
-			var parsed interface{}
-			if err := json.Unmarshal([]byte(value), &parsed); err == nil {
-				data[key] = parsed
-				continue
-			}
-		}
-		data[key] = value
+// summarizeChanges returns sorted "path (operations)" descriptions of the changed paths.
+func summarizeChanges(changes map[string]fsnotify.Op) []string {
+	summary := make([]string, 0, len(changes))
+	for changedPath, op := range changes {
+		summary = append(summary, fmt.Sprintf("%s (%s)", changedPath, op))
 	}
+	sort.Strings(summary)
+	return summary
 }
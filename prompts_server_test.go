@@ -3,10 +3,15 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -18,6 +23,9 @@ import (
 	"github.com/stretchr/testify/suite"
 )
 
+// testReloadDebounce keeps reloads fast enough for tests that wait 100ms after changing files.
+const testReloadDebounce = 10 * time.Millisecond
+
 type PromptsServerTestSuite struct {
 	suite.Suite
 	tempDir string
@@ -59,135 +67,549 @@ func (s *PromptsServerTestSuite) TestServeStdio() {
 	assert.Equal(s.T(), expectedContent, actualContent, "Unexpected message content")
 }
 
-// TestParseMCPArgs tests parseMCPArgs function functionality
-func (s *PromptsServerTestSuite) TestParseMCPArgs() {
-	tests := []struct {
-		name           string
-		input          map[string]string
-		enableJSONArgs bool
-		expected       map[string]interface{}
+// TestServeStreamableHTTP tests basic server integration with prompts using ServeStreamableHTTP
+func (s *PromptsServerTestSuite) TestServeStreamableHTTP() {
+	s.testServeHTTPTransport(transportHTTP)
+}
+
+// TestServeSSE tests basic server integration with prompts using ServeSSE
+func (s *PromptsServerTestSuite) TestServeSSE() {
+	s.testServeHTTPTransport(transportSSE)
+}
+
+func (s *PromptsServerTestSuite) testServeHTTPTransport(transport string) {
+	ctx := context.Background()
+
+	_, mcpClient, promptsClose := s.makePromptsServerAndHTTPClient(ctx, "./testdata", transport)
+	defer promptsClose()
+
+	listResult, err := mcpClient.ListPrompts(ctx, mcp.ListPromptsRequest{})
+	require.NoError(s.T(), err, "ListPrompts failed")
+	assert.NotEmpty(s.T(), listResult.Prompts, "Expected prompts to be listed")
+
+	var getReq mcp.GetPromptRequest
+	getReq.Params.Name = "greeting"
+	getReq.Params.Arguments = map[string]string{"name": "John"}
+	getResult, err := mcpClient.GetPrompt(ctx, getReq)
+	require.NoError(s.T(), err, "GetPrompt failed")
+
+	assert.Equal(s.T(), "Greeting standalone template with no partials", getResult.Description, "Unexpected prompt description")
+	require.Len(s.T(), getResult.Messages, 1, "Expected exactly 1 message")
+
+	content, ok := getResult.Messages[0].Content.(mcp.TextContent)
+	require.True(s.T(), ok, "Expected TextContent")
+	assert.Equal(s.T(), "Hello John!\nHave a great day!", normalizeNewlines(content.Text), "Unexpected message content")
+}
+
+// TestServeStdioWithFrontMatter tests that front matter metadata is exposed in prompt listings
+func (s *PromptsServerTestSuite) TestServeStdioWithFrontMatter() {
+	ctx := context.Background()
+
+	_, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, "./testdata", true)
+	defer promptsClose()
+
+	listResult, err := mcpClient.ListPrompts(ctx, mcp.ListPromptsRequest{})
+	require.NoError(s.T(), err, "ListPrompts failed")
+
+	var prompt *mcp.Prompt
+	for i := range listResult.Prompts {
+		if listResult.Prompts[i].Name == "front_matter_greeting" {
+			prompt = &listResult.Prompts[i]
+			break
+		}
+	}
+	require.NotNil(s.T(), prompt, "front_matter_greeting prompt not found in list")
+	assert.Equal(s.T(), "Greeting template with YAML front matter", prompt.Description, "Unexpected prompt description")
+	require.Len(s.T(), prompt.Arguments, 1, "Expected exactly 1 argument")
+	assert.Equal(s.T(), "name", prompt.Arguments[0].Name, "Unexpected argument name")
+	assert.Equal(s.T(), "Name of the person to greet", prompt.Arguments[0].Description, "Unexpected argument description")
+
+	var getReq mcp.GetPromptRequest
+	getReq.Params.Name = "front_matter_greeting"
+	getReq.Params.Arguments = map[string]string{"name": "John"}
+	getResult, err := mcpClient.GetPrompt(ctx, getReq)
+	require.NoError(s.T(), err, "GetPrompt failed")
+	require.Len(s.T(), getResult.Messages, 1, "Expected exactly 1 message")
+	content, ok := getResult.Messages[0].Content.(mcp.TextContent)
+	require.True(s.T(), ok, "Expected TextContent")
+	assert.Equal(s.T(), "Hello John!", normalizeNewlines(content.Text), "Front matter should not be rendered")
+}
+
+// TestServeStdioWithOptionalArguments tests required flags and default values of prompt arguments
+func (s *PromptsServerTestSuite) TestServeStdioWithOptionalArguments() {
+	ctx := context.Background()
+
+	_, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, "./testdata", true)
+	defer promptsClose()
+
+	listResult, err := mcpClient.ListPrompts(ctx, mcp.ListPromptsRequest{})
+	require.NoError(s.T(), err, "ListPrompts failed")
+
+	var prompt *mcp.Prompt
+	for i := range listResult.Prompts {
+		if listResult.Prompts[i].Name == "optional_args" {
+			prompt = &listResult.Prompts[i]
+			break
+		}
+	}
+	require.NotNil(s.T(), prompt, "optional_args prompt not found in list")
+
+	gotArgs := make(map[string]mcp.PromptArgument, len(prompt.Arguments))
+	for _, arg := range prompt.Arguments {
+		gotArgs[arg.Name] = arg
+	}
+	assert.Equal(s.T(), map[string]mcp.PromptArgument{
+		"code":                 {Name: "code", Description: "Code to review", Required: true},
+		"programming_language": {Name: "programming_language", Description: "Programming language of the code"},
+		"context":              {Name: "context", Description: "Additional context for the review"},
+		"reviewer":             {Name: "reviewer", Required: true},
+	}, gotArgs, "Unexpected prompt arguments")
+
+	var getReq mcp.GetPromptRequest
+	getReq.Params.Name = "optional_args"
+	getReq.Params.Arguments = map[string]string{"code": "fmt.Println()", "reviewer": "Alice"}
+	getResult, err := mcpClient.GetPrompt(ctx, getReq)
+	require.NoError(s.T(), err, "GetPrompt failed")
+	require.Len(s.T(), getResult.Messages, 1, "Expected exactly 1 message")
+	content, ok := getResult.Messages[0].Content.(mcp.TextContent)
+	require.True(s.T(), ok, "Expected TextContent")
+	assert.Equal(s.T(), "Review the following Go code:\nfmt.Println()\nReviewer: Alice",
+		normalizeNewlines(content.Text), "Default value should be applied for the missing argument")
+
+	getReq.Params.Arguments = map[string]string{
+		"code": "print()", "programming_language": "Python", "context": "CLI tool", "reviewer": "",
+	}
+	getResult, err = mcpClient.GetPrompt(ctx, getReq)
+	require.NoError(s.T(), err, "GetPrompt failed")
+	content, ok = getResult.Messages[0].Content.(mcp.TextContent)
+	require.True(s.T(), ok, "Expected TextContent")
+	assert.Equal(s.T(), "Review the following Python code:\nprint()\nContext: CLI tool",
+		normalizeNewlines(content.Text), "Provided argument should override the default value")
+}
+
+// TestServeStdioWithTypedArguments tests validation and coercion of typed prompt arguments
+func (s *PromptsServerTestSuite) TestServeStdioWithTypedArguments() {
+	ctx := context.Background()
+
+	_, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, "./testdata", false)
+	defer promptsClose()
+
+	var getReq mcp.GetPromptRequest
+	getReq.Params.Name = "typed_args"
+	getReq.Params.Arguments = map[string]string{"count": "2", "items": `["a", "b"]`, "format": "markdown"}
+	getResult, err := mcpClient.GetPrompt(ctx, getReq)
+	require.NoError(s.T(), err, "GetPrompt failed")
+	require.Len(s.T(), getResult.Messages, 1, "Expected exactly 1 message")
+	content, ok := getResult.Messages[0].Content.(mcp.TextContent)
+	require.True(s.T(), ok, "Expected TextContent")
+	assert.Equal(s.T(), "Format: markdown\n- a\n- b\nCount: 2", normalizeNewlines(content.Text),
+		"Typed arguments should be coerced even when JSON arguments are disabled")
+
+	getReq.Params.Arguments = map[string]string{"count": "0", "items": "[1,2", "format": "html"}
+	_, err = mcpClient.GetPrompt(ctx, getReq)
+	require.Error(s.T(), err, "Expected error for invalid arguments")
+	assert.Contains(s.T(), err.Error(), `"count": must be at least 1`, "Expected count to be reported")
+	assert.Contains(s.T(), err.Error(), `"format": must be one of: text, markdown`, "Expected format to be reported")
+	assert.Contains(s.T(), err.Error(), `"items": expected JSON array`, "Expected items to be reported")
+}
+
+// TestServeStdioWithMultipleMessages tests prompts split into messages with explicit roles
+func (s *PromptsServerTestSuite) TestServeStdioWithMultipleMessages() {
+	ctx := context.Background()
+
+	_, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, "./testdata", true)
+	defer promptsClose()
+
+	var getReq mcp.GetPromptRequest
+	getReq.Params.Name = "few_shot"
+	getReq.Params.Arguments = map[string]string{"word": "goodbye"}
+	getResult, err := mcpClient.GetPrompt(ctx, getReq)
+	require.NoError(s.T(), err, "GetPrompt failed")
+
+	expected := []struct {
+		role mcp.Role
+		text string
 	}{
-		{
-			name:           "empty arguments with JSON enabled",
-			input:          map[string]string{},
-			enableJSONArgs: true,
-			expected:       map[string]interface{}{},
-		},
-		{
-			name: "string arguments remain strings with JSON enabled",
-			input: map[string]string{
-				"name":    "John",
-				"message": "Hello World",
-			},
-			enableJSONArgs: true,
-			expected: map[string]interface{}{
-				"name":    "John",
-				"message": "Hello World",
-			},
-		},
-		{
-			name: "boolean arguments become booleans with JSON enabled",
-			input: map[string]string{
-				"enabled":  "true",
-				"disabled": "false",
-			},
-			enableJSONArgs: true,
-			expected: map[string]interface{}{
-				"enabled":  true,
-				"disabled": false,
-			},
-		},
-		{
-			name: "number arguments become numbers with JSON enabled",
-			input: map[string]string{
-				"count":   "42",
-				"price":   "19.99",
-				"balance": "-100.5",
-			},
-			enableJSONArgs: true,
-			expected: map[string]interface{}{
-				"count":   float64(42),
-				"price":   19.99,
-				"balance": -100.5,
-			},
-		},
-		{
-			name: "null argument becomes nil with JSON enabled",
-			input: map[string]string{
-				"optional": "null",
-			},
-			enableJSONArgs: true,
-			expected: map[string]interface{}{
-				"optional": nil,
-			},
-		},
-		{
-			name: "array arguments become arrays with JSON enabled",
-			input: map[string]string{
-				"items":   `["apple", "banana", "cherry"]`,
-				"numbers": `[1, 2, 3]`,
-			},
-			enableJSONArgs: true,
-			expected: map[string]interface{}{
-				"items":   []interface{}{"apple", "banana", "cherry"},
-				"numbers": []interface{}{float64(1), float64(2), float64(3)},
-			},
-		},
-		{
-			name: "object arguments become objects with JSON enabled",
-			input: map[string]string{
-				"user": `{"name": "Alice", "age": 30, "active": true}`,
-			},
-			enableJSONArgs: true,
-			expected: map[string]interface{}{
-				"user": map[string]interface{}{
-					"name":   "Alice",
-					"age":    float64(30),
-					"active": true,
-				},
-			},
-		},
-		{
-			name: "invalid JSON remains as strings with JSON enabled",
-			input: map[string]string{
-				"invalid_json": `{name: "Alice"}`,  // Missing quotes around key
-				"incomplete":   `{"name": "Alice"`, // Missing closing brace
-			},
-			enableJSONArgs: true,
-			expected: map[string]interface{}{
-				"invalid_json": `{name: "Alice"}`,
-				"incomplete":   `{"name": "Alice"`,
-			},
-		},
-		{
-			name: "all arguments remain strings when JSON disabled",
-			input: map[string]string{
-				"name":     "John",
-				"enabled":  "true",
-				"count":    "42",
-				"optional": "null",
-				"items":    `["a", "b"]`,
-			},
-			enableJSONArgs: false,
-			expected: map[string]interface{}{
-				"name":     "John",
-				"enabled":  "true",
-				"count":    "42",
-				"optional": "null",
-				"items":    `["a", "b"]`,
-			},
-		},
+		{mcp.RoleUser, "You are a helpful translator."},
+		{mcp.RoleUser, `Translate "hello" to French.`},
+		{mcp.RoleAssistant, "Bonjour"},
+		{mcp.RoleUser, `Translate "goodbye" to French.`},
+	}
+	require.Len(s.T(), getResult.Messages, len(expected), "Unexpected number of messages")
+	for i, exp := range expected {
+		assert.Equal(s.T(), exp.role, getResult.Messages[i].Role, "Unexpected role of message %d", i)
+		content, ok := getResult.Messages[i].Content.(mcp.TextContent)
+		require.True(s.T(), ok, "Expected TextContent")
+		assert.Equal(s.T(), exp.text, content.Text, "Unexpected text of message %d", i)
 	}
+}
 
-	for _, tt := range tests {
-		s.Run(tt.name, func() {
-			data := make(map[string]interface{})
-			parseMCPArgs(tt.input, tt.enableJSONArgs, data)
-			assert.Equal(s.T(), tt.expected, data, "parseMCPArgs() returned unexpected result")
+// TestServeStdioWithNestedPrompts tests namespaced prompt names for templates in subdirectories
+func (s *PromptsServerTestSuite) TestServeStdioWithNestedPrompts() {
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		separator  string
+		promptName string
+	}{
+		{separator: "", promptName: "review/security"},
+		{separator: ".", promptName: "review.security"},
+	} {
+		s.Run(tt.promptName, func() {
+			var opts []PromptsServerOption
+			if tt.separator != "" {
+				opts = append(opts, WithPromptNameSeparator(tt.separator))
+			}
+			_, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, "./testdata", true, opts...)
+			defer promptsClose()
+
+			listResult, err := mcpClient.ListPrompts(ctx, mcp.ListPromptsRequest{})
+			require.NoError(s.T(), err, "ListPrompts failed")
+			var promptNames []string
+			for _, prompt := range listResult.Prompts {
+				promptNames = append(promptNames, prompt.Name)
+			}
+			assert.Contains(s.T(), promptNames, tt.promptName, "Nested prompt should be listed")
+			assert.NotContains(s.T(), promptNames, "shared"+tt.separator+"_role", "Nested partial should not be listed")
+
+			var getReq mcp.GetPromptRequest
+			getReq.Params.Name = tt.promptName
+			getReq.Params.Arguments = map[string]string{"src_path": "main.go", "role": "a security engineer"}
+			getResult, err := mcpClient.GetPrompt(ctx, getReq)
+			require.NoError(s.T(), err, "GetPrompt failed")
+			require.Len(s.T(), getResult.Messages, 1, "Expected exactly 1 message")
+			content, ok := getResult.Messages[0].Content.(mcp.TextContent)
+			require.True(s.T(), ok, "Expected TextContent")
+			assert.Equal(s.T(), "You are a security engineer.\nReview main.go for vulnerabilities.",
+				normalizeNewlines(content.Text), "Unexpected message content")
 		})
 	}
 }
 
+// TestReloadPromptsSubdirectoryAdded tests that subdirectories created after startup are watched
+func (s *PromptsServerTestSuite) TestReloadPromptsSubdirectoryAdded() {
+	ctx := context.Background()
+
+	err := os.WriteFile(filepath.Join(s.tempDir, "initial_prompt.tmpl"), []byte("Hello {{.name}}!"), 0644)
+	require.NoError(s.T(), err, "Failed to write initial prompt file")
+
+	_, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, s.tempDir, true)
+	defer promptsClose()
+
+	subDir := filepath.Join(s.tempDir, "team")
+	require.NoError(s.T(), os.Mkdir(subDir, 0755), "Failed to create subdirectory")
+	time.Sleep(100 * time.Millisecond)
+
+	err = os.WriteFile(filepath.Join(subDir, "standup.tmpl"), []byte("Standup for {{.team}}"), 0644)
+	require.NoError(s.T(), err, "Failed to write nested prompt file")
+	time.Sleep(100 * time.Millisecond)
+
+	listResult, err := mcpClient.ListPrompts(ctx, mcp.ListPromptsRequest{})
+	require.NoError(s.T(), err, "ListPrompts failed after adding nested prompt")
+	var promptNames []string
+	for _, prompt := range listResult.Prompts {
+		promptNames = append(promptNames, prompt.Name)
+	}
+	assert.ElementsMatch(s.T(), []string{"initial_prompt", "team/standup"}, promptNames, "Unexpected prompts after adding nested prompt")
+}
+
+// TestReloadPromptsOverlayDirs tests that prompts from later directories override earlier ones
+// and that changes in any of the directories are picked up
+func (s *PromptsServerTestSuite) TestReloadPromptsOverlayDirs() {
+	ctx := context.Background()
+
+	baseDir := filepath.Join(s.tempDir, "base")
+	overlayDir := filepath.Join(s.tempDir, "overlay")
+	require.NoError(s.T(), os.Mkdir(baseDir, 0755), "Failed to create base directory")
+	require.NoError(s.T(), os.Mkdir(overlayDir, 0755), "Failed to create overlay directory")
+	err := os.WriteFile(filepath.Join(baseDir, "greeting.tmpl"), []byte("Hello {{.name}}!"), 0644)
+	require.NoError(s.T(), err, "Failed to write base prompt file")
+	err = os.WriteFile(filepath.Join(baseDir, "farewell.tmpl"), []byte("Bye {{.name}}!"), 0644)
+	require.NoError(s.T(), err, "Failed to write base prompt file")
+	err = os.WriteFile(filepath.Join(overlayDir, "greeting.tmpl"), []byte("Hi {{.name}} from {{.team}}!"), 0644)
+	require.NoError(s.T(), err, "Failed to write overlay prompt file")
+
+	_, mcpClient, promptsClose := s.makeOverlayPromptsServerAndClient(ctx, []string{baseDir, overlayDir}, true)
+	defer promptsClose()
+
+	getPromptText := func(name string, args map[string]string) string {
+		var getReq mcp.GetPromptRequest
+		getReq.Params.Name = name
+		getReq.Params.Arguments = args
+		getResult, err := mcpClient.GetPrompt(ctx, getReq)
+		require.NoError(s.T(), err, "GetPrompt failed for %q", name)
+		require.Len(s.T(), getResult.Messages, 1, "Expected exactly 1 message")
+		content, ok := getResult.Messages[0].Content.(mcp.TextContent)
+		require.True(s.T(), ok, "Expected TextContent")
+		return content.Text
+	}
+
+	assert.Equal(s.T(), "Hi Alice from QA!", getPromptText("greeting", map[string]string{"name": "Alice", "team": "QA"}),
+		"Overlay prompt should override base prompt")
+	assert.Equal(s.T(), "Bye Alice!", getPromptText("farewell", map[string]string{"name": "Alice"}),
+		"Base prompt should be served when not overridden")
+
+	// Removing the overriding template exposes the base one again
+	require.NoError(s.T(), os.Remove(filepath.Join(overlayDir, "greeting.tmpl")), "Failed to remove overlay prompt file")
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(s.T(), "Hello Alice!", getPromptText("greeting", map[string]string{"name": "Alice"}),
+		"Base prompt should be served after overlay prompt is removed")
+
+	// Changes in the base directory are picked up as well
+	err = os.WriteFile(filepath.Join(baseDir, "farewell.tmpl"), []byte("Goodbye {{.name}}!"), 0644)
+	require.NoError(s.T(), err, "Failed to update base prompt file")
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(s.T(), "Goodbye Alice!", getPromptText("farewell", map[string]string{"name": "Alice"}),
+		"Updated base prompt should be served")
+}
+
+// TestReloadPromptsBrokenTemplate tests that broken templates are skipped and reported while other prompts keep working
+func (s *PromptsServerTestSuite) TestReloadPromptsBrokenTemplate() {
+	ctx := context.Background()
+
+	brokenFile := filepath.Join(s.tempDir, "broken.tmpl")
+	err := os.WriteFile(filepath.Join(s.tempDir, "greeting.tmpl"), []byte("Hello {{.name}}!"), 0644)
+	require.NoError(s.T(), err, "Failed to write prompt file")
+	require.NoError(s.T(), os.WriteFile(brokenFile, []byte("Broken {{.name"), 0644), "Failed to write broken prompt file")
+
+	promptsServer, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, s.tempDir, true)
+	defer promptsClose()
+
+	listPromptNames := func() []string {
+		listResult, err := mcpClient.ListPrompts(ctx, mcp.ListPromptsRequest{})
+		require.NoError(s.T(), err, "ListPrompts failed")
+		var promptNames []string
+		for _, prompt := range listResult.Prompts {
+			promptNames = append(promptNames, prompt.Name)
+		}
+		return promptNames
+	}
+	readLoadErrors := func() []loadErrorEntry {
+		var readReq mcp.ReadResourceRequest
+		readReq.Params.URI = loadErrorsResourceURI
+		readResult, err := mcpClient.ReadResource(ctx, readReq)
+		require.NoError(s.T(), err, "ReadResource failed")
+		require.Len(s.T(), readResult.Contents, 1, "Expected exactly 1 resource content")
+		content, ok := readResult.Contents[0].(mcp.TextResourceContents)
+		require.True(s.T(), ok, "Expected TextResourceContents")
+		assert.Equal(s.T(), "application/json", content.MIMEType, "Unexpected MIME type")
+		var entries []loadErrorEntry
+		require.NoError(s.T(), json.Unmarshal([]byte(content.Text), &entries), "Failed to unmarshal load errors")
+		return entries
+	}
+
+	assert.Equal(s.T(), []string{"greeting"}, listPromptNames(), "Only valid prompt should be registered")
+	require.Len(s.T(), promptsServer.LoadErrors(), 1, "Expected exactly 1 load error")
+	loadErrs := readLoadErrors()
+	require.Len(s.T(), loadErrs, 1, "Expected exactly 1 load error")
+	assert.Equal(s.T(), brokenFile, loadErrs[0].Path, "Unexpected path of broken template")
+	assert.Contains(s.T(), loadErrs[0].Error, "parse template", "Unexpected load error")
+
+	// Fixing the broken template registers it and clears the load errors
+	require.NoError(s.T(), os.WriteFile(brokenFile, []byte("Fixed {{.name}}"), 0644), "Failed to fix broken prompt file")
+	time.Sleep(100 * time.Millisecond)
+
+	assert.ElementsMatch(s.T(), []string{"greeting", "broken"}, listPromptNames(), "Fixed prompt should be registered")
+	assert.Empty(s.T(), readLoadErrors(), "Load errors should be cleared")
+}
+
+// TestReloadPromptsListChangedNotification tests that clients are notified only when the prompts catalog changes
+func (s *PromptsServerTestSuite) TestReloadPromptsListChangedNotification() {
+	ctx := context.Background()
+
+	promptFile := filepath.Join(s.tempDir, "greeting.tmpl")
+	// Write prompts atomically, so the watcher never sees a partially written file
+	writePrompt := func(content string) {
+		tmpFile := promptFile + ".tmp"
+		require.NoError(s.T(), os.WriteFile(tmpFile, []byte(content), 0644), "Failed to write prompt file")
+		require.NoError(s.T(), os.Rename(tmpFile, promptFile), "Failed to rename prompt file")
+		time.Sleep(100 * time.Millisecond)
+	}
+	writePrompt("{{/* Greeting */}}\nHello {{.name}}!")
+
+	_, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, s.tempDir, true)
+	defer promptsClose()
+
+	var notificationsCount atomic.Int32
+	mcpClient.OnNotification(func(notification mcp.JSONRPCNotification) {
+		if notification.Method == mcp.MethodNotificationPromptsListChanged {
+			notificationsCount.Add(1)
+		}
+	})
+
+	// Changing only the template body keeps the catalog identical
+	writePrompt("{{/* Greeting */}}\nHi {{.name}}!")
+	assert.Equal(s.T(), int32(0), notificationsCount.Load(), "Clients should not be notified about identical catalog")
+
+	var getReq mcp.GetPromptRequest
+	getReq.Params.Name = "greeting"
+	getReq.Params.Arguments = map[string]string{"name": "Alice"}
+	getResult, err := mcpClient.GetPrompt(ctx, getReq)
+	require.NoError(s.T(), err, "GetPrompt failed")
+	require.Len(s.T(), getResult.Messages, 1, "Expected exactly 1 message")
+	content, ok := getResult.Messages[0].Content.(mcp.TextContent)
+	require.True(s.T(), ok, "Expected TextContent")
+	assert.Equal(s.T(), "Hi Alice!", strings.TrimSpace(content.Text), "Updated template should be served")
+
+	// Changing the description changes the catalog
+	writePrompt("{{/* Friendly greeting */}}\nHi {{.name}}!")
+	assert.Equal(s.T(), int32(1), notificationsCount.Load(), "Clients should be notified about changed description")
+
+	// Adding an argument changes the catalog
+	writePrompt("{{/* Friendly greeting */}}\nHi {{.name}} from {{.team}}!")
+	assert.Equal(s.T(), int32(2), notificationsCount.Load(), "Clients should be notified about added argument")
+}
+
+// TestReloadPromptsUnchangedArguments tests that reloading a prompt with several arguments does not notify clients
+func (s *PromptsServerTestSuite) TestReloadPromptsUnchangedArguments() {
+	ctx := context.Background()
+
+	require.NoError(s.T(), os.WriteFile(filepath.Join(s.tempDir, "letters.tmpl"),
+		[]byte("{{/* Letters */}}\n{{.a}} {{.b}} {{.c}} {{.d}} {{.e}}"), 0644), "Failed to write prompt file")
+	promptsServer, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, s.tempDir, true)
+	defer promptsClose()
+
+	var notificationsCount atomic.Int32
+	mcpClient.OnNotification(func(notification mcp.JSONRPCNotification) {
+		if notification.Method == mcp.MethodNotificationPromptsListChanged {
+			notificationsCount.Add(1)
+		}
+	})
+
+	for i := 0; i < 20; i++ {
+		require.NoError(s.T(), promptsServer.reloadPrompts(), "Failed to reload prompts")
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(s.T(), int32(0), notificationsCount.Load(), "Clients should not be notified about unchanged prompts")
+
+	listResult, err := mcpClient.ListPrompts(ctx, mcp.ListPromptsRequest{})
+	require.NoError(s.T(), err, "ListPrompts failed")
+	require.Len(s.T(), listResult.Prompts, 1, "Expected exactly 1 prompt")
+	var argNames []string
+	for _, arg := range listResult.Prompts[0].Arguments {
+		argNames = append(argNames, arg.Name)
+	}
+	assert.Equal(s.T(), []string{"a", "b", "c", "d", "e"}, argNames, "Arguments should be sorted by name")
+}
+
+// TestReloadPromptsCoalescesChanges tests that a burst of file changes results in a single reload
+func (s *PromptsServerTestSuite) TestReloadPromptsCoalescesChanges() {
+	ctx := context.Background()
+
+	err := os.WriteFile(filepath.Join(s.tempDir, "initial.tmpl"), []byte("Hello {{.name}}!"), 0644)
+	require.NoError(s.T(), err, "Failed to write initial prompt file")
+
+	_, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, s.tempDir, true,
+		WithReloadDebounce(200*time.Millisecond))
+	defer promptsClose()
+
+	var notificationsCount atomic.Int32
+	mcpClient.OnNotification(func(notification mcp.JSONRPCNotification) {
+		if notification.Method == mcp.MethodNotificationPromptsListChanged {
+			notificationsCount.Add(1)
+		}
+	})
+
+	for i := 0; i < 5; i++ {
+		err = os.WriteFile(filepath.Join(s.tempDir, fmt.Sprintf("prompt_%d.tmpl", i)), []byte("Prompt {{.topic}}"), 0644)
+		require.NoError(s.T(), err, "Failed to write prompt file")
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// Nothing is reloaded until the burst settles
+	listResult, err := mcpClient.ListPrompts(ctx, mcp.ListPromptsRequest{})
+	require.NoError(s.T(), err, "ListPrompts failed")
+	assert.Len(s.T(), listResult.Prompts, 1, "Prompts should not be reloaded during the burst")
+
+	time.Sleep(400 * time.Millisecond)
+	listResult, err = mcpClient.ListPrompts(ctx, mcp.ListPromptsRequest{})
+	require.NoError(s.T(), err, "ListPrompts failed")
+	assert.Len(s.T(), listResult.Prompts, 6, "All new prompts should be loaded after the burst")
+	assert.Equal(s.T(), int32(1), notificationsCount.Load(), "Burst of changes should result in a single reload")
+}
+
+// TestTemplateResources tests that template files are exposed as MCP resources and kept in sync with the files
+func (s *PromptsServerTestSuite) TestTemplateResources() {
+	ctx := context.Background()
+
+	files := map[string]string{
+		"greeting.tmpl":       "{{/* Greeting */}}\n{{template \"_header\" .}}Hello {{.name}}!",
+		"_header.tmpl":        "{{define \"_header\"}}Header{{end}}",
+		"review/code.tmpl":    "---\ndescription: Review code\n---\nReview {{.code}}",
+		"review/_common.tmpl": "Common",
+	}
+	for relPath, content := range files {
+		filePath := filepath.Join(s.tempDir, filepath.FromSlash(relPath))
+		require.NoError(s.T(), os.MkdirAll(filepath.Dir(filePath), 0755), "Failed to create directory")
+		require.NoError(s.T(), os.WriteFile(filePath, []byte(content), 0644), "Failed to write test file")
+	}
+
+	_, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, s.tempDir, true)
+	defer promptsClose()
+
+	var notificationsCount atomic.Int32
+	mcpClient.OnNotification(func(notification mcp.JSONRPCNotification) {
+		if notification.Method == mcp.MethodNotificationResourcesListChanged {
+			notificationsCount.Add(1)
+		}
+	})
+
+	listTemplateResources := func() map[string]mcp.Resource {
+		listResult, err := mcpClient.ListResources(ctx, mcp.ListResourcesRequest{})
+		require.NoError(s.T(), err, "ListResources failed")
+		resources := make(map[string]mcp.Resource)
+		for _, resource := range listResult.Resources {
+			if strings.HasPrefix(resource.URI, templateResourceScheme) {
+				resources[resource.URI] = resource
+			}
+		}
+		return resources
+	}
+	readResource := func(uri string) string {
+		var readReq mcp.ReadResourceRequest
+		readReq.Params.URI = uri
+		readResult, err := mcpClient.ReadResource(ctx, readReq)
+		require.NoError(s.T(), err, "ReadResource failed for %q", uri)
+		require.Len(s.T(), readResult.Contents, 1, "Expected exactly 1 resource content")
+		content, ok := readResult.Contents[0].(mcp.TextResourceContents)
+		require.True(s.T(), ok, "Expected TextResourceContents")
+		assert.Equal(s.T(), templateResourceMIMEType, content.MIMEType, "Unexpected MIME type")
+		return content.Text
+	}
+
+	resources := listTemplateResources()
+	assert.Equal(s.T(), map[string]mcp.Resource{
+		"prompt://_header.tmpl": mcp.NewResource("prompt://_header.tmpl", "_header.tmpl",
+			mcp.WithResourceDescription("Partial template"), mcp.WithMIMEType(templateResourceMIMEType)),
+		"prompt://greeting.tmpl": mcp.NewResource("prompt://greeting.tmpl", "greeting.tmpl",
+			mcp.WithResourceDescription(`Template of the "greeting" prompt: Greeting`), mcp.WithMIMEType(templateResourceMIMEType)),
+		"prompt://review/_common.tmpl": mcp.NewResource("prompt://review/_common.tmpl", "review/_common.tmpl",
+			mcp.WithResourceDescription("Partial template"), mcp.WithMIMEType(templateResourceMIMEType)),
+		"prompt://review/code.tmpl": mcp.NewResource("prompt://review/code.tmpl", "review/code.tmpl",
+			mcp.WithResourceDescription(`Template of the "review/code" prompt: Review code`), mcp.WithMIMEType(templateResourceMIMEType)),
+	}, resources, "Unexpected template resources")
+	assert.Equal(s.T(), files["review/code.tmpl"], readResource("prompt://review/code.tmpl"),
+		"Resource should contain the raw template source")
+
+	// Changing the template body updates the resource content without notifying clients
+	err := os.WriteFile(filepath.Join(s.tempDir, "review", "_common.tmpl"), []byte("Updated common"), 0644)
+	require.NoError(s.T(), err, "Failed to update partial file")
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(s.T(), "Updated common", readResource("prompt://review/_common.tmpl"), "Resource should contain updated source")
+	assert.Equal(s.T(), int32(0), notificationsCount.Load(), "Clients should not be notified about unchanged resources list")
+
+	// Adding and removing templates changes the resources list
+	err = os.WriteFile(filepath.Join(s.tempDir, "_footer.tmpl"), []byte("{{define \"_footer\"}}Footer{{end}}"), 0644)
+	require.NoError(s.T(), err, "Failed to write partial file")
+	require.NoError(s.T(), os.Remove(filepath.Join(s.tempDir, "review", "_common.tmpl")), "Failed to remove partial file")
+	time.Sleep(100 * time.Millisecond)
+
+	resources = listTemplateResources()
+	assert.Contains(s.T(), resources, "prompt://_footer.tmpl", "Added template should be exposed")
+	assert.NotContains(s.T(), resources, "prompt://review/_common.tmpl", "Removed template should not be exposed")
+	assert.Positive(s.T(), notificationsCount.Load(), "Clients should be notified about changed resources list")
+}
+
 // TestServeStdioWithJSONArgumentParsing tests JSON argument parsing with ServeStdio integration
 func (s *PromptsServerTestSuite) TestServeStdioWithJSONArgumentParsing() {
 	ctx := context.Background()
@@ -242,6 +664,103 @@ func (s *PromptsServerTestSuite) TestServeStdioWithDisabledJSONArgumentParsing()
 	assert.Equal(s.T(), expectedContent, actualContent, "Unexpected content with disabled JSON parsing")
 }
 
+// TestServeStdioWithInferredArgumentKinds tests parsing and descriptions of arguments based on their usage
+func (s *PromptsServerTestSuite) TestServeStdioWithInferredArgumentKinds() {
+	ctx := context.Background()
+
+	_, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, "./testdata", true)
+	defer promptsClose()
+
+	listResult, err := mcpClient.ListPrompts(ctx, mcp.ListPromptsRequest{})
+	require.NoError(s.T(), err, "ListPrompts failed")
+	gotDescriptions := make(map[string]string)
+	for _, prompt := range listResult.Prompts {
+		if prompt.Name != "range_structs" && prompt.Name != "with_object" && prompt.Name != "conditional_greeting" {
+			continue
+		}
+		for _, arg := range prompt.Arguments {
+			gotDescriptions[prompt.Name+"."+arg.Name] = arg.Description
+		}
+	}
+	assert.Equal(s.T(), map[string]string{
+		"range_structs.users":                     "JSON array or object",
+		"range_structs.total":                     "",
+		"with_object.config":                      "JSON object with fields: debug, name, version",
+		"with_object.environment":                 "",
+		"conditional_greeting.name":               "",
+		"conditional_greeting.show_extra_message": "Flag: true or false",
+	}, gotDescriptions, "Unexpected argument descriptions")
+
+	var getReq mcp.GetPromptRequest
+	getReq.Params.Name = "range_structs"
+	getReq.Params.Arguments = map[string]string{
+		"users": `[{"name": "Alice", "age": 30, "role": "admin"}]`,
+		"total": "1", // Scalar arguments are kept as strings
+	}
+	getResult, err := mcpClient.GetPrompt(ctx, getReq)
+	require.NoError(s.T(), err, "GetPrompt failed")
+	require.Len(s.T(), getResult.Messages, 1, "Expected exactly 1 message")
+	content, ok := getResult.Messages[0].Content.(mcp.TextContent)
+	require.True(s.T(), ok, "Expected TextContent")
+	assert.Equal(s.T(), "Users:\n  - Alice (30) - admin\nTotal: 1 users", normalizeNewlines(content.Text),
+		"Unexpected content with array argument")
+
+	getReq.Params.Arguments = map[string]string{"users": "Alice", "total": "1"}
+	_, err = mcpClient.GetPrompt(ctx, getReq)
+	require.Error(s.T(), err, "Expected error for iterated argument that is not JSON")
+	assert.Contains(s.T(), err.Error(), "expected JSON array or object", "Unexpected error")
+
+	getReq.Params.Name = "with_object"
+	getReq.Params.Arguments = map[string]string{"config": `["not", "object"]`, "environment": "prod"}
+	_, err = mcpClient.GetPrompt(ctx, getReq)
+	require.Error(s.T(), err, "Expected error for object argument of another JSON type")
+	assert.Contains(s.T(), err.Error(), "expected JSON object, got array", "Unexpected error")
+}
+
+// TestServeStdioWithUnknownArgumentKinds tests that arguments whose type the usage does not tell are parsed as JSON
+func (s *PromptsServerTestSuite) TestServeStdioWithUnknownArgumentKinds() {
+	ctx := context.Background()
+
+	for name, content := range map[string]string{
+		"length":   "{{len .items}}",
+		"index":    "{{index .items 0}}",
+		"variable": "{{$c := .config}}{{$c.timeout}}",
+		"to_json":  "{{toJson .config}}",
+		"labels":   "{{range $k, $v := .labels}}{{$k}}={{$v}};{{end}}",
+	} {
+		err := os.WriteFile(filepath.Join(s.tempDir, name+".tmpl"), []byte(content), 0644)
+		require.NoError(s.T(), err, "Failed to write prompt file")
+	}
+
+	_, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, s.tempDir, true)
+	defer promptsClose()
+
+	tests := []struct {
+		prompt   string
+		args     map[string]string
+		expected string
+	}{
+		{prompt: "length", args: map[string]string{"items": "[10,20,30]"}, expected: "3"},
+		{prompt: "index", args: map[string]string{"items": "[10,20,30]"}, expected: "10"},
+		{prompt: "variable", args: map[string]string{"config": `{"timeout": 5}`}, expected: "5"},
+		{prompt: "to_json", args: map[string]string{"config": `{"timeout":5}`}, expected: `{"timeout":5}`},
+		{prompt: "labels", args: map[string]string{"labels": `{"a": 1, "b": 2}`}, expected: "a=1;b=2;"},
+	}
+	for _, tt := range tests {
+		s.Run(tt.prompt, func() {
+			var getReq mcp.GetPromptRequest
+			getReq.Params.Name = tt.prompt
+			getReq.Params.Arguments = tt.args
+			getResult, err := mcpClient.GetPrompt(ctx, getReq)
+			require.NoError(s.T(), err, "GetPrompt failed")
+			require.Len(s.T(), getResult.Messages, 1, "Expected exactly 1 message")
+			content, ok := getResult.Messages[0].Content.(mcp.TextContent)
+			require.True(s.T(), ok, "Expected TextContent")
+			assert.Equal(s.T(), tt.expected, normalizeNewlines(content.Text), "Unexpected content")
+		})
+	}
+}
+
 // TestReloadPromptsNewPromptAdded tests reloadPrompts method with new prompts via ServeStdio
 func (s *PromptsServerTestSuite) TestReloadPromptsNewPromptAdded() {
 	ctx := context.Background()
@@ -520,13 +1039,20 @@ Hello {{.name}}!`
 }
 
 func (s *PromptsServerTestSuite) makePromptsServerAndClient(
-	ctx context.Context, promptsDir string, enableJSONArgs bool,
+	ctx context.Context, promptsDir string, enableJSONArgs bool, opts ...PromptsServerOption,
+) (*PromptsServer, *client.Client, func()) {
+	return s.makeOverlayPromptsServerAndClient(ctx, []string{promptsDir}, enableJSONArgs, opts...)
+}
+
+func (s *PromptsServerTestSuite) makeOverlayPromptsServerAndClient(
+	ctx context.Context, promptsDirs []string, enableJSONArgs bool, opts ...PromptsServerOption,
 ) (*PromptsServer, *client.Client, func()) {
 	var ctxCancel context.CancelFunc
 	ctx, ctxCancel = context.WithCancel(ctx)
 
-	// Create prompts server that will watch the temp directory
-	promptsServer, err := NewPromptsServer(promptsDir, enableJSONArgs, s.logger)
+	// Create prompts server that will watch the prompts directories
+	opts = append([]PromptsServerOption{WithReloadDebounce(testReloadDebounce)}, opts...)
+	promptsServer, err := NewPromptsServer(promptsDirs, enableJSONArgs, s.logger, opts...)
 	require.NoError(s.T(), err, "Failed to create prompts server")
 
 	// Set up pipes for client-server communication
@@ -542,10 +1068,9 @@ func (s *PromptsServerTestSuite) makePromptsServerAndClient(
 	// Create transport and client
 	var logBuffer bytes.Buffer
 	transp := transport.NewIO(clientReader, clientWriter, io.NopCloser(&logBuffer))
-	err = transp.Start(ctx)
-	require.NoError(s.T(), err, "Failed to start transport")
-
 	mcpClient := client.NewClient(transp)
+	err = mcpClient.Start(ctx)
+	require.NoError(s.T(), err, "Failed to start client")
 
 	// Initialize the client
 	var initReq mcp.InitializeRequest
@@ -560,3 +1085,46 @@ func (s *PromptsServerTestSuite) makePromptsServerAndClient(
 		s.Require().NoError(promptsServer.Close())
 	}
 }
+
+func (s *PromptsServerTestSuite) makePromptsServerAndHTTPClient(
+	ctx context.Context, promptsDir string, transport string,
+) (*PromptsServer, *client.Client, func()) {
+	var ctxCancel context.CancelFunc
+	ctx, ctxCancel = context.WithCancel(ctx)
+
+	promptsServer, err := NewPromptsServer([]string{promptsDir}, true, s.logger, WithReloadDebounce(testReloadDebounce))
+	require.NoError(s.T(), err, "Failed to create prompts server")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(s.T(), err, "Failed to listen")
+	baseURL := "http://" + ln.Addr().String()
+
+	errChan := make(chan error, 1)
+	var mcpClient *client.Client
+	switch transport {
+	case transportSSE:
+		go func() {
+			errChan <- promptsServer.ServeSSE(ctx, ln)
+		}()
+		mcpClient, err = client.NewSSEMCPClient(baseURL + "/sse")
+	default:
+		go func() {
+			errChan <- promptsServer.ServeStreamableHTTP(ctx, ln)
+		}()
+		mcpClient, err = client.NewStreamableHttpClient(baseURL + streamableHTTPEndpoint)
+	}
+	require.NoError(s.T(), err, "Failed to create client")
+	require.NoError(s.T(), mcpClient.Start(ctx), "Failed to start client")
+
+	var initReq mcp.InitializeRequest
+	initReq.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	_, err = mcpClient.Initialize(ctx, initReq)
+	require.NoError(s.T(), err, "Failed to initialize client")
+
+	return promptsServer, mcpClient, func() {
+		ctxCancel()
+		s.Require().NoError(<-errChan)
+		_ = mcpClient.Close()
+		s.Require().NoError(promptsServer.Close())
+	}
+}
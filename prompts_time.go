@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// dateLayout is the layout of the date built-in data.
+const dateLayout = "2006-01-02 15:04:05"
+
+// timeLayouts are the named layouts accepted by formatTime in addition to Go layouts like "Jan 2, 2006".
+var timeLayouts = map[string]string{
+	"date":     "2006-01-02",
+	"datetime": dateLayout,
+	"time":     "15:04",
+	"kitchen":  time.Kitchen,
+	"RFC3339":  time.RFC3339,
+	"RFC1123":  time.RFC1123,
+}
+
+// systemClock provides the time functions of templateFuncs: the system time in the local timezone.
+var systemClock = newTemplateClock(nil, nil)
+
+// templateClock implements the date built-in data and the time functions of templates. The current time is taken
+// from an injectable clock, so tests and golden files can render with a fixed time, and is in the configured timezone.
+type templateClock struct {
+	now      func() time.Time
+	location *time.Location
+}
+
+// WithClock sets the clock the current time of templates is taken from, e.g. a fixed time for deterministic rendering.
+func WithClock(now func() time.Time) PromptsServerOption {
+	return func(ps *PromptsServer) {
+		ps.now = now
+	}
+}
+
+// WithTimezone sets the timezone of the current time of templates.
+func WithTimezone(location *time.Location) PromptsServerOption {
+	return func(ps *PromptsServer) {
+		ps.timezone = location
+	}
+}
+
+// newTemplateClock returns a templateClock with the clock and timezone, or the system clock and local timezone if nil.
+func newTemplateClock(now func() time.Time, location *time.Location) *templateClock {
+	if now == nil {
+		now = time.Now
+	}
+	if location == nil {
+		location = time.Local
+	}
+	return &templateClock{now: now, location: location}
+}
+
+// fixedClock returns a clock that always returns the time.
+func fixedClock(t time.Time) func() time.Time {
+	return func() time.Time { return t }
+}
+
+// date returns the date built-in data: the current time in the "2006-01-02 15:04:05" layout.
+func (c *templateClock) date() string {
+	return c.currentTime().Format(dateLayout)
+}
+
+// funcs returns the time functions bound to the clock, overriding the ones of templateFuncs.
+func (c *templateClock) funcs() template.FuncMap {
+	return template.FuncMap{
+		"now":         c.currentTime,
+		"formatTime":  c.formatTime,
+		"addDuration": c.addDuration,
+		"weekday":     c.weekday,
+	}
+}
+
+// currentTime returns the current time in the timezone of the clock.
+func (c *templateClock) currentTime() time.Time {
+	return c.now().In(c.location)
+}
+
+// toTime converts a template value to a time. Texts in the RFC 3339, "2006-01-02 15:04:05" and "2006-01-02" layouts
+// are parsed in the timezone of the clock, so the date built-in data can be passed to the time functions.
+func (c *templateClock) toTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, dateLayout, timeLayouts["date"]} {
+			if t, err := time.ParseInLocation(layout, v, c.location); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("expected a time, got %v (%T)", value, value)
+}
+
+// formatTime formats the time with the named or Go layout.
+func (c *templateClock) formatTime(layout string, value interface{}) (string, error) {
+	t, err := c.toTime(value)
+	if err != nil {
+		return "", err
+	}
+	if named, ok := timeLayouts[layout]; ok {
+		layout = named
+	}
+	return t.Format(layout), nil
+}
+
+// addDuration adds the duration to the time. Durations are in the Go format, like "1h30m" or "-15m",
+// or in whole days, like "7d" or "-1d".
+func (c *templateClock) addDuration(duration string, value interface{}) (time.Time, error) {
+	t, err := c.toTime(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if days, ok := strings.CutSuffix(duration, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("parse duration %q: %w", duration, err)
+		}
+		return t.AddDate(0, 0, n), nil
+	}
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse duration: %w", err)
+	}
+	return t.Add(d), nil
+}
+
+// weekday returns the English name of the day of the week of the time, like "Monday".
+func (c *templateClock) weekday(value interface{}) (string, error) {
+	t, err := c.toTime(value)
+	if err != nil {
+		return "", err
+	}
+	return t.Weekday().String(), nil
+}
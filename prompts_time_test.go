@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTemplateClock tests the date built-in data and the time functions of templates
+func (s *PromptsParserTestSuite) TestTemplateClock() {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(s.T(), err, "Failed to load timezone")
+	clock := newTemplateClock(fixedClock(time.Date(2024, time.March, 30, 23, 30, 0, 0, time.UTC)), berlin)
+	assert.Equal(s.T(), "2024-03-31 00:30:00", clock.date(), "Date should be in the timezone of the clock")
+
+	data := map[string]interface{}{"date": clock.date(), "deadline": "2024-04-02", "count": 3}
+	tests := []struct {
+		name        string
+		template    string
+		expected    string
+		expectedErr string
+	}{
+		{name: "now", template: `{{now}}`, expected: "2024-03-31 00:30:00 +0100 CET"},
+		{name: "formatTime with named layout", template: `{{now | formatTime "RFC3339"}}`, expected: "2024-03-31T00:30:00+01:00"},
+		{name: "formatTime with Go layout", template: `{{formatTime "Jan 2, 2006 at 15:04" now}}`, expected: "Mar 31, 2024 at 00:30"},
+		{name: "formatTime of date text", template: `{{formatTime "kitchen" .date}}`, expected: "12:30AM"},
+		{name: "addDuration", template: `{{now | addDuration "-1h15m" | formatTime "datetime"}}`, expected: "2024-03-30 23:15:00"},
+		{name: "addDuration across DST change", template: `{{now | addDuration "3h" | formatTime "time"}}`, expected: "04:30"},
+		{name: "addDuration in days", template: `{{addDuration "-7d" .deadline | formatTime "date"}}`, expected: "2024-03-26"},
+		{name: "weekday", template: `{{weekday now}} {{weekday .deadline}}`, expected: "Sunday Tuesday"},
+
+		{name: "invalid duration", template: `{{addDuration "soon" now}}`, expectedErr: `parse duration: time: invalid duration "soon"`},
+		{name: "invalid days", template: `{{addDuration "xd" now}}`, expectedErr: `parse duration "xd"`},
+		{name: "invalid time", template: `{{weekday .count}}`, expectedErr: "expected a time, got 3 (int)"},
+		{name: "invalid time text", template: `{{formatTime "date" "tomorrow"}}`, expectedErr: "expected a time, got tomorrow (string)"},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			tmpl, err := template.New("test").Funcs(mergeFuncs(templateFuncs(), clock.funcs())).Parse(tt.template)
+			require.NoError(s.T(), err, "Failed to parse template")
+			var buf bytes.Buffer
+			err = tmpl.Execute(&buf, data)
+			if tt.expectedErr != "" {
+				require.Error(s.T(), err, "Expected execution error")
+				assert.Contains(s.T(), err.Error(), tt.expectedErr)
+				return
+			}
+			require.NoError(s.T(), err, "Failed to execute template")
+			assert.Equal(s.T(), tt.expected, buf.String())
+		})
+	}
+
+	// Without a configured clock, the system time in the local timezone is used
+	before := time.Now()
+	systemNow := systemClock.currentTime()
+	assert.False(s.T(), systemNow.Before(before.Truncate(time.Second)), "System clock should return the current time")
+	assert.Equal(s.T(), time.Local, systemNow.Location(), "System clock should use the local timezone")
+}
+
+// TestServeStdioWithClock tests rendering prompts with an injected clock and timezone
+func (s *PromptsServerTestSuite) TestServeStdioWithClock() {
+	ctx := context.Background()
+
+	require.NoError(s.T(), os.WriteFile(filepath.Join(s.tempDir, "standup.tmpl"),
+		[]byte(`{{.date}}: standup for {{now | formatTime "Monday, Jan 2"}}`), 0644), "Failed to write prompt file")
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(s.T(), err, "Failed to load timezone")
+
+	_, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, s.tempDir, true,
+		WithClock(fixedClock(time.Date(2024, time.January, 5, 20, 0, 0, 0, time.UTC))), WithTimezone(tokyo))
+	defer promptsClose()
+
+	var getReq mcp.GetPromptRequest
+	getReq.Params.Name = "standup"
+	getResult, err := mcpClient.GetPrompt(ctx, getReq)
+	require.NoError(s.T(), err, "GetPrompt failed")
+	require.Len(s.T(), getResult.Messages, 1, "Expected exactly 1 message")
+	content, ok := getResult.Messages[0].Content.(mcp.TextContent)
+	require.True(s.T(), ok, "Expected TextContent")
+	assert.Equal(s.T(), "2024-01-06 05:00:00: standup for Saturday, Jan 6", content.Text, "Unexpected message content")
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Names of the tools that expose prompts to clients without prompt support.
+const (
+	toolListPrompts     = "list_prompts"
+	toolGetPromptSchema = "get_prompt_schema"
+	toolRenderPrompt    = "render_prompt"
+)
+
+// WithPromptTools registers the list_prompts, get_prompt_schema and render_prompt tools,
+// so clients that support only MCP tools can use the prompts.
+func WithPromptTools() PromptsServerOption {
+	return func(ps *PromptsServer) {
+		ps.enablePromptTools = true
+	}
+}
+
+// promptSchema is the result of the get_prompt_schema tool.
+type promptSchema struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+// toolError is the structured error returned by the prompt tools.
+type toolError struct {
+	Error     string          `json:"error"`
+	Arguments []ArgumentError `json:"arguments,omitempty"`
+}
+
+func (ps *PromptsServer) addPromptTools() {
+	ps.mcpServer.AddTools(
+		server.ServerTool{
+			Tool: mcp.NewTool(toolListPrompts,
+				mcp.WithDescription("List available prompts with their descriptions and arguments"),
+			),
+			Handler: ps.handleListPromptsTool,
+		},
+		server.ServerTool{
+			Tool: mcp.NewTool(toolGetPromptSchema,
+				mcp.WithDescription("Get the JSON Schema of the prompt arguments"),
+				mcp.WithString("name", mcp.Required(), mcp.Description("Name of the prompt")),
+			),
+			Handler: ps.handleGetPromptSchemaTool,
+		},
+		server.ServerTool{
+			Tool: mcp.NewTool(toolRenderPrompt,
+				mcp.WithDescription("Render the prompt with the given arguments and return the resulting text"),
+				mcp.WithString("name", mcp.Required(), mcp.Description("Name of the prompt")),
+				mcp.WithObject("arguments", mcp.Description("Prompt arguments keyed by argument name")),
+			),
+			Handler: ps.handleRenderPromptTool,
+		},
+	)
+}
+
+func (ps *PromptsServer) handleListPromptsTool(
+	ctx context.Context, request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	ps.mu.RLock()
+	prompts := make([]mcp.Prompt, 0, len(ps.prompts))
+	for _, prompt := range ps.prompts {
+		prompts = append(prompts, prompt.Prompt)
+	}
+	ps.mu.RUnlock()
+	sort.Slice(prompts, func(i, j int) bool { return prompts[i].Name < prompts[j].Name })
+	return newToolResultJSON(prompts)
+}
+
+func (ps *PromptsServer) handleGetPromptSchemaTool(
+	ctx context.Context, request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	prompt, toolErrResult, err := ps.lookupToolPrompt(request)
+	if toolErrResult != nil || err != nil {
+		return toolErrResult, err
+	}
+
+	properties := make(map[string]interface{}, len(prompt.args))
+	required := make([]string, 0, len(prompt.args))
+	for _, promptArg := range prompt.args {
+		property := promptArg.schema.JSONSchema()
+		// Kinds other than scalar and iterable inferred from the template are JSON Schema types as well
+		if !promptArg.schema.IsTyped() && ps.enableJSONArgs && promptArg.kind != "" &&
+			promptArg.kind != argKindScalar && promptArg.kind != argKindIterable {
+			property["type"] = promptArg.kind
+		}
+		if promptArg.description != "" {
+			property["description"] = promptArg.description
+		}
+		if promptArg.defaultValue != nil {
+			property["default"] = promptArg.defaultValue
+		}
+		properties[promptArg.name] = property
+		if promptArg.required {
+			required = append(required, promptArg.name)
+		}
+	}
+	return newToolResultJSON(promptSchema{
+		Name:        prompt.Prompt.Name,
+		Description: prompt.Prompt.Description,
+		InputSchema: map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+			"required":   required,
+		},
+	})
+}
+
+func (ps *PromptsServer) handleRenderPromptTool(
+	ctx context.Context, request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	prompt, toolErrResult, err := ps.lookupToolPrompt(request)
+	if toolErrResult != nil || err != nil {
+		return toolErrResult, err
+	}
+
+	// Tool arguments are JSON values, while prompt arguments are strings parsed by the prompt handler
+	rawArgs, _ := request.GetArguments()["arguments"].(map[string]interface{})
+	args, err := stringifyArgs(rawArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := prompt.render(ctx, args)
+	if err != nil {
+		return newToolResultError(err)
+	}
+	return mcp.NewToolResultText(text), nil
+}
+
+// render renders the prompt with the arguments through its MCP handler and formats the resulting messages
+// as plain text. Missing required and invalid arguments are reported as an ArgumentsError.
+func (p loadedPrompt) render(ctx context.Context, args map[string]string) (string, error) {
+	var getReq mcp.GetPromptRequest
+	getReq.Params.Name = p.Prompt.Name
+	getReq.Params.Arguments = args
+	result, err := p.Handler(ctx, getReq)
+	if err != nil {
+		return "", err
+	}
+
+	messages := make([]renderedMessage, 0, len(result.Messages))
+	for _, msg := range result.Messages {
+		if textContent, ok := msg.Content.(mcp.TextContent); ok {
+			messages = append(messages, renderedMessage{Role: string(msg.Role), Text: textContent.Text})
+		}
+	}
+	return formatRenderedMessages(messages), nil
+}
+
+// lookupToolPrompt returns the prompt named in the tool request or the tool error result if there is no such prompt.
+func (ps *PromptsServer) lookupToolPrompt(request mcp.CallToolRequest) (loadedPrompt, *mcp.CallToolResult, error) {
+	name, err := request.RequireString("name")
+	if err != nil {
+		result, err := newToolResultError(err)
+		return loadedPrompt{}, result, err
+	}
+	ps.mu.RLock()
+	prompt, ok := ps.prompts[name]
+	ps.mu.RUnlock()
+	if !ok {
+		result, err := newToolResultError(fmt.Errorf("prompt %q not found", name))
+		return loadedPrompt{}, result, err
+	}
+	return prompt, nil, nil
+}
+
+func newToolResultJSON(value interface{}) (*mcp.CallToolResult, error) {
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal tool result: %w", err)
+	}
+	return mcp.NewToolResultText(string(content)), nil
+}
+
+// newToolResultError returns the error as a structured tool error, so clients can tell
+// which arguments are missing or invalid.
+func newToolResultError(err error) (*mcp.CallToolResult, error) {
+	toolErr := toolError{Error: err.Error()}
+	var argsErr *ArgumentsError
+	if errors.As(err, &argsErr) {
+		toolErr.Error = "invalid arguments"
+		toolErr.Arguments = argsErr.Errors
+	}
+	result, err := newToolResultJSON(toolErr)
+	if err != nil {
+		return nil, err
+	}
+	result.IsError = true
+	return result, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPromptToolsDisabledByDefault tests that prompt tools are registered only when enabled
+func (s *PromptsServerTestSuite) TestPromptToolsDisabledByDefault() {
+	ctx := context.Background()
+
+	_, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, "./testdata", true)
+	defer promptsClose()
+
+	_, err := mcpClient.ListTools(ctx, mcp.ListToolsRequest{})
+	assert.Error(s.T(), err, "Tools should not be available unless enabled")
+}
+
+// TestPromptToolsListPrompts tests the list_prompts tool
+func (s *PromptsServerTestSuite) TestPromptToolsListPrompts() {
+	ctx := context.Background()
+
+	_, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, "./testdata", true, WithPromptTools())
+	defer promptsClose()
+
+	listToolsResult, err := mcpClient.ListTools(ctx, mcp.ListToolsRequest{})
+	require.NoError(s.T(), err, "ListTools failed")
+	var toolNames []string
+	for _, tool := range listToolsResult.Tools {
+		toolNames = append(toolNames, tool.Name)
+	}
+	assert.ElementsMatch(s.T(), []string{toolListPrompts, toolGetPromptSchema, toolRenderPrompt}, toolNames,
+		"Unexpected tools")
+
+	text, isError := s.callTool(ctx, mcpClient, toolListPrompts, nil)
+	require.False(s.T(), isError, "list_prompts failed: %s", text)
+	var prompts []mcp.Prompt
+	require.NoError(s.T(), json.Unmarshal([]byte(text), &prompts), "Failed to unmarshal prompts")
+
+	listPromptsResult, err := mcpClient.ListPrompts(ctx, mcp.ListPromptsRequest{})
+	require.NoError(s.T(), err, "ListPrompts failed")
+	assert.ElementsMatch(s.T(), listPromptsResult.Prompts, prompts, "list_prompts should return the same prompts as prompts/list")
+}
+
+// TestPromptToolsGetPromptSchema tests the get_prompt_schema tool
+func (s *PromptsServerTestSuite) TestPromptToolsGetPromptSchema() {
+	ctx := context.Background()
+
+	_, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, "./testdata", true, WithPromptTools())
+	defer promptsClose()
+
+	text, isError := s.callTool(ctx, mcpClient, toolGetPromptSchema, map[string]interface{}{"name": "typed_args"})
+	require.False(s.T(), isError, "get_prompt_schema failed: %s", text)
+	assert.JSONEq(s.T(), `{
+		"name": "typed_args",
+		"description": "Template with typed arguments",
+		"inputSchema": {
+			"type": "object",
+			"properties": {
+				"count": {"type": "integer", "minimum": 1},
+				"items": {"type": "array", "items": {"type": "string"}},
+				"format": {"type": "string", "enum": ["text", "markdown"]}
+			},
+			"required": ["count", "format", "items"]
+		}
+	}`, text, "Unexpected prompt schema")
+
+	text, isError = s.callTool(ctx, mcpClient, toolGetPromptSchema, map[string]interface{}{"name": "optional_args"})
+	require.False(s.T(), isError, "get_prompt_schema failed: %s", text)
+	var schema promptSchema
+	require.NoError(s.T(), json.Unmarshal([]byte(text), &schema), "Failed to unmarshal prompt schema")
+	properties, ok := schema.InputSchema["properties"].(map[string]interface{})
+	require.True(s.T(), ok, "Expected properties object")
+	assert.Equal(s.T(), map[string]interface{}{"default": "Go", "description": "Programming language of the code"},
+		properties["programming_language"], "Argument description and default value should be included in the schema")
+
+	text, isError = s.callTool(ctx, mcpClient, toolGetPromptSchema, map[string]interface{}{"name": "range_structs"})
+	require.False(s.T(), isError, "get_prompt_schema failed: %s", text)
+	assert.JSONEq(s.T(), `{
+		"name": "range_structs",
+		"description": "Template for testing range with JSON array of structs",
+		"inputSchema": {
+			"type": "object",
+			"properties": {
+				"users": {"description": "JSON array or object"},
+				"total": {}
+			},
+			"required": ["total", "users"]
+		}
+	}`, text, "Types inferred from the template should be included in the schema")
+
+	text, isError = s.callTool(ctx, mcpClient, toolGetPromptSchema, map[string]interface{}{"name": "missing"})
+	assert.True(s.T(), isError, "Expected error for unknown prompt")
+	assert.JSONEq(s.T(), `{"error": "prompt \"missing\" not found"}`, text, "Unexpected error")
+}
+
+// TestPromptToolsRenderPrompt tests the render_prompt tool
+func (s *PromptsServerTestSuite) TestPromptToolsRenderPrompt() {
+	ctx := context.Background()
+
+	_, mcpClient, promptsClose := s.makePromptsServerAndClient(ctx, "./testdata", false, WithPromptTools())
+	defer promptsClose()
+
+	for _, tt := range []struct {
+		name         string
+		args         map[string]interface{}
+		expectedText string
+		isError      bool
+	}{
+		{
+			name:         "simple prompt",
+			args:         map[string]interface{}{"name": "greeting", "arguments": map[string]interface{}{"name": "Alice"}},
+			expectedText: "Hello Alice!\nHave a great day!",
+		},
+		{
+			name: "typed arguments as JSON values",
+			args: map[string]interface{}{"name": "typed_args", "arguments": map[string]interface{}{
+				"count": 2, "items": []interface{}{"a", "b"}, "format": "markdown",
+			}},
+			expectedText: "Format: markdown\n- a\n- b\nCount: 2\n",
+		},
+		{
+			name:         "multiple messages",
+			args:         map[string]interface{}{"name": "few_shot", "arguments": map[string]interface{}{"word": "cat"}},
+			expectedText: "--- user ---\nYou are a helpful translator.\n\n--- user ---\nTranslate \"hello\" to French.\n\n--- assistant ---\nBonjour\n\n--- user ---\nTranslate \"cat\" to French.",
+		},
+		{
+			name: "invalid arguments",
+			args: map[string]interface{}{"name": "typed_args", "arguments": map[string]interface{}{
+				"count": 0, "items": []interface{}{"a"}, "format": "html",
+			}},
+			expectedText: `{"error": "invalid arguments", "arguments": [
+				{"argument": "count", "message": "must be at least 1"},
+				{"argument": "format", "message": "must be one of: text, markdown"}
+			]}`,
+			isError: true,
+		},
+		{
+			name: "missing arguments",
+			args: map[string]interface{}{"name": "typed_args", "arguments": map[string]interface{}{"count": 1}},
+			expectedText: `{"error": "invalid arguments", "arguments": [
+				{"argument": "format", "message": "argument is required"},
+				{"argument": "items", "message": "argument is required"}
+			]}`,
+			isError: true,
+		},
+		{
+			name:         "unknown prompt",
+			args:         map[string]interface{}{"name": "missing"},
+			expectedText: `{"error": "prompt \"missing\" not found"}`,
+			isError:      true,
+		},
+	} {
+		s.Run(tt.name, func() {
+			text, isError := s.callTool(ctx, mcpClient, toolRenderPrompt, tt.args)
+			require.Equal(s.T(), tt.isError, isError, "Unexpected error state: %s", text)
+			if tt.isError {
+				assert.JSONEq(s.T(), tt.expectedText, text, "Unexpected tool error")
+				return
+			}
+			assert.Equal(s.T(), tt.expectedText, text, "Unexpected rendered prompt")
+		})
+	}
+}
+
+func (s *PromptsServerTestSuite) callTool(
+	ctx context.Context, mcpClient *client.Client, name string, args map[string]interface{},
+) (text string, isError bool) {
+	var callReq mcp.CallToolRequest
+	callReq.Params.Name = name
+	callReq.Params.Arguments = args
+	result, err := mcpClient.CallTool(ctx, callReq)
+	require.NoError(s.T(), err, "CallTool failed for %q", name)
+	require.Len(s.T(), result.Content, 1, "Expected exactly 1 content item")
+	content, ok := result.Content[0].(mcp.TextContent)
+	require.True(s.T(), ok, "Expected TextContent")
+	return content.Text, result.IsError
+}